@@ -0,0 +1,214 @@
+// Package apitoken stores personal API tokens.
+//
+// A token lets a script authenticate as the person who created it, with that
+// person's permissions. We only store a hash of each token, so a copy of the
+// store can't be used to log in; the token itself is shown once, when it's
+// created.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every token, so they're easy to recognize (and to search for
+// in source code, if one leaks).
+const Prefix = "lrt_"
+
+// Don't write the store to disk every time a token is used; LastUsed is only
+// accurate to within this interval.
+const lastUsedInterval = 1 * time.Minute
+
+// ErrNotFound is returned when a token does not exist, or has been revoked.
+var ErrNotFound = errors.New("apitoken: token not found")
+
+// A Token describes a token, but not its secret value.
+type Token struct {
+	// ID identifies the token on the settings page. It can't be used to
+	// authenticate.
+	ID string `json:"id"`
+	// The identity of the user who created the token.
+	Owner   string    `json:"owner"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+	// LastUsed is the zero time if the token has never been used.
+	LastUsed time.Time `json:"last_used"`
+}
+
+// A Store creates, finds and revokes tokens.
+type Store interface {
+	// Create makes a new token for owner, and returns it along with the
+	// secret value that should be sent in requests.
+	Create(owner string, name string) (*Token, string, error)
+	// List returns owner's tokens, newest first.
+	List(owner string) ([]*Token, error)
+	// Revoke deletes owner's token with the given id.
+	Revoke(owner string, id string) error
+	// Lookup returns the token for the secret value, and marks it as used.
+	Lookup(secret string) (*Token, error)
+}
+
+// Hash returns the value we store for the given secret.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// FileStore is a Store that keeps every token in a single JSON file. The file
+// is rewritten whenever a token is created, revoked or used.
+type FileStore struct {
+	path   string
+	mu     sync.Mutex
+	tokens map[string]*Token // by hash
+}
+
+// NewFileStore loads the store at path, creating it if it does not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, errors.New("apitoken: empty file path")
+	}
+	s := &FileStore{path: path, tokens: make(map[string]*Token)}
+	bits, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*Token
+	if err := json.Unmarshal(bits, &tokens); err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		s.tokens[t.Hash] = t
+	}
+	return s, nil
+}
+
+// save writes the store to a temporary file, then renames it, so a crash
+// can't leave a partial file behind. s.mu must be held.
+func (s *FileStore) save() error {
+	tokens := make([]*Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Sort(newestFirst(tokens))
+	bits, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), ".apitokens")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(bits); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+func (s *FileStore) Create(owner string, name string) (*Token, string, error) {
+	if owner == "" {
+		return nil, "", errors.New("apitoken: cannot create a token without an owner")
+	}
+	secret := Prefix + randomString(32)
+	t := &Token{
+		ID:      randomString(9),
+		Owner:   owner,
+		Name:    strings.TrimSpace(name),
+		Hash:    Hash(secret),
+		Created: time.Now().UTC(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[t.Hash] = t
+	if err := s.save(); err != nil {
+		delete(s.tokens, t.Hash)
+		return nil, "", err
+	}
+	tcopy := *t
+	return &tcopy, secret, nil
+}
+
+func (s *FileStore) List(owner string) ([]*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := make([]*Token, 0)
+	for _, t := range s.tokens {
+		if t.Owner == owner {
+			tcopy := *t
+			tokens = append(tokens, &tcopy)
+		}
+	}
+	sort.Sort(newestFirst(tokens))
+	return tokens, nil
+}
+
+func (s *FileStore) Revoke(owner string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.tokens {
+		if t.ID == id && t.Owner == owner {
+			delete(s.tokens, hash)
+			if err := s.save(); err != nil {
+				s.tokens[hash] = t
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *FileStore) Lookup(secret string) (*Token, error) {
+	if !strings.HasPrefix(secret, Prefix) {
+		return nil, ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[Hash(secret)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now().UTC()
+	if now.Sub(t.LastUsed) >= lastUsedInterval {
+		t.LastUsed = now
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	tcopy := *t
+	return &tcopy, nil
+}
+
+type newestFirst []*Token
+
+func (n newestFirst) Len() int           { return len(n) }
+func (n newestFirst) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n newestFirst) Less(i, j int) bool { return n[i].Created.After(n[j].Created) }
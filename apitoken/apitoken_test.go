@@ -0,0 +1,75 @@
+package apitoken
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-apitoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tokens.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, secret, err := s.Create("a@example.com", " Nightly report ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, Prefix) {
+		t.Errorf("expected secret to start with %s, got %s", Prefix, secret)
+	}
+	if tok.Name != "Nightly report" {
+		t.Errorf("expected name to be trimmed, got %q", tok.Name)
+	}
+	bits, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bits), secret) {
+		t.Error("expected the store not to contain the secret")
+	}
+	if _, _, err := s.Create("b@example.com", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload from disk.
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := s.Lookup(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != tok.ID || found.Owner != "a@example.com" {
+		t.Errorf("looked up wrong token: %#v", found)
+	}
+	if found.LastUsed.IsZero() {
+		t.Error("expected Lookup to set LastUsed")
+	}
+	if _, err := s.Lookup(secret + "x"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for a bad secret, got %v", err)
+	}
+	tokens, _ := s.List("a@example.com")
+	if len(tokens) != 1 {
+		t.Fatalf("expected 1 token for a@example.com, got %d", len(tokens))
+	}
+	if err := s.Revoke("b@example.com", tok.ID); err != ErrNotFound {
+		t.Errorf("expected other users not to be able to revoke the token, got %v", err)
+	}
+	if err := s.Revoke("a@example.com", tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Lookup(secret); err != ErrNotFound {
+		t.Errorf("expected revoked token to be rejected, got %v", err)
+	}
+}
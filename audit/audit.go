@@ -0,0 +1,161 @@
+// Package audit records which users looked at which resources.
+//
+// Logrole hides information from users who shouldn't see it, but it's also
+// useful to know who looked at the information they could see. Records are
+// only ever appended to the log; nothing in logrole modifies or removes them.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// An Action describes how a user accessed a resource.
+type Action string
+
+const (
+	// A user viewed a single resource, like a message or call.
+	ActionView Action = "view"
+	// A user searched or exported a list of resources.
+	ActionSearch Action = "search"
+	// A user viewed an image or other media attached to a message.
+	ActionMedia Action = "media"
+	// A user played a call recording.
+	ActionRecording Action = "recording"
+)
+
+// A Record describes a single request for a resource.
+type Record struct {
+	Time time.Time `json:"time"`
+	// The identity the Authenticator resolved for the user.
+	User string `json:"user"`
+	// The request's X-Request-Id header, so records can be matched with the
+	// server logs.
+	RequestID string `json:"request_id"`
+	// The name of the Twilio account the request was for.
+	Account string `json:"account,omitempty"`
+	Action  Action `json:"action"`
+	// The resource that was requested, if any. For media and recordings this
+	// is the SID of the message or recording.
+	Sid  string `json:"sid,omitempty"`
+	Path string `json:"path"`
+	// The filters used for a search.
+	Query string `json:"query,omitempty"`
+}
+
+// A Query describes the records to search for. Empty fields match every
+// record.
+type Query struct {
+	User  string
+	Sid   string
+	Start time.Time
+	End   time.Time
+	// The maximum number of records to return. Zero means no limit.
+	Limit int
+}
+
+func (q *Query) matches(r *Record) bool {
+	if q.User != "" && r.User != q.User {
+		return false
+	}
+	if q.Sid != "" && r.Sid != q.Sid {
+		return false
+	}
+	if !q.Start.IsZero() && r.Time.Before(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && !r.Time.Before(q.End) {
+		return false
+	}
+	return true
+}
+
+// A Log stores Records.
+type Log interface {
+	// Record appends r to the log.
+	Record(r *Record) error
+	// Search returns the records that match q, newest first.
+	Search(q Query) ([]*Record, error)
+}
+
+// FileLog is a Log that appends records to a file, one JSON object per line.
+type FileLog struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// NewFileLog opens the log at path, creating it if it does not exist.
+func NewFileLog(path string) (*FileLog, error) {
+	if path == "" {
+		return nil, errors.New("audit: empty file path")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLog{path: path, f: f}, nil
+}
+
+func (l *FileLog) Record(r *Record) error {
+	bits, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	bits = append(bits, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return errors.New("audit: Record called on a closed FileLog")
+	}
+	_, err = l.f.Write(bits)
+	return err
+}
+
+// Search reads every record in the file, so it gets slower as the log grows.
+// Lines that can't be parsed (a partial write, say) are skipped.
+func (l *FileLog) Search(q Query) ([]*Record, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records := make([]*Record, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			continue
+		}
+		if q.matches(r) {
+			records = append(records, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// Records are appended in the order they happened.
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[:q.Limit]
+	}
+	return records, nil
+}
+
+// Close closes the log file.
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
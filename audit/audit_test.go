@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLogSearch(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	l, err := NewFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)
+	l.Record(&Record{Time: now.Add(-2 * time.Hour), User: "a@example.com", Action: ActionView, Sid: "SM1"})
+	l.Record(&Record{Time: now.Add(-1 * time.Hour), User: "b@example.com", Action: ActionView, Sid: "SM1"})
+	l.Record(&Record{Time: now, User: "a@example.com", Action: ActionSearch, Query: "to=%2B14105551234"})
+	l.Close()
+
+	// Reopening shouldn't truncate the log.
+	l, err = NewFileLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	records, err := l.Search(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	if records[0].Action != ActionSearch {
+		t.Errorf("expected newest record first, got %#v", records[0])
+	}
+	records, _ = l.Search(Query{User: "a@example.com"})
+	if len(records) != 2 {
+		t.Errorf("expected 2 records for a@example.com, got %d", len(records))
+	}
+	records, _ = l.Search(Query{Sid: "SM1", Start: now.Add(-90 * time.Minute)})
+	if len(records) != 1 || records[0].User != "b@example.com" {
+		t.Errorf("expected one record from b@example.com, got %v", records)
+	}
+	records, _ = l.Search(Query{Limit: 1})
+	if len(records) != 1 {
+		t.Errorf("expected limit to apply, got %d records", len(records))
+	}
+}
@@ -5,6 +5,9 @@
 // first page of Messages or Calls, and any next_page_uri as soon as a user
 // retrieves any individual page. Fetching the page and caching it can greatly
 // improve latency.
+//
+// Encoded values are kept in a Store. By default this is an in-memory LRU
+// cache; use NewDiskStore to keep values across restarts.
 package cache
 
 import (
@@ -12,27 +15,120 @@ import (
 	"compress/gzip"
 	"encoding/gob"
 	"errors"
-	"sync"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aristanetworks/goarista/monotime"
-	"github.com/golang/groupcache/lru"
 	log "github.com/inconshreveable/log15"
 )
 
 type Cache struct {
+	// Accessed atomically. These are first in the struct to guarantee 64-bit
+	// alignment on 32-bit platforms.
+	hits    uint64
+	misses  uint64
+	expired uint64
+	stale   uint64
+
 	log.Logger
-	c  *lru.Cache
-	mu sync.RWMutex
+	store Store
+
+	// If nonzero, expired values are kept for this long after they expire,
+	// and GetStale returns them. Set this before using the Cache.
+	StaleGracePeriod time.Duration
+}
+
+// A Store holds encoded cache entries. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Get returns the Entry stored at key, or ErrNotFound if there is no such
+	// entry.
+	Get(key string) (*Entry, error)
+	// Set stores e at key. The Store may discard the entry once its timeout
+	// has elapsed.
+	Set(key string, e *Entry) error
+	// Remove deletes the entry at key. It is not an error to remove a key that
+	// does not exist.
+	Remove(key string) error
+	// List returns every entry in the Store, by key. Callers must not modify
+	// the entries.
+	List() (map[string]*Entry, error)
+}
+
+// An Entry is an encoded value, along with the information we need to expire
+// it.
+type Entry struct {
+	// The monotonic time the value was stored (see monotime.Now). Stores that
+	// persist across restarts need to translate this value.
+	Set uint64
+	// Expire values after Set + Timeout amount of time
+	Timeout uint64
+	Bits    []byte // call enc() to get an encoded value
 }
 
 var expired = errors.New("expired")
-var errNotFound = errors.New("Key not found in cache")
 
-func NewCache(size int, l log.Logger) *Cache {
+// ErrNotFound is returned when there's no value stored at a key.
+var ErrNotFound = errors.New("Key not found in cache")
+
+// Stats describes the contents of a Cache.
+type Stats struct {
+	// The total size of the keys and encoded values in the cache.
+	Bytes int64
+	// The most bytes the cache will hold before it evicts entries, or 0 if the
+	// size is unbounded.
+	MaxBytes int64
+	Entries  int
+	// The number of entries removed to make room for new ones.
+	Evictions uint64
+
+	// Lookups since the Cache was created. Expired lookups are not counted as
+	// misses.
+	Hits    uint64
+	Misses  uint64
+	Expired uint64
+	// Expired values returned by GetStale during the grace period.
+	Stale uint64
+}
+
+// EntryInfo describes an entry in the cache, without its value.
+type EntryInfo struct {
+	Key   string
+	Bytes int64
+	// How long ago the value was stored.
+	Age time.Duration
+	// How long until the value expires. Negative if it has already expired.
+	TTL time.Duration
+}
+
+func newEntryInfo(key string, e *Entry) *EntryInfo {
+	age := time.Duration(monotime.Since(e.Set))
+	return &EntryInfo{
+		Key:   key,
+		Bytes: int64(len(e.Bits)),
+		Age:   age,
+		TTL:   time.Duration(e.Timeout) - age,
+	}
+}
+
+// A Store can optionally report Stats about its contents.
+type statser interface {
+	Stats() Stats
+}
+
+// NewCache creates a Cache backed by an in-memory LRU store that holds up to
+// maxBytes of encoded values.
+func NewCache(maxBytes int64, l log.Logger) *Cache {
+	return NewCacheFromStore(NewLRUStore(maxBytes), l)
+}
+
+// NewCacheFromStore creates a Cache that keeps values in the given Store.
+func NewCacheFromStore(s Store, l log.Logger) *Cache {
 	return &Cache{
 		Logger: l,
-		c:      lru.New(size),
+		store:  s,
 	}
 }
 
@@ -54,55 +150,153 @@ func enc(data interface{}) []byte {
 // value was stored in the cache, or an error, if the value was not found,
 // expired, or could not be decoded into val.
 func (c *Cache) Get(key string, val interface{}) (uint64, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	cacheVal, ok := c.c.Get(key)
-	if !ok {
+	t, _, err := c.get(key, val, false)
+	return t, err
+}
+
+// GetStale is like Get, but if the value expired less than StaleGracePeriod
+// ago, it's decoded into val and returned with stale set to true. Callers
+// should fetch a fresh value.
+func (c *Cache) GetStale(key string, val interface{}) (t uint64, stale bool, err error) {
+	return c.get(key, val, true)
+}
+
+func (c *Cache) get(key string, val interface{}, allowStale bool) (uint64, bool, error) {
+	e, err := c.store.Get(key)
+	if err == ErrNotFound {
+		atomic.AddUint64(&c.misses, 1)
 		c.Debug("cache miss", "key", key)
-		return 0, errNotFound
+		return 0, false, ErrNotFound
 	}
-	e, ok := cacheVal.(*expiringBits)
-	if !ok {
-		c.Warn("Invalid value in cache", "val", cacheVal, "key", key)
-		return 0, errors.New("could not cast value to expiringBits")
+	if err != nil {
+		c.Warn("Error retrieving value from cache", "key", key, "err", err)
+		return 0, false, err
 	}
+	stale := false
 	if now, expires := monotime.Now(), e.Set+e.Timeout; now > expires {
-		c.Debug("found expired value in cache", "key", key, "expired_ago", time.Duration(now-expires))
-		c.c.Remove(key)
-		return 0, expired
+		expiredAgo := time.Duration(now - expires)
+		if expiredAgo > c.StaleGracePeriod {
+			atomic.AddUint64(&c.expired, 1)
+			c.Debug("found expired value in cache", "key", key, "expired_ago", expiredAgo)
+			if err := c.store.Remove(key); err != nil {
+				c.Warn("Error removing expired value from cache", "key", key, "err", err)
+			}
+			return 0, false, expired
+		}
+		if !allowStale {
+			// Keep the value around for GetStale.
+			atomic.AddUint64(&c.expired, 1)
+			return 0, false, expired
+		}
+		stale = true
 	}
 	reader, err := gzip.NewReader(bytes.NewReader(e.Bits))
 	if err != nil {
-		panic(err)
+		return 0, false, err
 	}
 	defer reader.Close()
 	dec := gob.NewDecoder(reader)
 	if err := dec.Decode(val); err != nil {
-		return 0, err
+		return 0, false, err
+	}
+	if stale {
+		atomic.AddUint64(&c.stale, 1)
+		c.Debug("stale cache hit", "key", key, "size", len(e.Bits))
+	} else {
+		atomic.AddUint64(&c.hits, 1)
+		c.Debug("cache hit", "key", key, "size", len(e.Bits))
 	}
-	c.Debug("cache hit", "key", key, "size", len(e.Bits))
-	return e.Set, nil
+	return e.Set, stale, nil
 }
 
 func (c *Cache) Set(key string, val interface{}, timeout time.Duration) {
 	if timeout < 0 {
 		panic("invalid timeout")
 	}
-	now := monotime.Now()
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	e := &expiringBits{
-		Set:     now,
+	e := &Entry{
+		Set:     monotime.Now(),
 		Timeout: uint64(timeout),
 		Bits:    enc(val),
 	}
-	c.c.Add(key, e)
-	c.Debug("stored data in cache", "key", key, "size", len(e.Bits), "cache_size", c.c.Len())
+	if err := c.store.Set(key, e); err != nil {
+		c.Warn("Error storing data in cache", "key", key, "err", err)
+		return
+	}
+	c.Debug("stored data in cache", "key", key, "size", len(e.Bits))
 }
 
-type expiringBits struct {
-	Set uint64
-	// Expire values after Set + Timeout amount of time
-	Timeout uint64
-	Bits    []byte // call enc() to get an encoded value
+// Stats returns the number of lookups since the Cache was created, and the
+// current size of the cache. If the Store can't report its size, those fields
+// are zero.
+func (c *Cache) Stats() Stats {
+	var stats Stats
+	if s, ok := c.store.(statser); ok {
+		stats = s.Stats()
+	}
+	stats.Hits = atomic.LoadUint64(&c.hits)
+	stats.Misses = atomic.LoadUint64(&c.misses)
+	stats.Expired = atomic.LoadUint64(&c.expired)
+	stats.Stale = atomic.LoadUint64(&c.stale)
+	return stats
+}
+
+// Peek returns information about the value at key, including expired values
+// that haven't been removed yet. Peek does not count as a lookup in Stats.
+func (c *Cache) Peek(key string) (*EntryInfo, error) {
+	e, err := c.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return newEntryInfo(key, e), nil
+}
+
+type byBytes []*EntryInfo
+
+func (b byBytes) Len() int           { return len(b) }
+func (b byBytes) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byBytes) Less(i, j int) bool { return b[i].Bytes > b[j].Bytes }
+
+// Largest returns the n largest entries in the cache, largest first.
+func (c *Cache) Largest(n int) ([]*EntryInfo, error) {
+	entries, err := c.store.List()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*EntryInfo, 0, len(entries))
+	for key, e := range entries {
+		infos = append(infos, newEntryInfo(key, e))
+	}
+	sort.Sort(byBytes(infos))
+	if len(infos) > n {
+		infos = infos[:n]
+	}
+	return infos, nil
+}
+
+// RemovePrefix deletes every value whose key starts with prefix, and returns
+// the number of values that were deleted. An empty prefix deletes everything.
+func (c *Cache) RemovePrefix(prefix string) (int, error) {
+	entries, err := c.store.List()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for key := range entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if err := c.store.Remove(key); err != nil {
+			return count, err
+		}
+		count++
+	}
+	c.Info("removed values from cache", "prefix", prefix, "count", count)
+	return count, nil
+}
+
+// Remove deletes the value at key from the cache.
+func (c *Cache) Remove(key string) {
+	if err := c.store.Remove(key); err != nil {
+		c.Warn("Error removing value from cache", "key", key, "err", err)
+	}
 }
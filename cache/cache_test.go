@@ -3,6 +3,7 @@ package cache
 import (
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,7 +17,7 @@ func TestEncodeDecode(t *testing.T) {
 	if err := json.Unmarshal(test.MessageBody, mp); err != nil {
 		t.Fatal(err)
 	}
-	c := NewCache(1, test.NullLogger)
+	c := NewCache(1024*1024, test.NullLogger)
 	c.Set("npuri", mp, time.Hour)
 	mp2 := new(twilio.MessagePage)
 	_, err := c.Get("npuri", mp2)
@@ -34,11 +35,11 @@ func TestValueNotFound(t *testing.T) {
 	if err := json.Unmarshal(test.MessageBody, mp); err != nil {
 		t.Fatal(err)
 	}
-	c := NewCache(1, test.NullLogger)
+	c := NewCache(1024*1024, test.NullLogger)
 	c.Set("npuri", mp, time.Hour)
 	mp2 := new(twilio.MessagePage)
 	_, err := c.Get("npuri+badcacheget", mp2)
-	if err != errNotFound {
+	if err != ErrNotFound {
 		t.Errorf("retrieved message page from cache, should have got false: %#v", err)
 	}
 }
@@ -49,7 +50,7 @@ func TestExpiredValueNotFound(t *testing.T) {
 	if err := json.Unmarshal(test.MessageBody, mp); err != nil {
 		t.Fatal(err)
 	}
-	c := NewCache(1, test.NullLogger)
+	c := NewCache(1024*1024, test.NullLogger)
 	c.Set("npuri", mp, time.Nanosecond)
 	mp2 := new(twilio.MessagePage)
 	_, err := c.Get("npuri", mp2)
@@ -57,3 +58,102 @@ func TestExpiredValueNotFound(t *testing.T) {
 		t.Errorf("retrieved message page from cache, it should have expired: %#v", err)
 	}
 }
+
+func TestStatsCountsLookups(t *testing.T) {
+	t.Parallel()
+	c := NewCache(1024*1024, test.NullLogger)
+	c.Set("hit", "value", time.Hour)
+	c.Set("expired", "value", time.Nanosecond)
+	var s string
+	c.Get("hit", &s)
+	c.Get("hit", &s)
+	c.Get("miss", &s)
+	c.Get("expired", &s)
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Expired != 1 {
+		t.Errorf("expected 2 hits, 1 miss, 1 expired, got %#v", stats)
+	}
+	if stats.Entries != 1 {
+		t.Errorf("expected expired entry to be removed, got %d entries", stats.Entries)
+	}
+}
+
+func TestRemovePrefix(t *testing.T) {
+	t.Parallel()
+	c := NewCache(1024*1024, test.NullLogger)
+	c.Set("messages|a", "value", time.Hour)
+	c.Set("messages|b", "value", time.Hour)
+	c.Set("calls|a", "value", time.Hour)
+	count, err := c.RemovePrefix("messages|")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected to remove 2 values, removed %d", count)
+	}
+	var s string
+	if _, err := c.Get("messages|a", &s); err != ErrNotFound {
+		t.Errorf("expected messages|a to be removed, got %v", err)
+	}
+	if _, err := c.Get("calls|a", &s); err != nil {
+		t.Errorf("expected calls|a to remain, got %v", err)
+	}
+	if _, err := c.RemovePrefix(""); err != nil {
+		t.Fatal(err)
+	}
+	if entries := c.Stats().Entries; entries != 0 {
+		t.Errorf("expected empty cache, got %d entries", entries)
+	}
+}
+
+func TestLargest(t *testing.T) {
+	t.Parallel()
+	c := NewCache(1024*1024, test.NullLogger)
+	c.Set("small", "a", time.Hour)
+	c.Set("large", strings.Repeat("abcdefghijklmnopqrstuvwxyz", 100), time.Hour)
+	c.Set("medium", strings.Repeat("a", 100), time.Hour)
+	infos, err := c.Largest(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Key != "large" || infos[1].Key != "medium" {
+		t.Errorf("expected large and medium entries, got %v", infos)
+	}
+}
+
+func TestGetStale(t *testing.T) {
+	t.Parallel()
+	c := NewCache(1024*1024, test.NullLogger)
+	c.StaleGracePeriod = time.Hour
+	c.Set("key", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	var s string
+	if _, err := c.Get("key", &s); err != expired {
+		t.Errorf("expected Get to return expired, got %v", err)
+	}
+	_, stale, err := c.GetStale("key", &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stale || s != "value" {
+		t.Errorf("expected stale value, got %q (stale: %t)", s, stale)
+	}
+	if stats := c.Stats(); stats.Stale != 1 || stats.Hits != 0 {
+		t.Errorf("expected 1 stale hit and no hits, got %#v", stats)
+	}
+}
+
+func TestGetStaleAfterGracePeriod(t *testing.T) {
+	t.Parallel()
+	c := NewCache(1024*1024, test.NullLogger)
+	c.StaleGracePeriod = time.Nanosecond
+	c.Set("key", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	var s string
+	if _, _, err := c.GetStale("key", &s); err != expired {
+		t.Errorf("expected GetStale to return expired, got %v", err)
+	}
+	if entries := c.Stats().Entries; entries != 0 {
+		t.Errorf("expected value to be removed, got %d entries", entries)
+	}
+}
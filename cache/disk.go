@@ -0,0 +1,341 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+)
+
+// DefaultSweepInterval is how often a DiskStore removes expired entries, if
+// you call Sweep.
+const DefaultSweepInterval = 5 * time.Minute
+
+// DiskStore is a Store that keeps each entry in its own file in a directory,
+// so cached values survive a restart, and can be shared by servers that mount
+// the same directory. Once the entries are larger than the byte limit, the
+// oldest ones are removed.
+type DiskStore struct {
+	// Accessed atomically. These are first in the struct to guarantee 64-bit
+	// alignment on 32-bit platforms.
+	//
+	// bytes is our estimate of the size of the entries on disk. Other
+	// servers may write to the same directory, so evict counts the real
+	// size before it removes anything.
+	bytes     int64
+	evictions uint64
+
+	dir      string
+	maxBytes int64
+	// Expired entries are kept on disk this long, so Cache.GetStale can
+	// still find them.
+	gracePeriod time.Duration
+	// Held while evicting entries, so we don't try to remove the same files
+	// twice.
+	mu sync.Mutex
+}
+
+// diskEntry is the representation of an Entry on disk. Monotonic times are
+// meaningless after a restart, so we store the wall clock time instead.
+type diskEntry struct {
+	Key     string
+	Stored  time.Time
+	Timeout uint64
+	Bits    []byte
+}
+
+const tmpPrefix = ".tmp-"
+
+// Temporary files older than this are left over from a write that didn't
+// finish.
+const tmpFileAge = time.Minute
+
+// NewDiskStore creates a DiskStore in dir that holds up to maxBytes of
+// entries, creating the directory if it does not exist. If maxBytes is 0,
+// the size is unbounded. Entries that expired more than gracePeriod ago are
+// removed, including ones left over from a previous run; gracePeriod should
+// match the StaleGracePeriod of the Cache that uses the store.
+func NewDiskStore(dir string, maxBytes int64, gracePeriod time.Duration) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	d := &DiskStore{dir: dir, maxBytes: maxBytes, gracePeriod: gracePeriod}
+	if err := d.removeExpired(); err != nil {
+		return nil, err
+	}
+	if err := d.evict(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// path returns the filename for key. Keys contain URL's and other characters
+// that aren't safe to use in a filename, so we hash them.
+func (d *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+func readDiskEntry(path string) (*diskEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	de := new(diskEntry)
+	if err := gob.NewDecoder(f).Decode(de); err != nil {
+		return nil, err
+	}
+	return de, nil
+}
+
+func (d *DiskStore) Get(key string) (*Entry, error) {
+	de, err := readDiskEntry(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if de.Key != key {
+		return nil, ErrNotFound
+	}
+	return de.entry(), nil
+}
+
+// entry translates the wall clock time back into a monotonic time, and
+// returns the Entry.
+func (de *diskEntry) entry() *Entry {
+	now := monotime.Now()
+	age := uint64(0)
+	if since := time.Since(de.Stored); since > 0 {
+		age = uint64(since)
+	}
+	var set uint64
+	if age < now {
+		set = now - age
+	}
+	return &Entry{
+		Set:     set,
+		Timeout: de.Timeout,
+		Bits:    de.Bits,
+	}
+}
+
+func (d *DiskStore) Set(key string, e *Entry) error {
+	de := &diskEntry{
+		Key:     key,
+		Stored:  time.Now().Add(-time.Duration(monotime.Since(e.Set))),
+		Timeout: e.Timeout,
+		Bits:    e.Bits,
+	}
+	// Write to a temporary file and rename it, so readers never see a partly
+	// written entry.
+	f, err := ioutil.TempFile(d.dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(de); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if d.maxBytes > 0 && fi.Size() > d.maxBytes {
+		os.Remove(f.Name())
+		return fmt.Errorf("cache entry is %d bytes, larger than the %d byte limit", fi.Size(), d.maxBytes)
+	}
+	if err := os.Rename(f.Name(), d.path(key)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	// If we replaced an entry, this overcounts until the next evict.
+	if total := atomic.AddInt64(&d.bytes, fi.Size()); d.maxBytes > 0 && total > d.maxBytes {
+		return d.evict()
+	}
+	return nil
+}
+
+func (d *DiskStore) Remove(key string) error {
+	path := d.path(key)
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		atomic.AddInt64(&d.bytes, -fi.Size())
+	}
+	return nil
+}
+
+// List reads and returns every entry on disk.
+func (d *DiskStore) List() (map[string]*Entry, error) {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*Entry)
+	for _, file := range files {
+		if file.IsDir() || !isEntryName(file.Name()) {
+			continue
+		}
+		de, err := readDiskEntry(filepath.Join(d.dir, file.Name()))
+		if os.IsNotExist(err) {
+			// removed since we read the directory
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries[de.Key] = de.entry()
+	}
+	return entries, nil
+}
+
+// Stats returns the number and total size of the entries on disk, and the
+// number of entries this DiskStore removed to stay under its byte limit.
+func (d *DiskStore) Stats() Stats {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return Stats{}
+	}
+	stats := Stats{
+		MaxBytes:  d.maxBytes,
+		Evictions: atomic.LoadUint64(&d.evictions),
+	}
+	for _, file := range files {
+		if file.IsDir() || !isEntryName(file.Name()) {
+			continue
+		}
+		stats.Entries++
+		stats.Bytes += file.Size()
+	}
+	return stats
+}
+
+// isEntryName reports whether name could be the name of an entry file.
+func isEntryName(name string) bool {
+	if len(name) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// removeExpired deletes entries that expired more than the grace period ago,
+// and temporary files from writes that didn't finish. Entries that fail to decode are removed as well.
+func (d *DiskStore) removeExpired() error {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(d.dir, file.Name())
+		if strings.HasPrefix(file.Name(), tmpPrefix) {
+			// Don't remove a file that's still being written.
+			if time.Since(file.ModTime()) > tmpFileAge {
+				os.Remove(path)
+			}
+			continue
+		}
+		// Don't touch files we didn't create.
+		if !isEntryName(file.Name()) {
+			continue
+		}
+		de, err := readDiskEntry(path)
+		if err != nil || time.Since(de.Stored) > time.Duration(de.Timeout)+d.gracePeriod {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// oldestFirst sorts entry files by the time they were written.
+type oldestFirst []os.FileInfo
+
+func (o oldestFirst) Len() int           { return len(o) }
+func (o oldestFirst) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o oldestFirst) Less(i, j int) bool { return o[i].ModTime().Before(o[j].ModTime()) }
+
+// evict removes the oldest entries until the entries on disk are under the
+// byte limit. We don't track when entries are read, so unlike LRUStore this
+// removes the least recently written entries, not the least recently used.
+func (d *DiskStore) evict() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	entries := make([]os.FileInfo, 0, len(files))
+	var total int64
+	for _, file := range files {
+		if file.IsDir() || !isEntryName(file.Name()) {
+			continue
+		}
+		entries = append(entries, file)
+		total += file.Size()
+	}
+	if d.maxBytes > 0 && total > d.maxBytes {
+		sort.Sort(oldestFirst(entries))
+		for _, file := range entries {
+			if total <= d.maxBytes {
+				break
+			}
+			err := os.Remove(filepath.Join(d.dir, file.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			total -= file.Size()
+			atomic.AddUint64(&d.evictions, 1)
+		}
+	}
+	atomic.StoreInt64(&d.bytes, total)
+	return nil
+}
+
+// Sweep removes expired entries every interval, until done is closed. Entries
+// are kept until their grace period is over.
+// Expired entries are also removed when they're read, but entries for pages
+// nobody looks at again would otherwise stay on disk until the store is full.
+func (d *DiskStore) Sweep(interval time.Duration, done <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			d.removeExpired()
+			d.evict()
+		}
+	}
+}
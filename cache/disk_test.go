@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	"github.com/saintpete/logrole/test"
+	twilio "github.com/saintpete/twilio-go"
+)
+
+func newDiskCache(t *testing.T, dir string) *Cache {
+	store, err := NewDiskStore(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCacheFromStore(store, test.NullLogger)
+}
+
+func TestDiskStorePersists(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mp := new(twilio.MessagePage)
+	if err := json.Unmarshal(test.MessageBody, mp); err != nil {
+		t.Fatal(err)
+	}
+	newDiskCache(t, dir).Set("messages|npuri", mp, time.Hour)
+	// A new store in the same directory should find the value.
+	c := newDiskCache(t, dir)
+	mp2 := new(twilio.MessagePage)
+	if _, err := c.Get("messages|npuri", mp2); err != nil {
+		t.Fatalf("couldn't retrieve message page from cache: %v", err)
+	}
+	if !reflect.DeepEqual(mp, mp2) {
+		t.Errorf("structs were not deep equal")
+	}
+	c.Remove("messages|npuri")
+	if _, err := c.Get("messages|npuri", mp2); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound after Remove, got %v", err)
+	}
+}
+
+func TestDiskStoreExpired(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := newDiskCache(t, dir)
+	c.Set("key", "value", time.Nanosecond)
+	var val string
+	if _, err := c.Get("key", &val); err != expired {
+		t.Errorf("expected value to expire, got %v", err)
+	}
+	c.Set("key2", "value", time.Nanosecond)
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	newDiskCache(t, dir)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "README" {
+		t.Errorf("expected only README to be left in the directory, got %d files", len(files))
+	}
+}
+
+func TestDiskStoreEvictsOldest(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewDiskStore(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Entry{Set: monotime.Now(), Timeout: uint64(time.Hour), Bits: make([]byte, 1000)}
+	for i, key := range []string{"a", "b", "c"} {
+		if err := store.Set(key, e); err != nil {
+			t.Fatal(err)
+		}
+		// Make sure the entries are in order, even on filesystems with
+		// coarse timestamps.
+		mtime := time.Now().Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(store.path(key), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := store.Stats().Bytes / 3
+	// Room for two entries.
+	store, err = NewDiskStore(dir, 2*size+size/2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("a"); err != ErrNotFound {
+		t.Errorf("expected oldest entry to be evicted, got %v", err)
+	}
+	if err := store.Set("d", e); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("b"); err != ErrNotFound {
+		t.Errorf("expected oldest entry to be evicted, got %v", err)
+	}
+	for _, key := range []string{"c", "d"} {
+		if _, err := store.Get(key); err != nil {
+			t.Errorf("expected %s to be kept, got %v", key, err)
+		}
+	}
+	stats := store.Stats()
+	if stats.Entries != 2 || stats.Evictions != 2 || stats.MaxBytes != 2*size+size/2 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+	if err := store.Set("huge", &Entry{Set: monotime.Now(), Timeout: uint64(time.Hour), Bits: make([]byte, 3*size)}); err == nil {
+		t.Error("expected an error storing an entry larger than the limit, got nil")
+	}
+}
+
+func TestDiskStoreSweep(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewDiskStore(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	defer close(done)
+	go store.Sweep(5*time.Millisecond, done)
+	c := NewCacheFromStore(store, test.NullLogger)
+	c.Set("key", "value", time.Nanosecond)
+	for i := 0; i < 200; i++ {
+		if store.Stats().Entries == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("expected Sweep to remove the expired entry")
+}
+
+func TestDiskStoreSweepKeepsStaleEntries(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewDiskStore(dir, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCacheFromStore(store, test.NullLogger)
+	c.StaleGracePeriod = time.Hour
+	c.Set("key", "value", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if err := store.removeExpired(); err != nil {
+		t.Fatal(err)
+	}
+	var val string
+	if _, stale, err := c.GetStale("key", &val); err != nil || !stale || val != "value" {
+		t.Errorf("expected a stale value after the sweep, got %q (stale %t, err %v)", val, stale, err)
+	}
+	// A new store over the same directory keeps it as well.
+	if _, err := NewDiskStore(dir, 0, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if entries := store.Stats().Entries; entries != 1 {
+		t.Errorf("expected the stale entry to be kept, got %d entries", entries)
+	}
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// LRUStore is an in-memory Store that evicts the least recently used entries
+// once the entries it holds are larger than its byte limit. Entries don't
+// survive a restart.
+type LRUStore struct {
+	c *lru.Cache
+	// lru.Cache.Get modifies the cache, so we need a full lock for reads too.
+	mu sync.Mutex
+	// lru.Cache can't list its contents, so we keep our own index.
+	entries   map[string]*Entry
+	maxBytes  int64
+	bytes     int64
+	evictions uint64
+}
+
+// NewLRUStore creates a LRUStore that holds up to maxBytes of keys and
+// encoded values.
+func NewLRUStore(maxBytes int64) *LRUStore {
+	s := &LRUStore{
+		c:        lru.New(0),
+		entries:  make(map[string]*Entry),
+		maxBytes: maxBytes,
+	}
+	// OnEvicted is called for every removal, not just evictions, so this is
+	// the one place we need to update the byte count and index.
+	s.c.OnEvicted = func(key lru.Key, val interface{}) {
+		s.bytes -= entrySize(key.(string), val.(*Entry))
+		delete(s.entries, key.(string))
+	}
+	return s
+}
+
+// entrySize returns the number of bytes we count against the store's limit
+// for e. The size of the Entry's other fields is negligible.
+func entrySize(key string, e *Entry) int64 {
+	return int64(len(key) + len(e.Bits))
+}
+
+func (s *LRUStore) Get(key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.c.Get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	e, ok := val.(*Entry)
+	if !ok {
+		return nil, errors.New("could not cast value to Entry")
+	}
+	return e, nil
+}
+
+// Set stores e at key, evicting the least recently used entries until the
+// store is back under its byte limit. An entry that is larger than the limit
+// on its own is not stored.
+func (s *LRUStore) Set(key string, e *Entry) error {
+	size := entrySize(key, e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// lru.Cache.Add replaces an existing value without calling OnEvicted, so
+	// remove it first to keep the byte count right.
+	s.c.Remove(key)
+	if size > s.maxBytes {
+		return fmt.Errorf("cache entry is %d bytes, larger than the %d byte limit", size, s.maxBytes)
+	}
+	s.c.Add(key, e)
+	s.entries[key] = e
+	s.bytes += size
+	for s.bytes > s.maxBytes {
+		s.c.RemoveOldest()
+		s.evictions++
+	}
+	return nil
+}
+
+func (s *LRUStore) Remove(key string) error {
+	s.mu.Lock()
+	s.c.Remove(key)
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns every entry in the store, without changing the order in which
+// entries will be evicted.
+func (s *LRUStore) List() (map[string]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make(map[string]*Entry, len(s.entries))
+	for key, e := range s.entries {
+		entries[key] = e
+	}
+	return entries, nil
+}
+
+// Len returns the number of entries in the store.
+func (s *LRUStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Len()
+}
+
+// Stats returns the current size of the store, and the number of entries
+// that have been evicted to stay under the byte limit.
+func (s *LRUStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Bytes:     s.bytes,
+		MaxBytes:  s.maxBytes,
+		Entries:   s.c.Len(),
+		Evictions: s.evictions,
+	}
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"testing"
+)
+
+func entryOfSize(n int) *Entry {
+	return &Entry{Timeout: 1 << 62, Bits: make([]byte, n)}
+}
+
+func TestLRUStoreEvictsByBytes(t *testing.T) {
+	t.Parallel()
+	s := NewLRUStore(300)
+	s.Set("a", entryOfSize(99))
+	s.Set("b", entryOfSize(99))
+	s.Set("c", entryOfSize(99))
+	if stats := s.Stats(); stats.Bytes != 300 || stats.Entries != 3 || stats.Evictions != 0 {
+		t.Fatalf("unexpected stats after three entries: %#v", stats)
+	}
+	// "a" is now the most recently used, so "b" should be evicted.
+	if _, err := s.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	s.Set("d", entryOfSize(99))
+	if _, err := s.Get("b"); err != ErrNotFound {
+		t.Errorf("expected b to be evicted, got %v", err)
+	}
+	stats := s.Stats()
+	if stats.Bytes != 300 || stats.Entries != 3 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats after eviction: %#v", stats)
+	}
+	// One big entry can push out several small ones.
+	s.Set("e", entryOfSize(199))
+	stats = s.Stats()
+	if stats.Bytes != 300 || stats.Entries != 2 || stats.Evictions != 3 {
+		t.Errorf("unexpected stats after large entry: %#v", stats)
+	}
+}
+
+func TestLRUStoreReplaceUpdatesBytes(t *testing.T) {
+	t.Parallel()
+	s := NewLRUStore(1000)
+	s.Set("a", entryOfSize(99))
+	s.Set("a", entryOfSize(49))
+	if stats := s.Stats(); stats.Bytes != 50 || stats.Entries != 1 {
+		t.Errorf("expected replaced entry to count 50 bytes, got %#v", stats)
+	}
+	s.Remove("a")
+	if stats := s.Stats(); stats.Bytes != 0 || stats.Entries != 0 || stats.Evictions != 0 {
+		t.Errorf("expected empty store after Remove, got %#v", stats)
+	}
+}
+
+func TestLRUStoreRejectsOversizedEntry(t *testing.T) {
+	t.Parallel()
+	s := NewLRUStore(100)
+	s.Set("a", entryOfSize(50))
+	if err := s.Set("b", entryOfSize(200)); err == nil {
+		t.Error("expected error storing an entry larger than the limit, got nil")
+	}
+	if _, err := s.Get("a"); err != nil {
+		t.Errorf("oversized entry should not evict existing entries, got %v", err)
+	}
+}
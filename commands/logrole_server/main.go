@@ -9,10 +9,13 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	log "github.com/inconshreveable/log15"
 	"github.com/kevinburke/handlers"
+	"github.com/saintpete/logrole/cache"
 	"github.com/saintpete/logrole/config"
 	"github.com/saintpete/logrole/server"
 	"github.com/saintpete/logrole/services"
@@ -88,6 +91,16 @@ func main() {
 		os.Exit(2)
 	}
 	s.CacheCommonQueries()
+	s.IndexMessages()
+	if ds, ok := settings.CacheStore.(*cache.DiskStore); ok {
+		go ds.Sweep(cache.DefaultSweepInterval, nil)
+	}
+	if settings.PolicyReloader != nil {
+		// Reload the policy when the file changes, or on `kill -HUP`.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go settings.PolicyReloader.Watch(config.DefaultPolicyReloadInterval, hup, nil)
+	}
 	publicMux := http.NewServeMux()
 	publicMux.Handle("/", s)
 	publicServer := http.Server{
@@ -31,6 +31,9 @@ PUBLIC_HOST            Host your users will browse to to see the site
 
 TWILIO_ACCOUNT_SID     Account SID for your Twilio account
 TWILIO_AUTH_TOKEN      Auth token
+TWILIO_ACCOUNTS        Comma-separated list of accounts to browse, each
+                       written as name:account_sid:auth_token. Use instead of
+                       TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN.
 
 REALM                  Realm (either "local" or "prod")
 TZ                     Default timezone (example "America/Los_Angeles")
@@ -46,17 +49,42 @@ MAX_RESOURCE_AGE       How long resources should be visible for - "720h" to
 SHOW_MEDIA_BY_DEFAULT  "false" to hide images behind a toggle when a user
                        browses to a MMS message.
 
-AUTH_SCHEME            "basic", "noop", or "google"
+AUTH_SCHEME            "basic", "noop", "google", or "oidc"
 BASIC_AUTH_USER        For basic auth, the username
 BASIC_AUTH_PASSWORD    For basic auth, the password
 GOOGLE_CLIENT_ID       For Google OAuth
 GOOGLE_CLIENT_SECRET   For Google OAuth
 GOOGLE_ALLOWED_DOMAINS Comma separated list of domains to allow to
                        authenticate. If empty or omitted, all domains allowed.
+OIDC_ISSUER            For OpenID Connect, the issuer URL
+OIDC_CLIENT_ID         For OpenID Connect
+OIDC_CLIENT_SECRET     For OpenID Connect
+OIDC_USER_ID_CLAIM     The ID token claim that identifies a user. Defaults to
+                       "email".
+OIDC_GROUPS_CLAIM      The ID token claim that lists a user's groups. Defaults
+                       to "groups".
+OIDC_PROVIDER_NAME     The name shown on the login button. Defaults to
+                       "Single Sign-On".
 
 ERROR_REPORTER         "sentry", empty, or register your own.
 ERROR_REPORTER_TOKEN   Token for the error reporter.
 
+CACHE_BACKEND          "memory" (the default) or "disk"
+CACHE_DIRECTORY        For the disk cache, where to store cached responses
+CACHE_SIZE_MB          How many megabytes of responses to cache, in memory
+                       or on disk. Defaults to 25.
+CACHE_STALE_GRACE_PERIOD
+                       How long to serve expired responses while they're
+                       refreshed - "10m" for ten minutes. Defaults to 0.
+
+MESSAGE_INDEX_DIRECTORY
+                       Index message bodies in this directory, so users can
+                       search by message body. Disabled if empty.
+AUDIT_LOG_FILE         Record which users viewed which resources in this file.
+                       Disabled if empty.
+API_TOKEN_FILE         Let users create personal API tokens, and store them in
+                       this file. Disabled if empty.
+
 POLICY_FILE            Load policy info from a file
 POLICY_URL             Download policy info from the specified URL. HTTPS only.
                        Can be protected with Basic Auth. Consider using Dropbox
@@ -113,6 +141,26 @@ func writeCommaSeparatedVal(w io.Writer, e environment, env string, cfgval strin
 	return false
 }
 
+// writeAccounts writes the accounts in env, a comma-separated list of
+// name:account_sid:auth_token values.
+func writeAccounts(w io.Writer, e environment, env string) (bool, error) {
+	v, ok := e.LookupEnv(env)
+	if !ok {
+		return false, nil
+	}
+	_, err := fmt.Fprintln(w, "accounts:")
+	checkErr(err, "writing config")
+	for _, account := range strings.Split(v, ",") {
+		parts := strings.Split(strings.TrimSpace(account), ":")
+		if len(parts) != 3 {
+			return false, fmt.Errorf("%s should look like name:account_sid:auth_token, got %s", env, account)
+		}
+		_, err := fmt.Fprintf(w, "  - name: %s\n    twilio_account_sid: %s\n    twilio_auth_token: %s\n", parts[0], parts[1], parts[2])
+		checkErr(err, "writing config")
+	}
+	return true, nil
+}
+
 func writeConfig(b *bytes.Buffer, e environment) {
 	var ok bool
 	ok = writeVal(b, e, "PORT", "port") || ok
@@ -124,6 +172,9 @@ func writeConfig(b *bytes.Buffer, e environment) {
 	}
 	ok = writeVal(b, e, "TWILIO_ACCOUNT_SID", "twilio_account_sid") || ok
 	ok = writeVal(b, e, "TWILIO_AUTH_TOKEN", "twilio_auth_token") || ok
+	wrote, err := writeAccounts(b, e, "TWILIO_ACCOUNTS")
+	checkErr(err, "loading accounts from the environment")
+	ok = wrote || ok
 	if ok {
 		b.WriteByte('\n')
 		ok = false
@@ -150,6 +201,12 @@ func writeConfig(b *bytes.Buffer, e environment) {
 	ok = writeVal(b, e, "GOOGLE_CLIENT_ID", "google_client_id") || ok
 	ok = writeVal(b, e, "GOOGLE_CLIENT_SECRET", "google_client_secret") || ok
 	ok = writeCommaSeparatedVal(b, e, "GOOGLE_ALLOWED_DOMAINS", "google_allowed_domains") || ok
+	ok = writeVal(b, e, "OIDC_ISSUER", "oidc_issuer") || ok
+	ok = writeVal(b, e, "OIDC_CLIENT_ID", "oidc_client_id") || ok
+	ok = writeVal(b, e, "OIDC_CLIENT_SECRET", "oidc_client_secret") || ok
+	ok = writeVal(b, e, "OIDC_USER_ID_CLAIM", "oidc_user_id_claim") || ok
+	ok = writeVal(b, e, "OIDC_GROUPS_CLAIM", "oidc_groups_claim") || ok
+	ok = writeVal(b, e, "OIDC_PROVIDER_NAME", "oidc_provider_name") || ok
 	if ok {
 		b.WriteByte('\n')
 		ok = false
@@ -160,10 +217,26 @@ func writeConfig(b *bytes.Buffer, e environment) {
 		b.WriteByte('\n')
 		ok = false
 	}
+	ok = writeVal(b, e, "CACHE_BACKEND", "cache_backend") || ok
+	ok = writeVal(b, e, "CACHE_DIRECTORY", "cache_directory") || ok
+	ok = writeVal(b, e, "CACHE_SIZE_MB", "cache_size_mb") || ok
+	ok = writeVal(b, e, "CACHE_STALE_GRACE_PERIOD", "cache_stale_grace_period") || ok
+	if ok {
+		b.WriteByte('\n')
+		ok = false
+	}
+
+	ok = writeVal(b, e, "MESSAGE_INDEX_DIRECTORY", "message_index_directory") || ok
+	ok = writeVal(b, e, "AUDIT_LOG_FILE", "audit_log_file") || ok
+	ok = writeVal(b, e, "API_TOKEN_FILE", "api_token_file") || ok
+	if ok {
+		b.WriteByte('\n')
+		ok = false
+	}
 
 	checkErr(validatePolicy(e), "loading policy from the environment")
 	_ = writeVal(b, e, "POLICY_FILE", "policy_file")
-	_, err := downloadFile(b, e, "POLICY_URL", "policy_file")
+	_, err = downloadFile(b, e, "POLICY_URL", "policy_file")
 	checkErr(err, "downloading file from URL")
 }
 
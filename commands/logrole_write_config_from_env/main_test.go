@@ -103,3 +103,24 @@ func TestValidateUnknownURL(t *testing.T) {
 		t.Errorf("Wrong error: %v", err)
 	}
 }
+
+func TestWriteAccounts(t *testing.T) {
+	t.Parallel()
+	e := &dummyEnvironment{
+		env: map[string]string{"TWILIO_ACCOUNTS": "main:AC123:token, sub:AC456:token2"},
+	}
+	buf := new(bytes.Buffer)
+	writeConfig(buf, e)
+	expected := `accounts:
+  - name: main
+    twilio_account_sid: AC123
+    twilio_auth_token: token
+  - name: sub
+    twilio_account_sid: AC456
+    twilio_auth_token: token2
+
+`
+	if s := buf.String(); s != expected {
+		t.Errorf("expected config to be %s, got %s", expected, s)
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	twilio "github.com/saintpete/twilio-go"
+)
+
+// DefaultAccountName is the name of the account configured with
+// twilio_account_sid and twilio_auth_token, if no accounts are listed.
+const DefaultAccountName = "default"
+
+// AccountConfig is a Twilio account or subaccount in a FileConfig.
+type AccountConfig struct {
+	// Shown in the account switcher, and used in URLs, for example
+	// /accounts/<name>/messages.
+	Name       string `yaml:"name"`
+	AccountSid string `yaml:"twilio_account_sid"`
+	AuthToken  string `yaml:"twilio_auth_token"`
+}
+
+// An Account is a Twilio account or subaccount that users can browse.
+type Account struct {
+	Name   string
+	Client *twilio.Client
+}
+
+var accountName = regexp.MustCompile(`^[-_a-zA-Z0-9]+$`)
+
+var accountsAndSid = errors.New("Cannot define both twilio_account_sid and accounts. Move the account into the list of accounts")
+
+// newAccounts creates an Account for each of the accounts in c, or a single
+// account named DefaultAccountName if c doesn't list any.
+func newAccounts(c *FileConfig) ([]*Account, error) {
+	if len(c.Accounts) == 0 {
+		return []*Account{{
+			Name:   DefaultAccountName,
+			Client: twilio.NewClient(c.AccountSid, c.AuthToken, nil),
+		}}, nil
+	}
+	if c.AccountSid != "" || c.AuthToken != "" {
+		return nil, accountsAndSid
+	}
+	names := make(map[string]bool)
+	accounts := make([]*Account, len(c.Accounts))
+	for i, ac := range c.Accounts {
+		if !accountName.MatchString(ac.Name) {
+			return nil, fmt.Errorf("Invalid account name %q: use only letters, numbers, dashes and underscores", ac.Name)
+		}
+		if names[ac.Name] {
+			return nil, fmt.Errorf("Account name %s appears twice in the list", ac.Name)
+		}
+		names[ac.Name] = true
+		if ac.AccountSid == "" || ac.AuthToken == "" {
+			return nil, fmt.Errorf("Account %s needs a twilio_account_sid and a twilio_auth_token", ac.Name)
+		}
+		accounts[i] = &Account{
+			Name:   ac.Name,
+			Client: twilio.NewClient(ac.AccountSid, ac.AuthToken, nil),
+		}
+	}
+	return accounts, nil
+}
+
+// validatePolicyAccounts checks that every account named in the policy is
+// one of accounts.
+func validatePolicyAccounts(p *Policy, accounts []*Account) error {
+	if p == nil {
+		return nil
+	}
+	names := make(map[string]bool, len(accounts))
+	for _, a := range accounts {
+		names[a.Name] = true
+	}
+	for _, group := range *p {
+		for _, name := range group.Accounts {
+			if !names[name] {
+				return fmt.Errorf("Group %s can view account %s, but no account has that name", group.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// CanViewAccount returns true if the user's group can browse the account
+// with the given name.
+func (u *User) CanViewAccount(name string) bool {
+	if u.accounts == nil {
+		return true
+	}
+	return u.accounts[name]
+}
+
+// newAccountSet returns the set of accounts a group can browse, or nil if
+// the group can browse every account.
+func newAccountSet(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[name] = true
+	}
+	return m
+}
@@ -0,0 +1,64 @@
+package config
+
+import "testing"
+
+func TestNewAccounts(t *testing.T) {
+	t.Parallel()
+	accounts, err := newAccounts(&FileConfig{AccountSid: "AC123", AuthToken: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Name != DefaultAccountName || accounts[0].Client.AccountSid != "AC123" {
+		t.Errorf("expected a single default account, got %#v", accounts)
+	}
+	accounts, err = newAccounts(&FileConfig{Accounts: []*AccountConfig{
+		{Name: "main", AccountSid: "AC123", AuthToken: "token"},
+		{Name: "sub", AccountSid: "AC456", AuthToken: "token"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[1].Name != "sub" || accounts[1].Client.AccountSid != "AC456" {
+		t.Errorf("expected two accounts, got %#v", accounts)
+	}
+	for _, c := range []*FileConfig{
+		{AccountSid: "AC123", Accounts: []*AccountConfig{{Name: "main", AccountSid: "AC123", AuthToken: "token"}}},
+		{Accounts: []*AccountConfig{{Name: "main/sub", AccountSid: "AC123", AuthToken: "token"}}},
+		{Accounts: []*AccountConfig{{Name: "main", AccountSid: "AC123"}}},
+		{Accounts: []*AccountConfig{
+			{Name: "main", AccountSid: "AC123", AuthToken: "token"},
+			{Name: "main", AccountSid: "AC456", AuthToken: "token"},
+		}},
+	} {
+		if _, err := newAccounts(c); err == nil {
+			t.Errorf("expected an error for accounts %#v, got nil", c.Accounts)
+		}
+	}
+}
+
+func TestPolicyAccounts(t *testing.T) {
+	t.Parallel()
+	p := &Policy{&Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: AllUserSettings(),
+		Accounts:    []string{"sub"},
+	}}
+	accounts := []*Account{{Name: "main"}, {Name: "sub"}}
+	if err := validatePolicyAccounts(p, accounts); err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePolicyAccounts(p, accounts[:1]); err == nil {
+		t.Error("expected an error for an unknown account, got nil")
+	}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.CanViewAccount("main") || !u.CanViewAccount("sub") {
+		t.Error("expected user to only view the sub account")
+	}
+	if !DefaultUser.CanViewAccount("main") {
+		t.Error("expected a user with no account list to view every account")
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/apitoken"
+)
+
+// TokenAuthenticator accepts personal API tokens in an "Authorization: Bearer"
+// header, and passes every other request to the wrapped Authenticator. A token
+// gets the permissions of the user who created it.
+//
+// If a policy is set, a token only works while its owner is listed by name in
+// one of the policy's groups. We can't ask the identity provider whether the
+// owner still has a group claim, and a token that fell back to the default
+// group would keep working for someone who has been removed from the policy.
+type TokenAuthenticator struct {
+	Authenticator
+	Store  apitoken.Store
+	mu     sync.Mutex
+	policy *Policy
+}
+
+// NewTokenAuthenticator wraps a, so requests can also authenticate with a
+// token from store.
+func NewTokenAuthenticator(a Authenticator, store apitoken.Store) *TokenAuthenticator {
+	return &TokenAuthenticator{Authenticator: a, Store: store}
+}
+
+// SetPolicy sets the policy for t and for the wrapped Authenticator.
+func (t *TokenAuthenticator) SetPolicy(p *Policy) {
+	t.mu.Lock()
+	t.policy = p
+	t.mu.Unlock()
+	t.Authenticator.SetPolicy(p)
+}
+
+func (t *TokenAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return t.Authenticator.Authenticate(w, r)
+	}
+	tok, err := t.Store.Lookup(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	if err != nil {
+		rerr := &rest.Error{
+			Title: "Invalid API token",
+			ID:    "invalid_token",
+		}
+		if err != apitoken.ErrNotFound {
+			rest.ServerError(w, r, err)
+			return nil, err
+		}
+		rest.Forbidden(w, r, rerr)
+		return nil, rerr
+	}
+	t.mu.Lock()
+	policy := t.policy
+	t.mu.Unlock()
+	var u *User
+	if policy == nil {
+		u = DefaultUser.withID(tok.Owner)
+	} else {
+		var found bool
+		u, found, err = policy.Lookup(tok.Owner)
+		if err != nil || !found {
+			// The owner was removed from the policy after they created the
+			// token, or was never listed by name.
+			rerr := &rest.Error{Title: "API token owner not found", ID: "forbidden"}
+			rest.Forbidden(w, r, rerr)
+			return nil, rerr
+		}
+	}
+	u.apiToken = true
+	return u, nil
+}
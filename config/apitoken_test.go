@@ -0,0 +1,101 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saintpete/logrole/apitoken"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-apitoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := apitoken.NewFileStore(filepath.Join(dir, "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	support := defaultUserSettings()
+	support.CanViewCalls = false
+	b := NewBasicAuthAuthenticator("logrole")
+	b.AddUserPassword("test@example.com", "password")
+	a := NewTokenAuthenticator(b, store)
+	a.SetPolicy(&Policy{&Group{Name: "support", Users: []string{"test@example.com"}, Permissions: support}})
+	_, secret, err := store.Create("test@example.com", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/calls", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	u, err := a.Authenticate(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID() != "test@example.com" || u.CanViewCalls() || !u.FromAPIToken() {
+		t.Errorf("expected token to get its owner's permissions, got %#v", u)
+	}
+
+	req, _ = http.NewRequest("GET", "/calls", nil)
+	req.Header.Set("Authorization", "Bearer "+secret+"x")
+	w := httptest.NewRecorder()
+	if _, err := a.Authenticate(w, req); err == nil {
+		t.Fatal("expected invalid token to return an error, got nil")
+	}
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+
+	// Requests without a token go to the wrapped Authenticator.
+	req, _ = http.NewRequest("GET", "/calls", nil)
+	req.SetBasicAuth("test@example.com", "password")
+	u, err = a.Authenticate(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.FromAPIToken() {
+		t.Error("expected Basic Auth user not to be marked as using a token")
+	}
+}
+
+func TestTokenRequiresOwnerListedByName(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-apitoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := apitoken.NewFileStore(filepath.Join(dir, "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewTokenAuthenticator(NewBasicAuthAuthenticator("logrole"), store)
+	a.SetPolicy(&Policy{
+		&Group{Name: "support", Default: true, Permissions: defaultUserSettings()},
+		&Group{Name: "eng", Permissions: AllUserSettings(), Claims: []string{"eng"}},
+	})
+	// Neither owner is listed by name: one logged in with a group claim, the
+	// other got the default group.
+	for _, owner := range []string{"eng@example.com", "removed@example.com"} {
+		_, secret, err := store.Create(owner, "script")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", "/calls", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		if _, err := a.Authenticate(w, req); err == nil {
+			t.Errorf("%s: expected token to be rejected, got nil error", owner)
+		}
+		if w.Code != 403 {
+			t.Errorf("%s: expected Code to be 403, got %d", owner, w.Code)
+		}
+	}
+}
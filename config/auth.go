@@ -129,7 +129,7 @@ func (b *BasicAuthAuthenticator) Authenticate(w http.ResponseWriter, r *http.Req
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	if b.Policy == nil {
-		return DefaultUser, nil
+		return DefaultUser.withID(user), nil
 	} else {
 		u, _, err := b.Policy.Lookup(user)
 		if err != nil {
@@ -187,11 +187,18 @@ type state struct {
 	Time       time.Time
 }
 
+// An OAuthAuthenticator sends users to a third party to log in.
 type OAuthAuthenticator interface {
+	// URL returns the URL to send the user to, to log in.
 	URL(http.ResponseWriter, *http.Request) string
+	// Provider returns the name of the third party, for the login button.
+	Provider() string
 }
 
-func (g *GoogleAuthenticator) URL(w http.ResponseWriter, r *http.Request) string {
+// newState returns an encrypted OAuth state value that records the page the
+// user was trying to visit. If that fails, it writes an error to w and
+// returns the empty string.
+func newState(w http.ResponseWriter, r *http.Request, secretKey *[32]byte) string {
 	var uri string
 	if g := r.URL.Query().Get("g"); g != "" {
 		// prevent open redirect by only using the Path part
@@ -213,14 +220,28 @@ func (g *GoogleAuthenticator) URL(w http.ResponseWriter, r *http.Request) string
 		rest.ServerError(w, r, err)
 		return ""
 	}
-	encoded := services.OpaqueByte(bits, g.secretKey)
+	return services.OpaqueByte(bits, secretKey)
+}
+
+func (g *GoogleAuthenticator) URL(w http.ResponseWriter, r *http.Request) string {
+	encoded := newState(w, r, g.secretKey)
+	if encoded == "" {
+		return ""
+	}
 	return g.Conf.AuthCodeURL(encoded)
 }
 
+// Provider returns "Google".
+func (g *GoogleAuthenticator) Provider() string {
+	return "Google"
+}
+
 const AuthTimeout = 1 * time.Hour
 
-func (g *GoogleAuthenticator) validState(encrypted string) (string, bool) {
-	b, err := services.UnopaqueByte(encrypted, g.secretKey)
+// validState decrypts a state value created by newState, and returns the
+// page the user was trying to visit.
+func validState(encrypted string, secretKey *[32]byte) (string, bool) {
+	b, err := services.UnopaqueByte(encrypted, secretKey)
 	if err != nil {
 		return "", false
 	}
@@ -239,36 +260,69 @@ const GoogleTimeout = 5 * time.Second
 type token struct {
 	ID     string
 	Expiry time.Time
+	// Group claims from the identity provider that grant membership in a
+	// policy group.
+	Claims []string `json:",omitempty"`
 }
 
-func newToken(id string) *token {
+func newToken(id string, claims []string) *token {
 	return &token{
 		ID:     id,
 		Expiry: time.Now().UTC().Add(14 * 24 * time.Hour),
+		Claims: claims,
 	}
 }
 
-func (g *GoogleAuthenticator) newCookie(id string) *http.Cookie {
-	t := newToken(id)
+// newCookie returns an encrypted "token" cookie for the user with the given
+// id and group claims.
+func newCookie(id string, claims []string, secretKey *[32]byte, allowUnencryptedTraffic bool) *http.Cookie {
+	t := newToken(id, claims)
 	b, err := json.Marshal(t)
 	if err != nil {
 		panic(err)
 	}
-	text := services.OpaqueByte(b, g.secretKey)
+	text := services.OpaqueByte(b, secretKey)
 	return &http.Cookie{
 		Name:     "token",
 		Value:    text,
 		Path:     "/",
-		Secure:   g.AllowUnencryptedTraffic == false,
+		Secure:   allowUnencryptedTraffic == false,
 		Expires:  t.Expiry,
 		HttpOnly: true,
 	}
 }
 
+// tokenFromCookie returns the token in the request's "token" cookie, or
+// MustLogin if the cookie is missing, invalid or expired.
+func tokenFromCookie(r *http.Request, secretKey *[32]byte) (*token, error) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		return nil, MustLogin
+	}
+	val, err := services.UnopaqueByte(cookie.Value, secretKey)
+	if err != nil {
+		// need a 400 bad request here
+		return nil, MustLogin
+	}
+	t := new(token)
+	if err := json.Unmarshal(val, t); err != nil {
+		return nil, MustLogin
+	}
+	if t.Expiry.Before(time.Now().UTC()) {
+		// TODO logout
+		return nil, MustLogin
+	}
+	return t, nil
+}
+
+func (g *GoogleAuthenticator) newCookie(id string) *http.Cookie {
+	return newCookie(id, nil, g.secretKey, g.AllowUnencryptedTraffic)
+}
+
 func (g *GoogleAuthenticator) handleGoogleCallback(w http.ResponseWriter, r *http.Request) error {
 	query := r.URL.Query()
 	st := query.Get("state")
-	currentURL, ok := g.validState(st)
+	currentURL, ok := validState(st, g.secretKey)
 	if !ok {
 		http.Redirect(w, r, "/", 302)
 		return errors.New("invalid state")
@@ -339,22 +393,9 @@ func (g *GoogleAuthenticator) Authenticate(w http.ResponseWriter, r *http.Reques
 		return nil, err
 	}
 	// Check if the request has a valid cookie, if so allow it.
-	cookie, err := r.Cookie("token")
+	t, err := tokenFromCookie(r, g.secretKey)
 	if err != nil {
-		return nil, MustLogin
-	}
-	val, err := services.UnopaqueByte(cookie.Value, g.secretKey)
-	if err != nil {
-		// need a 400 bad request here
-		return nil, MustLogin
-	}
-	t := new(token)
-	if err := json.Unmarshal(val, t); err != nil {
-		return nil, MustLogin
-	}
-	if t.Expiry.Before(time.Now().UTC()) {
-		// TODO logout
-		return nil, MustLogin
+		return nil, err
 	}
 	// if you got to this point you have a valid login cookie, don't show you
 	// the login page.
@@ -373,18 +414,22 @@ func (g *GoogleAuthenticator) Authenticate(w http.ResponseWriter, r *http.Reques
 }
 
 func (g *GoogleAuthenticator) lookupUser(id string) (*User, error) {
-	if g.policy == nil {
+	// The policy can be swapped out while we're running, see PolicyReloader.
+	g.mu.Lock()
+	policy := g.policy
+	g.mu.Unlock()
+	if policy == nil {
 		// no policy, only check whether domain is permitted and return
 		// DefaultUser
 		if err := g.permitted(id); err == nil {
-			return DefaultUser, nil
+			return DefaultUser.withID(id), nil
 		} else {
 			g.Warn("User has valid login but does not have a permitted domain", "id", id)
 			return nil, MustLogin
 		}
 	}
 
-	u, ok, err := g.policy.Lookup(id)
+	u, ok, err := policy.Lookup(id)
 	if ok {
 		return u, nil
 	}
@@ -399,7 +444,7 @@ func (g *GoogleAuthenticator) lookupUser(id string) (*User, error) {
 		return u, nil
 	case err != nil:
 		// No default user, but this user has a valid domain
-		return DefaultUser, nil
+		return DefaultUser.withID(id), nil
 	default:
 		panic("unreachable")
 	}
@@ -412,9 +457,14 @@ func (g *GoogleAuthenticator) SetPolicy(p *Policy) {
 }
 
 func (g *GoogleAuthenticator) Logout(w http.ResponseWriter, r *http.Request) {
+	logout(w, r, g.AllowUnencryptedTraffic)
+}
+
+// logout removes the "token" cookie and redirects to the homepage.
+func logout(w http.ResponseWriter, r *http.Request, allowUnencryptedTraffic bool) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "token",
-		Secure:   g.AllowUnencryptedTraffic == false,
+		Secure:   allowUnencryptedTraffic == false,
 		HttpOnly: true,
 		MaxAge:   -1,
 		Path:     "/",
@@ -3,6 +3,7 @@ package config
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	log "github.com/inconshreveable/log15"
@@ -43,11 +44,17 @@ func TestUnknownUserWithValidDomainAllowed(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if u != DefaultUser {
+	if !isDefaultUser(u, "user@example.com") {
 		t.Errorf("expected to get DefaultUser, got %v", u)
 	}
 }
 
+// isDefaultUser reports whether u has DefaultUser's permissions and the given
+// identity.
+func isDefaultUser(u *User, id string) bool {
+	return u != nil && reflect.DeepEqual(u, DefaultUser.withID(id))
+}
+
 var authTests = []struct {
 	policy      *Policy
 	domains     []string
@@ -97,8 +104,11 @@ func TestGoogleAuth(t *testing.T) {
 				}
 			}
 		}
-		if tt.defaultUser && user != DefaultUser {
+		if tt.defaultUser && !isDefaultUser(user, tt.id) {
 			t.Errorf("expected to get DefaultUser, didn't")
 		}
+		if tt.err == "" && user != nil && user.ID() != tt.id {
+			t.Errorf("expected user ID to be %s, got %s", tt.id, user.ID())
+		}
 	}
 }
@@ -0,0 +1,425 @@
+package config
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// DefaultOIDCUserIDClaim is the ID token claim we use to identify users, if
+// none is configured.
+const DefaultOIDCUserIDClaim = "email"
+
+// DefaultOIDCGroupsClaim is the ID token claim we match against policy group
+// claims, if none is configured.
+const DefaultOIDCGroupsClaim = "groups"
+
+const OIDCTimeout = 5 * time.Second
+
+// Don't refetch the issuer's signing keys more often than this, even if we
+// see a key ID we don't know about.
+const jwksRefreshInterval = 1 * time.Minute
+
+// Allow for a little clock skew between us and the issuer when checking
+// whether an ID token has expired.
+const clockSkew = 1 * time.Minute
+
+// OIDCAuthenticator can authenticate requests with any OpenID Connect
+// provider, like Okta or Keycloak. Users are redirected to the provider to
+// log in, and the claim in their ID token named by UserIDClaim is looked up
+// in the Policy.
+type OIDCAuthenticator struct {
+	log.Logger
+	AllowUnencryptedTraffic bool
+	Conf                    *oauth2.Config
+	// The issuer URL, for example "https://example.okta.com".
+	Issuer string
+	// The ID token claim that identifies a user, for example "email" or
+	// "preferred_username".
+	UserIDClaim string
+	// The ID token claim that lists the user's groups or roles. Values in
+	// this claim are matched against each policy group's Claims.
+	GroupsClaim string
+	// The name of the provider, shown on the login button.
+	ProviderName string
+	client       *http.Client
+	jwksURI      string
+	secretKey    *[32]byte
+	policy       *Policy
+	mu           sync.Mutex
+
+	keysMu      sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// discovery is the subset of the OpenID Provider Metadata that we use.
+// http://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCAuthenticator creates a new OIDCAuthenticator for the given issuer.
+// The issuer's endpoints are loaded from
+// <issuer>/.well-known/openid-configuration, so this makes a HTTP request.
+func NewOIDCAuthenticator(ctx context.Context, logger log.Logger, issuer string, clientID string, clientSecret string, baseURL string, userIDClaim string, secretKey *[32]byte) (*OIDCAuthenticator, error) {
+	if userIDClaim == "" {
+		userIDClaim = DefaultOIDCUserIDClaim
+	}
+	client := &http.Client{Timeout: OIDCTimeout}
+	d := new(discovery)
+	if err := getJSON(ctx, client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", d); err != nil {
+		return nil, fmt.Errorf("Couldn't load OpenID configuration: %v", err)
+	}
+	// http://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if d.Issuer != issuer {
+		return nil, fmt.Errorf("OpenID configuration has issuer %q, expected %q", d.Issuer, issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("OpenID configuration is missing an authorization, token or JWKS endpoint")
+	}
+	conf := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  baseURL + "/auth/callback",
+		Scopes:       []string{"openid", "profile", "email"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}
+	return &OIDCAuthenticator{
+		Logger:       logger,
+		Conf:         conf,
+		Issuer:       issuer,
+		UserIDClaim:  userIDClaim,
+		GroupsClaim:  DefaultOIDCGroupsClaim,
+		ProviderName: "Single Sign-On",
+		client:       client,
+		jwksURI:      d.JWKSURI,
+		secretKey:    secretKey,
+	}, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (o *OIDCAuthenticator) URL(w http.ResponseWriter, r *http.Request) string {
+	encoded := newState(w, r, o.secretKey)
+	if encoded == "" {
+		return ""
+	}
+	return o.Conf.AuthCodeURL(encoded)
+}
+
+func (o *OIDCAuthenticator) Provider() string {
+	return o.ProviderName
+}
+
+func (o *OIDCAuthenticator) SetPolicy(p *Policy) {
+	o.mu.Lock()
+	o.policy = p
+	o.mu.Unlock()
+}
+
+func (o *OIDCAuthenticator) Logout(w http.ResponseWriter, r *http.Request) {
+	logout(w, r, o.AllowUnencryptedTraffic)
+}
+
+func (o *OIDCAuthenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
+	if r.URL.Path == "/auth/callback" {
+		err := o.handleCallback(w, r)
+		return nil, err
+	}
+	t, err := tokenFromCookie(r, o.secretKey)
+	if err != nil {
+		return nil, err
+	}
+	// if you got to this point you have a valid login cookie, don't show you
+	// the login page.
+	if r.URL.Path == "/login" {
+		http.Redirect(w, r, "/", 302)
+		return nil, errors.New("redirected logged in user to homepage")
+	}
+	u, err := o.lookupUser(t.ID, t.Claims)
+	if err != nil {
+		o.Logout(w, r)
+		return nil, err
+	}
+	return u, nil
+}
+
+func (o *OIDCAuthenticator) getPolicy() *Policy {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.policy
+}
+
+// lookupUser finds the user with the given id and group claims in the policy.
+// If there's no policy, every user that can log in to the provider gets
+// DefaultUser's permissions.
+func (o *OIDCAuthenticator) lookupUser(id string, claims []string) (*User, error) {
+	policy := o.getPolicy()
+	if policy == nil {
+		return DefaultUser.withID(id), nil
+	}
+	u, _, err := policy.Lookup(id, claims...)
+	if err != nil {
+		o.Warn("User not found by ID in policy, and no default group", "id", id)
+		return nil, MustLogin
+	}
+	return u, nil
+}
+
+func (o *OIDCAuthenticator) handleCallback(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	currentURL, ok := validState(query.Get("state"), o.secretKey)
+	if !ok {
+		http.Redirect(w, r, "/", 302)
+		return errors.New("invalid state")
+	}
+	code := query.Get("code")
+	if code == "" {
+		o.Warn("Callback request has valid state, no code", "error", query.Get("error"))
+		http.Redirect(w, r, "/", 302)
+		return errors.New("invalid state")
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), OIDCTimeout)
+	defer cancel()
+	tok, err := o.Conf.Exchange(ctx, code)
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return err
+	}
+	rawIDToken, ok := tok.Extra("id_token").(string)
+	if !ok {
+		err := errors.New("Token response did not include an ID token")
+		rest.ServerError(w, r, err)
+		return err
+	}
+	claims, err := o.verify(ctx, rawIDToken)
+	if err != nil {
+		o.Warn("Invalid ID token", "err", err)
+		rest.Forbidden(w, r, &rest.Error{Title: "Invalid ID token: " + err.Error()})
+		return err
+	}
+	id, ok := claims[o.UserIDClaim].(string)
+	if !ok || id == "" {
+		err := fmt.Errorf("ID token does not have a %q claim", o.UserIDClaim)
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return err
+	}
+	// Some providers let users pick any email address without proving they
+	// own it, so an unverified email can't identify a user.
+	if o.UserIDClaim == "email" && !emailVerified(claims["email_verified"]) {
+		o.Warn("ID token email is not verified", "email", id)
+		err := errors.New("Your email address has not been verified")
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return err
+	}
+	// Only keep the claims the policy cares about; the cookie has to stay
+	// under 4KB, and some providers send dozens of groups.
+	groups := o.getPolicy().Claims(stringsClaim(claims[o.GroupsClaim]))
+	if _, err := o.lookupUser(id, groups); err != nil {
+		rest.Forbidden(w, r, &rest.Error{
+			Title: "User " + id + " is not authorized to access this site",
+			ID:    "unauthorized_user",
+		})
+		return err
+	}
+	http.SetCookie(w, newCookie(id, groups, o.secretKey, o.AllowUnencryptedTraffic))
+	http.Redirect(w, r, currentURL, 302)
+	return errors.New("redirected, make another request")
+}
+
+// emailVerified reports whether the email_verified claim is true. Some
+// providers send it as a string.
+func emailVerified(claim interface{}) bool {
+	switch v := claim.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verify checks the signature, issuer, audience and expiry of the ID token,
+// and returns its claims. Only RS256 signatures are supported; it's the one
+// algorithm every provider is required to support.
+func (o *OIDCAuthenticator) verify(ctx context.Context, rawIDToken string) (map[string]interface{}, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	header := new(jwtHeader)
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %v", err)
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return nil, errors.New("invalid token signature")
+	}
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != o.Issuer {
+		return nil, fmt.Errorf("token has issuer %q, expected %q", iss, o.Issuer)
+	}
+	if !hasAudience(claims["aud"], o.Conf.ClientID) {
+		return nil, errors.New("token was not issued for this client")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if time.Unix(int64(exp), 0).Add(clockSkew).Before(time.Now()) {
+		return nil, errors.New("token has expired")
+	}
+	return claims, nil
+}
+
+// hasAudience reports whether aud, which is either a string or a list of
+// strings, contains clientID.
+func hasAudience(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stringsClaim returns the values of a claim that's either a string or a list
+// of strings.
+func stringsClaim(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, val := range v {
+			if s, ok := val.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// key returns the issuer's signing key with the given ID. Providers rotate
+// their keys, so if we don't know about the key we fetch the list again.
+func (o *OIDCAuthenticator) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	o.keysMu.Lock()
+	defer o.keysMu.Unlock()
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(o.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	set := new(jwks)
+	if err := getJSON(ctx, o.client, o.jwksURI, set); err != nil {
+		return nil, fmt.Errorf("couldn't load signing keys: %v", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	o.keys = keys
+	o.keysFetched = time.Now()
+	key, ok := o.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
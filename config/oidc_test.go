@@ -0,0 +1,262 @@
+package config
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saintpete/logrole/services"
+	"golang.org/x/net/context"
+)
+
+// fakeIssuer is a minimal OpenID Connect provider. Every authorization code
+// is exchanged for an ID token with the given claims.
+type fakeIssuer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	claims map[string]interface{}
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIssuer{key: key, kid: "test-key"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(f.key.PublicKey.E)).Bytes()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": f.kid,
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(f.key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(e),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     f.sign(t, f.key, f.claims),
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeIssuer) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": f.kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hashed := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (f *fakeIssuer) validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                f.URL,
+		"aud":                "client-id",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"email":              "test@example.com",
+		"email_verified":     true,
+		"preferred_username": "test",
+	}
+}
+
+func newTestOIDCAuthenticator(t *testing.T, f *fakeIssuer, claim string) *OIDCAuthenticator {
+	a, err := NewOIDCAuthenticator(context.Background(), NullLogger, f.URL, "client-id", "secret", "http://localhost", claim, services.NewRandomKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.AllowUnencryptedTraffic = true
+	return a
+}
+
+// login runs through the callback, and returns the response.
+func login(t *testing.T, a *OIDCAuthenticator) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/login?g=/messages", nil)
+	u, err := url.Parse(a.URL(httptest.NewRecorder(), req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(u.Path, "/authorize") {
+		t.Fatalf("expected to redirect to the authorization endpoint, got %s", u.String())
+	}
+	st := u.Query().Get("state")
+	req, _ = http.NewRequest("GET", "/auth/callback?code=abc&state="+url.QueryEscape(st), nil)
+	w := httptest.NewRecorder()
+	if _, err := a.Authenticate(w, req); err == nil {
+		t.Fatal("expected callback to return an error, got nil")
+	}
+	return w
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+	f := newFakeIssuer(t)
+	defer f.Close()
+	f.claims = f.validClaims()
+	a := newTestOIDCAuthenticator(t, f, "preferred_username")
+	a.SetPolicy(&Policy{&Group{Name: "support", Users: []string{"test"}, Permissions: defaultUserSettings()}})
+	w := login(t, a)
+	if w.Code != 302 {
+		t.Fatalf("expected Code to be 302, got %d: %s", w.Code, w.Body.String())
+	}
+	if loc := w.Header().Get("Location"); loc != "/messages" {
+		t.Errorf("expected redirect to /messages, got %s", loc)
+	}
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "token" {
+		t.Fatalf("expected a token cookie, got %v", cookies)
+	}
+	req, _ := http.NewRequest("GET", "/messages", nil)
+	req.AddCookie(cookies[0])
+	u, err := a.Authenticate(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID() != "test" {
+		t.Errorf("expected user ID to be test, got %s", u.ID())
+	}
+	if u.IsAdmin() {
+		t.Error("expected user to get the support group's permissions")
+	}
+}
+
+func TestOIDCGroupsClaim(t *testing.T) {
+	t.Parallel()
+	f := newFakeIssuer(t)
+	defer f.Close()
+	f.claims = f.validClaims()
+	f.claims["groups"] = []string{"everyone", "eng"}
+	a := newTestOIDCAuthenticator(t, f, "")
+	eng := AllUserSettings()
+	eng.IsAdmin = true
+	a.SetPolicy(&Policy{&Group{Name: "eng", Permissions: eng, Claims: []string{"eng"}}})
+	w := login(t, a)
+	if w.Code != 302 {
+		t.Fatalf("expected Code to be 302, got %d: %s", w.Code, w.Body.String())
+	}
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a token cookie, got %v", cookies)
+	}
+	tok, err := tokenFromCookie(&http.Request{Header: http.Header{"Cookie": []string{cookies[0].String()}}}, a.secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tok.Claims) != 1 || tok.Claims[0] != "eng" {
+		t.Errorf("expected cookie to store only the claims in the policy, got %v", tok.Claims)
+	}
+	req, _ := http.NewRequest("GET", "/messages", nil)
+	req.AddCookie(cookies[0])
+	u, err := a.Authenticate(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.IsAdmin() || u.ID() != "test@example.com" {
+		t.Errorf("expected groups claim to grant membership in eng, got %#v", u)
+	}
+}
+
+func TestOIDCUnknownUserForbidden(t *testing.T) {
+	t.Parallel()
+	f := newFakeIssuer(t)
+	defer f.Close()
+	f.claims = f.validClaims()
+	a := newTestOIDCAuthenticator(t, f, "")
+	a.SetPolicy(&Policy{&Group{Name: "support", Users: []string{"other@example.com"}}})
+	if w := login(t, a); w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
+
+func TestOIDCInvalidTokens(t *testing.T) {
+	t.Parallel()
+	f := newFakeIssuer(t)
+	defer f.Close()
+	a := newTestOIDCAuthenticator(t, f, "")
+	wrongAudience := f.validClaims()
+	wrongAudience["aud"] = "another-client"
+	expired := f.validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongIssuer := f.validClaims()
+	wrongIssuer["iss"] = "https://evil.example.com"
+	noEmail := f.validClaims()
+	delete(noEmail, "email")
+	unverified := f.validClaims()
+	unverified["email_verified"] = false
+	noVerified := f.validClaims()
+	delete(noVerified, "email_verified")
+	for _, claims := range []map[string]interface{}{wrongAudience, expired, wrongIssuer, noEmail, unverified, noVerified} {
+		f.claims = claims
+		if w := login(t, a); w.Code != 403 {
+			t.Errorf("claims %v: expected Code to be 403, got %d", claims, w.Code)
+		}
+	}
+
+	// Signed with a key the issuer doesn't publish.
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := f.sign(t, otherKey, f.validClaims())
+	if _, err := a.verify(context.Background(), raw); err == nil {
+		t.Error("expected token signed by another key to be invalid, got nil error")
+	}
+}
+
+func TestOIDCUnverifiedEmailWithOtherClaim(t *testing.T) {
+	t.Parallel()
+	f := newFakeIssuer(t)
+	defer f.Close()
+	f.claims = f.validClaims()
+	f.claims["email_verified"] = false
+	// email_verified only matters if we identify users by their email.
+	a := newTestOIDCAuthenticator(t, f, "preferred_username")
+	a.SetPolicy(&Policy{&Group{Name: "support", Users: []string{"test"}, Permissions: defaultUserSettings()}})
+	if w := login(t, a); w.Code != 302 {
+		t.Errorf("expected Code to be 302, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	t.Parallel()
+	f := newFakeIssuer(t)
+	defer f.Close()
+	_, err := NewOIDCAuthenticator(context.Background(), NullLogger, f.URL+"/other", "client-id", "secret", "http://localhost", "", services.NewRandomKey())
+	if err == nil {
+		t.Error("expected error loading configuration for the wrong issuer, got nil")
+	}
+}
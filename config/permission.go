@@ -6,6 +6,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -14,6 +15,21 @@ type Group struct {
 	Name        string        `yaml:"name"`
 	Default     bool          `yaml:"default,omitempty"`
 	Users       []string      `yaml:"users"`
+	// Users whose identity provider puts any of these values in their group
+	// claim are members of the group, for example "support" or
+	// "logrole-admins".
+	Claims []string `yaml:"claims,omitempty"`
+	// Rules that hide parts of message bodies, callback URLs and alert
+	// details from users in the group.
+	Redactions []*Redaction `yaml:"redactions,omitempty"`
+	// If set, users in the group can only view messages and calls to or from
+	// these phone numbers, and only these numbers on the phone numbers page.
+	// Each entry is a phone number, or the Sid of one of your Twilio phone
+	// numbers (PN123...).
+	PhoneNumbers []string `yaml:"phone_numbers,omitempty"`
+	// If set, users in the group can only browse the Twilio accounts with
+	// these names.
+	Accounts []string `yaml:"accounts,omitempty"`
 }
 
 type PolicyPolicy struct {
@@ -27,7 +43,7 @@ type yamlPolicy Policy
 
 // Unmarshal a YAML file into a Policy. Need a custom Unmarshaler so we can
 // detect a nil UserSettings object and replace it with one where all
-// permissions are set to true.
+// permissions (except admin access) are set to true.
 func (p *Policy) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if p == nil {
 		p = new(Policy)
@@ -45,7 +61,7 @@ func (p *Policy) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 	for _, group := range yp {
 		if group.Permissions == nil {
-			group.Permissions = AllUserSettings()
+			group.Permissions = defaultUserSettings()
 		}
 	}
 	*p = Policy(yp)
@@ -53,32 +69,80 @@ func (p *Policy) UnmarshalYAML(unmarshal func(interface{}) error) error {
 }
 
 // Lookup finds the User with the given id. If no user with that name is found,
-// but a default group is defined, a user from that group is returned. The
-// boolean is true if a user was found directly by id. Otherwise returns an
-// error.
+// but one of the claims matches a group's Claims, a user from that group is
+// returned; if no claims match either, but a default group is defined, a user
+// from the default group is returned. The boolean is true if a user was found
+// by id or by claim. Otherwise returns an error.
 //
 // Lookup assumes the Policy is valid.
-func (p *Policy) Lookup(id string) (*User, bool, error) {
+func (p *Policy) Lookup(id string, claims ...string) (*User, bool, error) {
 	if p == nil {
 		return nil, false, errors.New("nil policy")
 	}
-	var defaultGroup *Group
+	var defaultGroup, claimGroup *Group
 	for _, group := range *p {
 		for _, user := range group.Users {
 			if user == id {
-				return NewUser(group.Permissions), true, nil
+				return group.newUser(id), true, nil
 			}
 		}
+		if claimGroup == nil && group.hasClaim(claims) {
+			claimGroup = group
+		}
 		if group.Default == true {
 			defaultGroup = group
 		}
 	}
+	if claimGroup != nil {
+		u := claimGroup.newUser(id)
+		u.claims = claims
+		return u, true, nil
+	}
 	if defaultGroup != nil {
-		return NewUser(defaultGroup.Permissions), false, nil
+		return defaultGroup.newUser(id), false, nil
 	}
 	return nil, false, fmt.Errorf("User %s not found in the policy, and no default configured", id)
 }
 
+// newUser returns a User with the group's permissions and redaction rules.
+func (g *Group) newUser(id string) *User {
+	u := NewUser(g.Permissions).withID(id)
+	u.redactions = g.Redactions
+	u.scope = newNumberScope(g.PhoneNumbers)
+	u.accounts = newAccountSet(g.Accounts)
+	return u
+}
+
+// hasClaim returns true if any of the claims grant membership in g.
+func (g *Group) hasClaim(claims []string) bool {
+	for _, claim := range claims {
+		for _, gc := range g.Claims {
+			if claim == gc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Claims returns the values in claims that grant membership in a group in
+// the policy. Use it to avoid storing claims we don't care about.
+func (p *Policy) Claims(claims []string) []string {
+	if p == nil {
+		return nil
+	}
+	var matched []string
+	for _, claim := range claims {
+		for _, group := range *p {
+			if group.hasClaim([]string{claim}) {
+				matched = append(matched, claim)
+				break
+			}
+		}
+	}
+	return matched
+}
+
 // Users returns a map of all Users defined in the policy. Users assumes the
 // Policy is valid.
 func (p *Policy) Users() map[string]*User {
@@ -88,7 +152,7 @@ func (p *Policy) Users() map[string]*User {
 	}
 	for _, group := range *p {
 		for _, user := range group.Users {
-			users[user] = NewUser(group.Permissions)
+			users[user] = group.newUser(user)
 		}
 	}
 	return users
@@ -96,6 +160,11 @@ func (p *Policy) Users() map[string]*User {
 
 type Permission struct {
 	maxResourceAge time.Duration
+
+	// The Sid of each of the account's phone numbers, used to check numbers
+	// against the Sids in a group's PhoneNumbers.
+	numberSids   map[string]string
+	numberSidsMu sync.RWMutex
 }
 
 func validatePolicy(p *Policy) error {
@@ -103,6 +172,7 @@ func validatePolicy(p *Policy) error {
 		return nil
 	}
 	users := make(map[string]bool)
+	claims := make(map[string]bool)
 	names := make(map[string]bool)
 	defaultCount := 0
 	for _, group := range *p {
@@ -127,6 +197,28 @@ func validatePolicy(p *Policy) error {
 			}
 			users[user] = true
 		}
+		for _, claim := range group.Claims {
+			if claim == "" {
+				return fmt.Errorf("Group %s has an empty claim", group.Name)
+			}
+			if _, ok := claims[claim]; ok {
+				return fmt.Errorf("Claim %s appears twice in the list", claim)
+			}
+			claims[claim] = true
+		}
+		for _, pn := range group.PhoneNumbers {
+			if err := validateScopeEntry(pn); err != nil {
+				return fmt.Errorf("Group %s has an invalid phone number: %v", group.Name, err)
+			}
+		}
+		for _, r := range group.Redactions {
+			if r.Pattern == "" {
+				return fmt.Errorf("Redaction %s in group %s has no pattern", r.Name, group.Name)
+			}
+			if _, err := r.compile(); err != nil {
+				return fmt.Errorf("Redaction %s in group %s has an invalid pattern: %v", r.Name, group.Name, err)
+			}
+		}
 	}
 	return nil
 }
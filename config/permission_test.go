@@ -134,6 +134,15 @@ var policyTests = []struct {
 		&Group{Name: "2", Default: false, Users: []string{"two"}},
 	},
 		err: "Group has no name, define a group name"},
+	{p: &Policy{
+		&Group{Name: "1", Users: []string{"foo"}, Claims: []string{"eng"}},
+		&Group{Name: "2", Users: []string{"two"}, Claims: []string{"eng"}},
+	},
+		err: "Claim eng appears twice in the list"},
+	{p: &Policy{
+		&Group{Name: "1", Users: []string{"foo"}, Claims: []string{""}},
+	},
+		err: "Group 1 has an empty claim"},
 	{p: &Policy{
 		&Group{Name: "1", Default: true, Users: []string{"foo"}},
 		&Group{Name: "2", Default: false, Users: []string{"two"}},
@@ -158,3 +167,84 @@ func TestValidatePolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestLookupByClaim(t *testing.T) {
+	t.Parallel()
+	support := defaultUserSettings()
+	support.CanViewCalls = false
+	eng := AllUserSettings()
+	eng.IsAdmin = true
+	p := &Policy{
+		&Group{Name: "support", Default: true, Permissions: support, Claims: []string{"support"}},
+		&Group{Name: "eng", Users: []string{"eng@example.com"}, Permissions: eng, Claims: []string{"eng", "oncall"}},
+	}
+	u, found, err := p.Lookup("new@example.com", "oncall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || !u.IsAdmin() || u.ID() != "new@example.com" {
+		t.Errorf("expected claim to grant membership in eng, got found=%t admin=%t", found, u.IsAdmin())
+	}
+	// An explicit user beats a claim for another group.
+	u, _, _ = p.Lookup("eng@example.com", "support")
+	if !u.IsAdmin() {
+		t.Error("expected eng@example.com to get the eng group's permissions")
+	}
+	u, found, _ = p.Lookup("new@example.com", "marketing")
+	if found || u.CanViewCalls() {
+		t.Error("expected unknown claims to fall back to the default group")
+	}
+	if claims := p.Claims([]string{"marketing", "oncall", "support"}); len(claims) != 2 || claims[0] != "oncall" || claims[1] != "support" {
+		t.Errorf("expected Claims to drop unknown values, got %v", claims)
+	}
+}
+
+var redactionPolicy = []byte(`
+- name: support
+  users:
+    - test@example.com
+  redactions:
+    - name: one-time passcodes
+      pattern: '\b\d{6}\b'
+    - name: callback tokens
+      pattern: '([?&]token=)[^&]+'
+      replacement: '${1}xxx'
+`)
+
+func TestRedaction(t *testing.T) {
+	t.Parallel()
+	var p Policy
+	if err := yaml.Unmarshal(redactionPolicy, &p); err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePolicy(&p); err != nil {
+		t.Fatal(err)
+	}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in       string
+		out      string
+		redacted bool
+	}{
+		{"Your code is 123456", "Your code is [redacted]", true},
+		{"https://example.com/sms?a=b&token=abc123&c=d", "https://example.com/sms?a=b&token=xxx&c=d", true},
+		{"Call me at 1234567", "Call me at 1234567", false},
+	}
+	for _, tt := range tests {
+		out, redacted := u.Redact(tt.in)
+		if out != tt.out || redacted != tt.redacted {
+			t.Errorf("Redact(%q): got (%q, %t), want (%q, %t)", tt.in, out, redacted, tt.out, tt.redacted)
+		}
+	}
+	if out, redacted := DefaultUser.Redact("Your code is 123456"); redacted || out != "Your code is 123456" {
+		t.Errorf("expected DefaultUser to have no redaction rules, got %q", out)
+	}
+
+	bad := &Policy{&Group{Name: "1", Redactions: []*Redaction{{Name: "bad", Pattern: "("}}}}
+	if err := validatePolicy(bad); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("expected invalid pattern error, got %v", err)
+	}
+}
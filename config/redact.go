@@ -0,0 +1,61 @@
+package config
+
+import (
+	"regexp"
+	"sync"
+)
+
+// DefaultRedactionReplacement replaces text that matches a Redaction with no
+// Replacement.
+const DefaultRedactionReplacement = "[redacted]"
+
+// A Redaction hides text that matches Pattern in message bodies, callback
+// URLs and alert request and response data. Matches are replaced with
+// Replacement, which can refer to submatches, like "$1".
+type Redaction struct {
+	Name        string `yaml:"name"`
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement,omitempty"`
+
+	once sync.Once
+	re   *regexp.Regexp
+	err  error
+}
+
+func (r *Redaction) compile() (*regexp.Regexp, error) {
+	r.once.Do(func() {
+		r.re, r.err = regexp.Compile(r.Pattern)
+	})
+	return r.re, r.err
+}
+
+func (r *Redaction) replacement() string {
+	if r.Replacement == "" {
+		return DefaultRedactionReplacement
+	}
+	return r.Replacement
+}
+
+// HasRedactions returns true if the user's group hides any text from them.
+func (u *User) HasRedactions() bool {
+	return u != nil && len(u.redactions) > 0
+}
+
+// Redact applies the user's redaction rules to s, and returns the result.
+// The boolean is true if any rule changed s.
+func (u *User) Redact(s string) (string, bool) {
+	if u == nil || s == "" {
+		return s, false
+	}
+	redacted := s
+	for _, r := range u.redactions {
+		re, err := r.compile()
+		if err != nil {
+			// validatePolicy should catch this; if it didn't, hide
+			// everything rather than show something we shouldn't.
+			return r.replacement(), true
+		}
+		redacted = re.ReplaceAllString(redacted, r.replacement())
+	}
+	return redacted, redacted != s
+}
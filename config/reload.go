@@ -0,0 +1,249 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultPolicyReloadInterval is how often a PolicyReloader checks the
+// policy file for changes.
+const DefaultPolicyReloadInterval = 5 * time.Second
+
+// LoadPolicyFile reads the policy in the YAML file at path, and checks that
+// it's valid.
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(Policy)
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	if err := validatePolicy(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// A PolicyReloader sets a new policy on an Authenticator whenever the policy
+// file changes, so you can add or remove users without a restart. If the new
+// file can't be parsed or isn't valid, the Authenticator keeps the old policy.
+type PolicyReloader struct {
+	log.Logger
+	Path          string
+	Authenticator Authenticator
+	// The configured Twilio accounts. A new policy can't give a group access
+	// to an account that isn't one of these.
+	Accounts []*Account
+
+	mu      sync.Mutex
+	policy  *Policy
+	modTime time.Time
+	size    int64
+}
+
+// NewPolicyReloader creates a PolicyReloader for the file at path. p is the
+// policy the Authenticator is currently using, and accounts are the
+// configured Twilio accounts.
+func NewPolicyReloader(l log.Logger, path string, a Authenticator, p *Policy, accounts []*Account) *PolicyReloader {
+	r := &PolicyReloader{
+		Logger:        l,
+		Path:          path,
+		Authenticator: a,
+		Accounts:      accounts,
+		policy:        p,
+	}
+	if fi, err := os.Stat(path); err == nil {
+		r.modTime = fi.ModTime()
+		r.size = fi.Size()
+	}
+	return r
+}
+
+// Policy returns the policy that was most recently loaded.
+func (r *PolicyReloader) Policy() *Policy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.policy
+}
+
+// Reload reads the policy file, and sets it on the Authenticator if it's
+// valid. It returns an error, and keeps the old policy, if it isn't.
+func (r *PolicyReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fi, err := os.Stat(r.Path); err == nil {
+		r.modTime = fi.ModTime()
+		r.size = fi.Size()
+	}
+	policy, err := LoadPolicyFile(r.Path)
+	if err == nil {
+		err = validatePolicyAccounts(policy, r.Accounts)
+	}
+	if err != nil {
+		r.Error("Couldn't reload policy file, keeping the old policy", "err", err, "loc", r.Path)
+		return err
+	}
+	r.Authenticator.SetPolicy(policy)
+	d := diffPolicies(r.policy, policy)
+	r.policy = policy
+	r.Info("Reloaded policy file", append([]interface{}{"loc", r.Path}, d.logContext()...)...)
+	return nil
+}
+
+// changed reports whether the policy file was modified since we last read
+// it.
+func (r *PolicyReloader) changed() bool {
+	fi, err := os.Stat(r.Path)
+	if err != nil {
+		// Editors sometimes remove the file before writing the new one; try
+		// again next time.
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !fi.ModTime().Equal(r.modTime) || fi.Size() != r.size
+}
+
+// Watch checks the policy file for changes every interval, and reloads it
+// when it changes or a value is sent on reload (for example, SIGHUP). Watch
+// returns when done is closed.
+func (r *PolicyReloader) Watch(interval time.Duration, reload <-chan os.Signal, done <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case sig := <-reload:
+			r.Info("Reloading policy file", "signal", sig, "loc", r.Path)
+			r.Reload()
+		case <-ticker.C:
+			if r.changed() {
+				r.Reload()
+			}
+		}
+	}
+}
+
+// policyDiff lists what changed between two policies.
+type policyDiff struct {
+	AddedGroups   []string
+	RemovedGroups []string
+	// Groups whose permissions, claims, phone numbers, accounts or redactions
+	// changed.
+	ChangedGroups []string
+	AddedUsers    []string
+	RemovedUsers  []string
+	// Users who are in a different group.
+	MovedUsers []string
+}
+
+func groupsByName(p *Policy) map[string]*Group {
+	groups := make(map[string]*Group)
+	if p == nil {
+		return groups
+	}
+	for _, g := range *p {
+		groups[g.Name] = g
+	}
+	return groups
+}
+
+// userGroups maps each user in p to the name of their group.
+func userGroups(p *Policy) map[string]string {
+	users := make(map[string]string)
+	if p == nil {
+		return users
+	}
+	for _, g := range *p {
+		for _, u := range g.Users {
+			users[u] = g.Name
+		}
+	}
+	return users
+}
+
+func redactionsEqual(a, b []*Redaction) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Pattern != b[i].Pattern || a[i].Replacement != b[i].Replacement {
+			return false
+		}
+	}
+	return true
+}
+
+func groupChanged(a, b *Group) bool {
+	return a.Default != b.Default ||
+		!reflect.DeepEqual(a.Permissions, b.Permissions) ||
+		!reflect.DeepEqual(a.Claims, b.Claims) ||
+		!reflect.DeepEqual(a.PhoneNumbers, b.PhoneNumbers) ||
+		!reflect.DeepEqual(a.Accounts, b.Accounts) ||
+		!redactionsEqual(a.Redactions, b.Redactions)
+}
+
+func diffPolicies(old, updated *Policy) *policyDiff {
+	d := new(policyDiff)
+	oldGroups, newGroups := groupsByName(old), groupsByName(updated)
+	for name, g := range newGroups {
+		if og, ok := oldGroups[name]; !ok {
+			d.AddedGroups = append(d.AddedGroups, name)
+		} else if groupChanged(og, g) {
+			d.ChangedGroups = append(d.ChangedGroups, name)
+		}
+	}
+	for name := range oldGroups {
+		if _, ok := newGroups[name]; !ok {
+			d.RemovedGroups = append(d.RemovedGroups, name)
+		}
+	}
+	oldUsers, newUsers := userGroups(old), userGroups(updated)
+	for user, group := range newUsers {
+		if og, ok := oldUsers[user]; !ok {
+			d.AddedUsers = append(d.AddedUsers, user)
+		} else if og != group {
+			d.MovedUsers = append(d.MovedUsers, user)
+		}
+	}
+	for user := range oldUsers {
+		if _, ok := newUsers[user]; !ok {
+			d.RemovedUsers = append(d.RemovedUsers, user)
+		}
+	}
+	for _, s := range [][]string{d.AddedGroups, d.RemovedGroups, d.ChangedGroups, d.AddedUsers, d.RemovedUsers, d.MovedUsers} {
+		sort.Strings(s)
+	}
+	return d
+}
+
+// logContext returns the non-empty parts of the diff as log15 key/value
+// pairs.
+func (d *policyDiff) logContext() []interface{} {
+	ctx := make([]interface{}, 0)
+	add := func(key string, vals []string) {
+		if len(vals) > 0 {
+			ctx = append(ctx, key, vals)
+		}
+	}
+	add("added_groups", d.AddedGroups)
+	add("removed_groups", d.RemovedGroups)
+	add("changed_groups", d.ChangedGroups)
+	add("added_users", d.AddedUsers)
+	add("removed_users", d.RemovedUsers)
+	add("moved_users", d.MovedUsers)
+	if len(ctx) == 0 {
+		ctx = append(ctx, "changes", "none")
+	}
+	return ctx
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var supportPolicy = `
+- name: support
+  default: true
+  users:
+    - test@example.com
+`
+
+var updatedPolicy = `
+- name: support
+  default: true
+  permissions:
+    can_view_message_body: false
+  users:
+    - new@example.com
+- name: eng
+  users:
+    - test@example.com
+`
+
+func writePolicy(t *testing.T, path string, data string) {
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.yml")
+	writePolicy(t, path, supportPolicy)
+	policy, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba := NewBasicAuthAuthenticator("logrole")
+	ba.SetPolicy(policy)
+	r := NewPolicyReloader(NullLogger, path, ba, policy, []*Account{{Name: "main"}})
+
+	writePolicy(t, path, updatedPolicy)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if ba.Policy != r.Policy() || len(*ba.Policy) != 2 {
+		t.Fatalf("expected Reload to set the new policy, got %v", ba.Policy)
+	}
+
+	// Two users in the same group
+	writePolicy(t, path, updatedPolicy+"    - new@example.com\n")
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected invalid policy to return an error, got nil")
+	}
+	if ba.Policy != r.Policy() || len(*ba.Policy) != 2 {
+		t.Errorf("expected invalid policy to keep the old one, got %v", ba.Policy)
+	}
+
+	// A group that can view an account we don't have
+	writePolicy(t, path, updatedPolicy+"  accounts:\n    - staging\n")
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected policy with an unknown account to return an error, got nil")
+	}
+	if ba.Policy != r.Policy() || len((*ba.Policy)[1].Accounts) != 0 {
+		t.Errorf("expected policy with an unknown account to keep the old one, got %v", ba.Policy)
+	}
+	writePolicy(t, path, updatedPolicy+"  accounts:\n    - main\n")
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicyWatch(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.yml")
+	writePolicy(t, path, supportPolicy)
+	ba := NewBasicAuthAuthenticator("logrole")
+	r := NewPolicyReloader(NullLogger, path, ba, nil, []*Account{{Name: "main"}})
+	done := make(chan bool)
+	defer close(done)
+	go r.Watch(5*time.Millisecond, nil, done)
+	writePolicy(t, path, updatedPolicy)
+	for i := 0; i < 200; i++ {
+		if p := r.Policy(); p != nil && len(*p) == 2 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("expected Watch to reload the changed policy file")
+}
+
+func TestDiffPolicies(t *testing.T) {
+	t.Parallel()
+	old := &Policy{
+		&Group{Name: "support", Users: []string{"a@example.com", "b@example.com"}, Permissions: defaultUserSettings()},
+		&Group{Name: "finance", Users: []string{"c@example.com"}, Permissions: defaultUserSettings()},
+	}
+	noBodies := defaultUserSettings()
+	noBodies.CanViewMessageBody = false
+	updated := &Policy{
+		&Group{Name: "support", Users: []string{"a@example.com"}, Permissions: noBodies},
+		&Group{Name: "eng", Users: []string{"b@example.com", "d@example.com"}, Permissions: defaultUserSettings()},
+	}
+	d := diffPolicies(old, updated)
+	want := &policyDiff{
+		AddedGroups:   []string{"eng"},
+		RemovedGroups: []string{"finance"},
+		ChangedGroups: []string{"support"},
+		AddedUsers:    []string{"d@example.com"},
+		RemovedUsers:  []string{"c@example.com"},
+		MovedUsers:    []string{"b@example.com"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("diffPolicies: got %#v, want %#v", d, want)
+	}
+	if ctx := diffPolicies(updated, updated).logContext(); len(ctx) != 2 || ctx[0] != "changes" {
+		t.Errorf("expected identical policies to log no changes, got %v", ctx)
+	}
+}
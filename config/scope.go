@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	twilio "github.com/saintpete/twilio-go"
+)
+
+// ErrOutOfScope is returned for a message, call or phone number that isn't to
+// or from one of the phone numbers in the user's group. Unlike ErrTooOld, we
+// don't tell the user that the resource exists.
+var ErrOutOfScope = errors.New("Cannot access this resource because it isn't to or from one of your group's phone numbers")
+
+var phoneNumberSid = regexp.MustCompile(`^PN[a-f0-9]{32}$`)
+
+// validateScopeEntry checks that an entry in a group's PhoneNumbers is a
+// phone number or a phone number Sid.
+func validateScopeEntry(entry string) error {
+	if strings.HasPrefix(entry, "PN") {
+		if !phoneNumberSid.MatchString(entry) {
+			return fmt.Errorf("%s is not a valid phone number Sid", entry)
+		}
+		return nil
+	}
+	if _, err := twilio.NewPhoneNumber(entry); err != nil {
+		return fmt.Errorf("%s: %v", entry, err)
+	}
+	return nil
+}
+
+// A numberScope is the set of phone numbers and phone number Sids a group is
+// limited to.
+type numberScope struct {
+	numbers map[twilio.PhoneNumber]bool
+	sids    map[string]bool
+}
+
+// newNumberScope returns the scope for the entries in a group's
+// PhoneNumbers, or nil if there are none. Entries are checked by
+// validatePolicy, so we skip any that are invalid.
+func newNumberScope(entries []string) *numberScope {
+	if len(entries) == 0 {
+		return nil
+	}
+	s := &numberScope{
+		numbers: make(map[twilio.PhoneNumber]bool),
+		sids:    make(map[string]bool),
+	}
+	for _, entry := range entries {
+		if phoneNumberSid.MatchString(entry) {
+			s.sids[entry] = true
+			continue
+		}
+		if pn, err := twilio.NewPhoneNumber(entry); err == nil {
+			s.numbers[pn] = true
+		}
+	}
+	return s
+}
+
+// HasPhoneNumberScope returns true if the user's group can only view some
+// phone numbers.
+func (u *User) HasPhoneNumberScope() bool {
+	return u.scope != nil
+}
+
+// CanViewPhoneNumber returns true if the user's group can view resources to
+// or from pn. sid is the Sid of pn, if it's one of the account's numbers, or
+// the empty string.
+func (u *User) CanViewPhoneNumber(pn twilio.PhoneNumber, sid string) bool {
+	if u.scope == nil {
+		return true
+	}
+	if pn != "" && u.scope.numbers[pn] {
+		return true
+	}
+	return sid != "" && u.scope.sids[sid]
+}
+
+// CanViewAnyPhoneNumber returns true if the user's group can view resources
+// to or from at least one of pns.
+func (u *User) CanViewAnyPhoneNumber(p *Permission, pns ...twilio.PhoneNumber) bool {
+	if u.scope == nil {
+		return true
+	}
+	for _, pn := range pns {
+		if u.CanViewPhoneNumber(pn, p.PhoneNumberSid(pn)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPhoneNumberSids sets the Sid of each of the account's phone numbers, so
+// we can check numbers against the Sids in a group's PhoneNumbers.
+func (p *Permission) SetPhoneNumberSids(sids map[twilio.PhoneNumber]string) {
+	m := make(map[string]string, len(sids))
+	for pn, sid := range sids {
+		m[string(pn)] = sid
+	}
+	p.numberSidsMu.Lock()
+	p.numberSids = m
+	p.numberSidsMu.Unlock()
+}
+
+// PhoneNumberSid returns the Sid of pn, or the empty string if pn isn't one
+// of the account's phone numbers, or we haven't loaded them yet.
+func (p *Permission) PhoneNumberSid(pn twilio.PhoneNumber) string {
+	if p == nil {
+		return ""
+	}
+	p.numberSidsMu.RLock()
+	defer p.numberSidsMu.RUnlock()
+	return p.numberSids[string(pn)]
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+)
+
+func TestValidatePhoneNumberScope(t *testing.T) {
+	t.Parallel()
+	for _, entry := range []string{"PN123", "hello", "+1 (925) 392-xxxx"} {
+		p := &Policy{&Group{Name: "support", PhoneNumbers: []string{entry}}}
+		if err := validatePolicy(p); err == nil {
+			t.Errorf("expected %q to be an invalid phone number, got nil", entry)
+		}
+	}
+	p := &Policy{&Group{Name: "support", PhoneNumbers: []string{
+		"+19253920364", "PN1234567890abcdef1234567890abcdef",
+	}}}
+	if err := validatePolicy(p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCanViewPhoneNumber(t *testing.T) {
+	t.Parallel()
+	p := &Policy{&Group{
+		Name:         "support",
+		Users:        []string{"test@example.com"},
+		Permissions:  AllUserSettings(),
+		PhoneNumbers: []string{"+1 925-392-0364", "PN1234567890abcdef1234567890abcdef"},
+	}}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.HasPhoneNumberScope() {
+		t.Fatal("expected user to have a phone number scope")
+	}
+	if !u.CanViewPhoneNumber("+19253920364", "") {
+		t.Error("expected user to view a number in their group")
+	}
+	perm := NewPermission(time.Hour)
+	if u.CanViewAnyPhoneNumber(perm, "+14105551234", "+14105559876") {
+		t.Error("expected user to not view numbers outside their group")
+	}
+	perm.SetPhoneNumberSids(map[twilio.PhoneNumber]string{
+		"+14105551234": "PN1234567890abcdef1234567890abcdef",
+	})
+	if !u.CanViewAnyPhoneNumber(perm, "+14105551234", "+14105559876") {
+		t.Error("expected user to view a number by its Sid")
+	}
+	if !NewUser(AllUserSettings()).CanViewPhoneNumber("+14105559876", "") {
+		t.Error("expected user without a scope to view every number")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/mail"
 	"time"
@@ -12,13 +11,20 @@ import (
 	log "github.com/inconshreveable/log15"
 	"github.com/kevinburke/handlers"
 	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/apitoken"
+	"github.com/saintpete/logrole/audit"
+	"github.com/saintpete/logrole/cache"
+	"github.com/saintpete/logrole/index"
 	"github.com/saintpete/logrole/services"
-	yaml "gopkg.in/yaml.v2"
+	"golang.org/x/net/context"
 )
 
 const DefaultPort = "4114"
 const DefaultPageSize = 50
 
+// DefaultCacheSizeMB is the size of the cache, if none is configured.
+const DefaultCacheSizeMB = 25
+
 // DefaultTimezones are a user's options if no timezones are configured. These
 // correspond to the 4 timezones in the USA, west to east.
 var DefaultTimezones = []string{
@@ -33,6 +39,10 @@ var DefaultTimezones = []string{
 // 1980's.
 var DefaultMaxResourceAge = time.Since(twilio.Epoch)
 
+var noopAPITokens = errors.New("Cannot use API tokens without an auth scheme that identifies users. Set auth_scheme to basic, google or oidc, or remove api_token_file.")
+
+var missingOIDCCredentials = errors.New("Cannot use oidc auth without an issuer, Client ID and Client Secret. Set oidc_issuer, oidc_client_id and oidc_client_secret.")
+
 var missingGoogleCredentials = errors.New("Cannot use google auth without a Client ID and Client Secret. To configure a Client ID and Secret, see https://github.com/saintpete/logrole/blob/master/docs/google.md.")
 
 // FileConfig defines the settings you can load from a YAML configuration file.
@@ -44,6 +54,9 @@ type FileConfig struct {
 	Port       string `yaml:"port"`
 	AccountSid string `yaml:"twilio_account_sid"`
 	AuthToken  string `yaml:"twilio_auth_token"`
+	// Browse several Twilio accounts or subaccounts from one server. If set,
+	// leave AccountSid and AuthToken empty.
+	Accounts []*AccountConfig `yaml:"accounts,omitempty"`
 
 	Realm services.Rlm `yaml:"realm"`
 	// Default timezone for dates/times in the UI
@@ -82,9 +95,48 @@ type FileConfig struct {
 	GoogleClientSecret   string   `yaml:"google_client_secret"`
 	GoogleAllowedDomains []string `yaml:"google_allowed_domains"`
 
+	// For auth_scheme "oidc", the OpenID Connect issuer URL, for example
+	// "https://example.okta.com". We load the rest of the provider's
+	// configuration from the issuer.
+	OIDCIssuer       string `yaml:"oidc_issuer"`
+	OIDCClientID     string `yaml:"oidc_client_id"`
+	OIDCClientSecret string `yaml:"oidc_client_secret"`
+	// The ID token claim that identifies a user in the policy. Defaults to
+	// "email".
+	OIDCUserIDClaim string `yaml:"oidc_user_id_claim"`
+	// The ID token claim that lists a user's groups, matched against the
+	// claims of each group in the policy. Defaults to "groups".
+	OIDCGroupsClaim string `yaml:"oidc_groups_claim"`
+	// The name of the provider, shown on the login button. Defaults to
+	// "Single Sign-On".
+	OIDCProviderName string `yaml:"oidc_provider_name"`
+
 	PolicyFile string `yaml:"policy_file"`
 	Policy     *Policy
 
+	// Where to cache Twilio API responses: "memory" (the default) or "disk".
+	CacheBackend string `yaml:"cache_backend"`
+	// The directory for cached responses, if CacheBackend is "disk".
+	CacheDirectory string `yaml:"cache_directory"`
+	// The most memory (or disk space, if CacheBackend is "disk") to use for
+	// cached responses. Defaults to DefaultCacheSizeMB.
+	CacheSizeMB uint `yaml:"cache_size_mb"`
+	// Keep expired responses this long, and show them while a fresh copy is
+	// fetched in the background, or if Twilio returns an error.
+	CacheStaleGracePeriod time.Duration `yaml:"cache_stale_grace_period"`
+
+	// If set, crawl messages in the background and keep a full-text index of
+	// their bodies in this directory, so users can search by message body.
+	MessageIndexDirectory string `yaml:"message_index_directory"`
+
+	// If set, record every resource a user views, searches for, or plays in
+	// this file.
+	AuditLogFile string `yaml:"audit_log_file"`
+
+	// If set, let users create personal API tokens, and store a hash of each
+	// token in this file.
+	APITokenFile string `yaml:"api_token_file"`
+
 	Debug bool `yaml:"debug"`
 }
 
@@ -98,7 +150,11 @@ type Settings struct {
 
 	// Whether to allow HTTP traffic.
 	AllowUnencryptedTraffic bool
-	Client                  *twilio.Client
+	// The client for the first account in Accounts.
+	Client *twilio.Client
+	// The Twilio accounts users can browse. If empty, users browse the
+	// account for Client.
+	Accounts []*Account
 
 	// LocationFinder determines the correct timezone to display for a given
 	// request, based on the default and a user's TZ cookie (if present).
@@ -131,6 +187,30 @@ type Settings struct {
 	// THIS IS NOT A SECURITY FEATURE AND SHOULD NOT BE RELIED ON FOR IP
 	// WHITELISTING.
 	IPSubnets []*net.IPNet
+
+	// Where to store cached Twilio API responses. If nil, responses are
+	// cached in memory.
+	CacheStore cache.Store
+
+	// How long to keep serving expired responses while they're refreshed.
+	// Zero disables stale responses.
+	CacheStaleGracePeriod time.Duration
+
+	// A full-text index of message bodies. If nil, users can't search by
+	// message body.
+	MessageIndex *index.Index
+
+	// Where to record which users accessed which resources. If nil, access
+	// isn't recorded.
+	AuditLog audit.Log
+
+	// Where personal API tokens are stored. If nil, users can't create API
+	// tokens.
+	APITokens apitoken.Store
+
+	// Reloads the policy when the policy file changes. Nil if the policy
+	// isn't loaded from a file.
+	PolicyReloader *PolicyReloader
 }
 
 var errWrongLength = errors.New("Secret key has wrong length. Should be a 64-byte hex string")
@@ -211,20 +291,13 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 
 	if c.PolicyFile != "" {
 		// we checked above that Policy is nil in this case
-		data, err := ioutil.ReadFile(c.PolicyFile)
+		policy, err := LoadPolicyFile(c.PolicyFile)
 		if err != nil {
-			l.Error("Couldn't load permission file", "loc", c.PolicyFile)
+			l.Error("Couldn't load policy file", "err", err, "loc", c.PolicyFile)
 			return nil, err
 		}
-		var policy Policy
-		if err := yaml.Unmarshal(data, &policy); err != nil {
-			l.Error("Couldn't parse policy file", "err", err, "loc", c.PolicyFile)
-			return nil, err
-		}
-		c.Policy = &policy
-	}
-
-	if c.Policy != nil {
+		c.Policy = policy
+	} else if c.Policy != nil {
 		if err := validatePolicy(c.Policy); err != nil {
 			l.Error("Couldn't validate policy", "err", err)
 			return nil, err
@@ -255,11 +328,59 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 		gauthenticator := NewGoogleAuthenticator(l, c.GoogleClientID, c.GoogleClientSecret, baseURL, c.GoogleAllowedDomains, secretKey)
 		gauthenticator.AllowUnencryptedTraffic = allowHTTP
 		authenticator = gauthenticator
+	case "oidc":
+		if c.OIDCIssuer == "" || c.OIDCClientID == "" || c.OIDCClientSecret == "" {
+			return nil, missingOIDCCredentials
+		}
+		var baseURL string
+		if allowHTTP {
+			baseURL = "http://" + c.PublicHost
+		} else {
+			baseURL = "https://" + c.PublicHost
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), OIDCTimeout)
+		oauthenticator, err := NewOIDCAuthenticator(ctx, l, c.OIDCIssuer, c.OIDCClientID, c.OIDCClientSecret, baseURL, c.OIDCUserIDClaim, secretKey)
+		cancel()
+		if err != nil {
+			l.Error("Couldn't configure OpenID Connect", "err", err, "issuer", c.OIDCIssuer)
+			return nil, err
+		}
+		oauthenticator.AllowUnencryptedTraffic = allowHTTP
+		if c.OIDCProviderName != "" {
+			oauthenticator.ProviderName = c.OIDCProviderName
+		}
+		if c.OIDCGroupsClaim != "" {
+			oauthenticator.GroupsClaim = c.OIDCGroupsClaim
+		}
+		authenticator = oauthenticator
 	default:
 		return nil, fmt.Errorf("Unknown auth scheme: %s", c.AuthScheme)
 	}
+	var apiTokens apitoken.Store
+	if c.APITokenFile != "" {
+		if c.AuthScheme == "" || c.AuthScheme == "noop" {
+			return nil, noopAPITokens
+		}
+		apiTokens, err = apitoken.NewFileStore(c.APITokenFile)
+		if err != nil {
+			l.Error("Couldn't open API token file", "err", err, "file", c.APITokenFile)
+			return nil, err
+		}
+		authenticator = NewTokenAuthenticator(authenticator, apiTokens)
+	}
 	authenticator.SetPolicy(c.Policy)
-	client := twilio.NewClient(c.AccountSid, c.AuthToken, nil)
+	accounts, err := newAccounts(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePolicyAccounts(c.Policy, accounts); err != nil {
+		l.Error("Couldn't validate policy", "err", err)
+		return nil, err
+	}
+	var reloader *PolicyReloader
+	if c.PolicyFile != "" {
+		reloader = NewPolicyReloader(l, c.PolicyFile, authenticator, c.Policy, accounts)
+	}
 	if c.Timezone == "" {
 		l.Info("No timezone provided, defaulting to UTC")
 	}
@@ -291,6 +412,44 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 		}
 	}
 
+	var store cache.Store
+	if c.CacheSizeMB == 0 {
+		c.CacheSizeMB = DefaultCacheSizeMB
+	}
+	switch c.CacheBackend {
+	case "", "memory":
+		store = cache.NewLRUStore(int64(c.CacheSizeMB) * 1024 * 1024)
+	case "disk":
+		if c.CacheDirectory == "" {
+			return nil, errors.New("Cannot use the disk cache without a cache_directory")
+		}
+		store, err = cache.NewDiskStore(c.CacheDirectory, int64(c.CacheSizeMB)*1024*1024, c.CacheStaleGracePeriod)
+		if err != nil {
+			l.Error("Couldn't create cache directory", "err", err, "dir", c.CacheDirectory)
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown cache backend: %s", c.CacheBackend)
+	}
+
+	var idx *index.Index
+	if c.MessageIndexDirectory != "" {
+		idx, err = index.Open(c.MessageIndexDirectory)
+		if err != nil {
+			l.Error("Couldn't open message index", "err", err, "dir", c.MessageIndexDirectory)
+			return nil, err
+		}
+	}
+
+	var auditLog audit.Log
+	if c.AuditLogFile != "" {
+		auditLog, err = audit.NewFileLog(c.AuditLogFile)
+		if err != nil {
+			l.Error("Couldn't open audit log", "err", err, "file", c.AuditLogFile)
+			return nil, err
+		}
+	}
+
 	// TODO
 	if c.PageSize == 0 {
 		c.PageSize = DefaultPageSize
@@ -306,7 +465,8 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 	settings = &Settings{
 		Logger:                  l,
 		AllowUnencryptedTraffic: allowHTTP,
-		Client:                  client,
+		Client:                  accounts[0].Client,
+		Accounts:                accounts,
 		LocationFinder:          locationFinder,
 		PublicHost:              c.PublicHost,
 		PageSize:                c.PageSize,
@@ -317,6 +477,12 @@ func NewSettingsFromConfig(c *FileConfig, l log.Logger) (settings *Settings, err
 		Reporter:                reporter,
 		Authenticator:           authenticator,
 		IPSubnets:               nets,
+		CacheStore:              store,
+		CacheStaleGracePeriod:   c.CacheStaleGracePeriod,
+		MessageIndex:            idx,
+		AuditLog:                auditLog,
+		APITokens:               apiTokens,
+		PolicyReloader:          reloader,
 	}
 	return
 }
@@ -192,3 +192,20 @@ func TestIPAddressParse(t *testing.T) {
 		t.Errorf("bad mask: %s", n.Mask.String())
 	}
 }
+
+func TestUnknownCacheBackend(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{CacheBackend: "redis"}
+	_, err := NewSettingsFromConfig(c, NullLogger)
+	if err == nil || err.Error() != "Unknown cache backend: redis" {
+		t.Errorf("expected unknown cache backend error, got %v", err)
+	}
+}
+
+func TestDiskCacheRequiresDirectory(t *testing.T) {
+	t.Parallel()
+	c := &FileConfig{CacheBackend: "disk"}
+	if _, err := NewSettingsFromConfig(c, NullLogger); err == nil {
+		t.Error("expected error when cache_directory is empty, got nil")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"golang.org/x/net/context"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var DefaultUser = NewUser(AllUserSettings())
@@ -26,9 +27,38 @@ type User struct {
 	canViewNumRecordings  bool
 	canPlayRecordings     bool
 	canViewRecordingPrice bool
+	canViewTranscriptions bool
+	canViewUsage          bool
 	canViewConferences    bool
 	canViewAlerts         bool
 	canViewCallbackURLs   bool
+	isAdmin               bool
+	// If the user can't view a phone number, can they view a masked copy of
+	// it?
+	canViewMaskedMessageFrom bool
+	canViewMaskedMessageTo   bool
+	canViewMaskedCallFrom    bool
+	canViewMaskedCallTo      bool
+	maskedDigits             int
+	// If the user can't view a phone number or a masked copy, can they view a
+	// pseudonym for it?
+	pseudonymousNumbers bool
+	// The phone numbers the user's group is limited to. Nil if the group can
+	// view every number.
+	scope *numberScope
+	// The names of the accounts the user's group can browse. Nil if the group
+	// can browse every account.
+	accounts map[string]bool
+	// The identity the Authenticator resolved for this user, for example a
+	// Basic Auth username or an email address. Empty if the user wasn't
+	// identified.
+	id string
+	// Group claims from the identity provider that matched the policy.
+	claims []string
+	// Rules that hide parts of message bodies and callback URLs.
+	redactions []*Redaction
+	// True if the user authenticated with a personal API token.
+	apiToken bool
 	// The maximum viewable age this viewer can view resources. If nonzero,
 	// this overrides any global setting.
 	maxResourceAge time.Duration
@@ -65,6 +95,13 @@ type UserSettings struct {
 	// Can the user listen to recordings?
 	CanPlayRecordings     bool `yaml:"can_play_recordings"`
 	CanViewRecordingPrice bool `yaml:"can_view_recording_price"`
+	// Can the user read the transcriptions of recordings? Redactions apply
+	// to the transcription text. Users also need CanPlayRecordings, since a
+	// transcription is the content of the recording.
+	CanViewTranscriptions bool `yaml:"can_view_transcriptions"`
+	// Can the user view the account's usage and spend totals at /usage? If
+	// it's left out of a policy, it's false.
+	CanViewUsage bool `yaml:"can_view_usage"`
 	// Can the user view metadata about a conference (sid, date created,
 	// region, etc)?
 	CanViewConferences bool `yaml:"can_view_conferences"`
@@ -74,6 +111,27 @@ type UserSettings struct {
 	// Can the user view a StatusCallbackURL? Also protects
 	// Voice/SMS/Fallback/Callback URL's for phone numbers.
 	CanViewCallbackURLs bool `yaml:"can_view_callback_urls"`
+	// Can the user view admin pages, like cache statistics? Unlike the other
+	// permissions, this is false if it's omitted.
+	IsAdmin bool `yaml:"is_admin"`
+
+	// If the user can't view the message sender, recipient, call originator
+	// or call recipient, can they view a masked copy of the number, with only
+	// the country code and the last MaskedDigits digits? In YAML, set
+	// can_view_message_from (or to, or the call equivalents) to "masked" to
+	// turn these on.
+	CanViewMaskedMessageFrom bool `yaml:"-"`
+	CanViewMaskedMessageTo   bool `yaml:"-"`
+	CanViewMaskedCallFrom    bool `yaml:"-"`
+	CanViewMaskedCallTo      bool `yaml:"-"`
+	// The number of digits to show at the end of a masked phone number.
+	// Defaults to DefaultMaskedDigits.
+	MaskedDigits int `yaml:"masked_digits"`
+	// If the user can't view a phone number, or a masked copy of it, show a
+	// stable pseudonym like "cust-7f3a9c01" instead, so they can tell
+	// customers apart and search for one. Like IsAdmin, this is false if it's
+	// omitted.
+	PseudonymousNumbers bool `yaml:"pseudonymous_numbers"`
 
 	// The maximum viewable age of resources this user can view. If nonzero,
 	// this overrides any global setting.
@@ -84,31 +142,72 @@ type UserSettings struct {
 	MaxResourceAge time.Duration `yaml:"max_resource_age"`
 }
 
+// DefaultMaskedDigits is the number of digits we show at the end of a masked
+// phone number, if none is configured.
+const DefaultMaskedDigits = 4
+
 // An alias type to avoid infinite recursion when calling UnmarshalYAML.
 type yamlSettings UserSettings
 
+// These settings can be true, false, or "masked".
+var maskableSettings = []string{
+	"can_view_message_from",
+	"can_view_message_to",
+	"can_view_call_from",
+	"can_view_call_to",
+}
+
 // Unmarshal YAML into the UserSettings object. By default, unspecified values
 // are set to true.
 func (us *UserSettings) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if us == nil {
 		us = new(UserSettings)
 	}
-	// sets everything to true
-	aus := AllUserSettings()
-	ys := yamlSettings(*aus)
-	if err := unmarshal(&ys); err != nil {
+	raw := make(map[string]interface{})
+	if err := unmarshal(&raw); err != nil {
 		if strings.Contains(err.Error(), "unmarshal !!seq") {
 			return fmt.Errorf("%s. Double check that permissions is a map and "+
 				"not a list (with dashes)", err.Error())
 		}
 		return err
 	}
+	masked := make(map[string]bool)
+	for _, key := range maskableSettings {
+		if val, ok := raw[key].(string); ok && val == "masked" {
+			masked[key] = true
+			raw[key] = false
+		}
+	}
+	ys := yamlSettings(*defaultUserSettings())
+	if len(masked) == 0 {
+		if err := unmarshal(&ys); err != nil {
+			return err
+		}
+	} else {
+		// yaml can't parse "masked" into a bool, so parse the settings again
+		// with the masked values set to false.
+		data, err := yaml.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(data, &ys); err != nil {
+			return err
+		}
+	}
 	*us = UserSettings(ys)
+	us.CanViewMaskedMessageFrom = masked["can_view_message_from"]
+	us.CanViewMaskedMessageTo = masked["can_view_message_to"]
+	us.CanViewMaskedCallFrom = masked["can_view_call_from"]
+	us.CanViewMaskedCallTo = masked["can_view_call_to"]
+	if us.MaskedDigits < 0 {
+		return fmt.Errorf("masked_digits can't be negative, got %d", us.MaskedDigits)
+	}
 	return nil
 }
 
 // AllUserSettings returns a UserSettings value with the widest possible set of
-// permissions.
+// permissions, except admin access, which has to be granted with is_admin in
+// a policy group.
 func AllUserSettings() *UserSettings {
 	return &UserSettings{
 		CanViewNumMedia:       true,
@@ -125,6 +224,8 @@ func AllUserSettings() *UserSettings {
 		CanViewNumRecordings:  true,
 		CanPlayRecordings:     true,
 		CanViewRecordingPrice: true,
+		CanViewTranscriptions: true,
+		CanViewUsage:          true,
 		CanViewConferences:    true,
 		CanViewAlerts:         true,
 		CanViewCallbackURLs:   true,
@@ -132,11 +233,24 @@ func AllUserSettings() *UserSettings {
 	}
 }
 
+// defaultUserSettings returns the settings for permissions that are omitted
+// from a policy. Everything is allowed except admin access and the account's
+// usage and spend totals, which must be granted explicitly.
+func defaultUserSettings() *UserSettings {
+	us := AllUserSettings()
+	us.CanViewUsage = false
+	return us
+}
+
 // NewUser creates a new User with the given settings.
 func NewUser(us *UserSettings) *User {
 	if us == nil {
 		us = &UserSettings{}
 	}
+	maskedDigits := us.MaskedDigits
+	if maskedDigits == 0 {
+		maskedDigits = DefaultMaskedDigits
+	}
 	return &User{
 		canViewNumMedia:       us.CanViewNumMedia,
 		canViewMessages:       us.CanViewMessages,
@@ -152,10 +266,20 @@ func NewUser(us *UserSettings) *User {
 		canViewNumRecordings:  us.CanViewNumRecordings,
 		canPlayRecordings:     us.CanPlayRecordings,
 		canViewRecordingPrice: us.CanViewRecordingPrice,
+		canViewTranscriptions: us.CanViewTranscriptions,
+		canViewUsage:          us.CanViewUsage,
 		canViewConferences:    us.CanViewConferences,
 		canViewAlerts:         us.CanViewAlerts,
 		canViewCallbackURLs:   us.CanViewCallbackURLs,
+		isAdmin:               us.IsAdmin,
 		maxResourceAge:        us.MaxResourceAge,
+
+		canViewMaskedMessageFrom: us.CanViewMaskedMessageFrom,
+		canViewMaskedMessageTo:   us.CanViewMaskedMessageTo,
+		canViewMaskedCallFrom:    us.CanViewMaskedCallFrom,
+		canViewMaskedCallTo:      us.CanViewMaskedCallTo,
+		maskedDigits:             maskedDigits,
+		pseudonymousNumbers:      us.PseudonymousNumbers,
 	}
 }
 
@@ -215,6 +339,14 @@ func (u *User) CanViewRecordingPrice() bool {
 	return u.canViewRecordingPrice
 }
 
+func (u *User) CanViewTranscriptions() bool {
+	return u.canViewTranscriptions
+}
+
+func (u *User) CanViewUsage() bool {
+	return u.canViewUsage
+}
+
 func (u *User) CanViewConferences() bool {
 	return u.canViewConferences
 }
@@ -227,6 +359,93 @@ func (u *User) CanViewCallbackURLs() bool {
 	return u.canViewCallbackURLs
 }
 
+func (u *User) IsAdmin() bool {
+	return u.isAdmin
+}
+
+// CanViewMaskedMessageFrom returns true if the user can't view the message
+// sender, but can view a masked copy of their number.
+func (u *User) CanViewMaskedMessageFrom() bool {
+	return u.CanViewMessages() && !u.canViewMessageFrom && u.canViewMaskedMessageFrom
+}
+
+// CanViewMaskedMessageTo returns true if the user can't view the message
+// recipient, but can view a masked copy of their number.
+func (u *User) CanViewMaskedMessageTo() bool {
+	return u.CanViewMessages() && !u.canViewMessageTo && u.canViewMaskedMessageTo
+}
+
+// CanViewMaskedCallFrom returns true if the user can't view the call
+// originator, but can view a masked copy of their number.
+func (u *User) CanViewMaskedCallFrom() bool {
+	return u.CanViewCalls() && !u.canViewCallFrom && u.canViewMaskedCallFrom
+}
+
+// CanViewMaskedCallTo returns true if the user can't view the call recipient,
+// but can view a masked copy of their number.
+func (u *User) CanViewMaskedCallTo() bool {
+	return u.CanViewCalls() && !u.canViewCallTo && u.canViewMaskedCallTo
+}
+
+// CanViewPseudonymousMessageFrom returns true if the user can't view the
+// message sender, or a masked copy of their number, but can view a pseudonym
+// for them.
+func (u *User) CanViewPseudonymousMessageFrom() bool {
+	return u.CanViewMessages() && !u.canViewMessageFrom && !u.canViewMaskedMessageFrom && u.pseudonymousNumbers
+}
+
+// CanViewPseudonymousMessageTo returns true if the user can't view the
+// message recipient, or a masked copy of their number, but can view a
+// pseudonym for them.
+func (u *User) CanViewPseudonymousMessageTo() bool {
+	return u.CanViewMessages() && !u.canViewMessageTo && !u.canViewMaskedMessageTo && u.pseudonymousNumbers
+}
+
+// CanViewPseudonymousCallFrom returns true if the user can't view the call
+// originator, or a masked copy of their number, but can view a pseudonym for
+// them.
+func (u *User) CanViewPseudonymousCallFrom() bool {
+	return u.CanViewCalls() && !u.canViewCallFrom && !u.canViewMaskedCallFrom && u.pseudonymousNumbers
+}
+
+// CanViewPseudonymousCallTo returns true if the user can't view the call
+// recipient, or a masked copy of their number, but can view a pseudonym for
+// them.
+func (u *User) CanViewPseudonymousCallTo() bool {
+	return u.CanViewCalls() && !u.canViewCallTo && !u.canViewMaskedCallTo && u.pseudonymousNumbers
+}
+
+// MaskedDigits returns the number of digits to show at the end of a masked
+// phone number.
+func (u *User) MaskedDigits() int {
+	return u.maskedDigits
+}
+
+// ID returns the identity the Authenticator resolved for this user, or the
+// empty string if the user wasn't identified.
+func (u *User) ID() string {
+	return u.id
+}
+
+// withID returns a copy of u with the given identity.
+func (u *User) withID(id string) *User {
+	u2 := *u
+	u2.id = id
+	return &u2
+}
+
+// Claims returns the identity provider group claims that were used to find
+// the user in the policy.
+func (u *User) Claims() []string {
+	return u.claims
+}
+
+// FromAPIToken returns true if the user authenticated with a personal API
+// token, instead of logging in.
+func (u *User) FromAPIToken() bool {
+	return u.apiToken
+}
+
 // CanViewResource returns true if the specified timestamp is within the
 // user's maxResourceAge setting. If the user's maxResourceAge is nonzero, it
 // overrides the globalMaxAge. Returns true if the globalMaxAge and the user's
@@ -26,6 +26,13 @@ can_view_messages: false
 	if us.CanViewMessageFrom == false {
 		t.Errorf("expected CanViewMessageFrom to be true, got false")
 	}
+	// except for admin access and usage
+	if us.IsAdmin == true {
+		t.Errorf("expected IsAdmin to be false, got true")
+	}
+	if us.CanViewUsage == true {
+		t.Errorf("expected CanViewUsage to be false, got true")
+	}
 }
 
 func TestCanViewResource(t *testing.T) {
@@ -48,3 +55,55 @@ func TestCanViewResource(t *testing.T) {
 		t.Errorf("with local Age = time.Minute, global Age == time.Nanosecond, CanViewResource (2 minutes ago) should be false, got true")
 	}
 }
+
+func TestUnmarshalMasked(t *testing.T) {
+	yml := []byte(`
+can_view_message_from: masked
+can_view_call_to: masked
+masked_digits: 2
+`)
+	us := new(UserSettings)
+	if err := yaml.Unmarshal(yml, us); err != nil {
+		t.Fatal(err)
+	}
+	if us.CanViewMessageFrom || !us.CanViewMaskedMessageFrom {
+		t.Errorf("expected masked message sender, got %#v", us)
+	}
+	if us.CanViewCallTo || !us.CanViewMaskedCallTo {
+		t.Errorf("expected masked call recipient, got %#v", us)
+	}
+	if !us.CanViewMessageTo || us.CanViewMaskedMessageTo {
+		t.Errorf("expected full message recipient, got %#v", us)
+	}
+	u := NewUser(us)
+	if !u.CanViewMaskedMessageFrom() || u.CanViewMaskedMessageTo() {
+		t.Errorf("expected masked message sender only, got %#v", u)
+	}
+	if u.MaskedDigits() != 2 {
+		t.Errorf("expected MaskedDigits to be 2, got %d", u.MaskedDigits())
+	}
+	if err := yaml.Unmarshal([]byte("masked_digits: -1"), new(UserSettings)); err == nil {
+		t.Error("expected negative masked_digits to be an error, got nil")
+	}
+}
+
+func TestPseudonymousNumbers(t *testing.T) {
+	us := new(UserSettings)
+	if err := yaml.Unmarshal([]byte("can_view_call_from: false\ncan_view_call_to: masked\n"), us); err != nil {
+		t.Fatal(err)
+	}
+	if us.PseudonymousNumbers {
+		t.Error("expected PseudonymousNumbers to default to false")
+	}
+	us.PseudonymousNumbers = true
+	u := NewUser(us)
+	if !u.CanViewPseudonymousCallFrom() {
+		t.Error("expected hidden caller to get a pseudonym")
+	}
+	if u.CanViewPseudonymousCallTo() {
+		t.Error("expected masked recipient not to get a pseudonym")
+	}
+	if u.CanViewPseudonymousMessageFrom() {
+		t.Error("expected visible sender not to get a pseudonym")
+	}
+}
@@ -0,0 +1,390 @@
+// Package index keeps a full-text index of message bodies on disk.
+//
+// Twilio's API can't search message bodies, so we crawl messages in the
+// background and record the words in each one. The index only stores SIDs,
+// phone numbers and dates; callers should fetch each message from Twilio
+// before showing it to a user, so that the usual permission checks apply.
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The name of the file inside the index directory.
+const filename = "messages.jsonl"
+
+// Index is an inverted index of message bodies. Documents are appended to a
+// single file, one JSON object per line, and loaded into memory when the
+// index is opened. It is safe for concurrent use.
+type Index struct {
+	mu    sync.RWMutex
+	f     *os.File
+	docs  []*doc
+	sids  map[string]bool
+	terms map[string][]int // posting lists; indexes into docs
+	// The oldest and newest DateCreated of the documents in each account.
+	spans map[string]*span
+}
+
+type span struct {
+	oldest time.Time
+	newest time.Time
+}
+
+type doc struct {
+	// The name of the Twilio account the message belongs to.
+	Account     string    `json:"account"`
+	Sid         string    `json:"sid"`
+	DateCreated time.Time `json:"date_created"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Terms       []string  `json:"terms"`
+}
+
+// Open loads the index in dir, creating the directory if it does not exist.
+// A partially written document at the end of the file (from a crash, say) is
+// discarded. Documents written before the index recorded accounts are
+// skipped, so the crawler will add them again.
+func Open(dir string) (*Index, error) {
+	if dir == "" {
+		return nil, errors.New("index: empty directory")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, filename), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{
+		f:     f,
+		sids:  make(map[string]bool),
+		terms: make(map[string][]int),
+		spans: make(map[string]*span),
+	}
+	var offset int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// line is a partial document, or empty.
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		d := new(doc)
+		if err := json.Unmarshal(line, d); err != nil {
+			break
+		}
+		offset += int64(len(line))
+		if d.Account == "" {
+			continue
+		}
+		idx.add(d)
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// add adds d to the in-memory index. The caller must hold the write lock, or
+// be the only one with a reference to i.
+func (i *Index) add(d *doc) {
+	if i.sids[d.Sid] {
+		return
+	}
+	id := len(i.docs)
+	i.docs = append(i.docs, d)
+	i.sids[d.Sid] = true
+	for _, term := range d.Terms {
+		i.terms[term] = append(i.terms[term], id)
+	}
+	sp, ok := i.spans[d.Account]
+	if !ok {
+		sp = new(span)
+		i.spans[d.Account] = sp
+	}
+	if sp.oldest.IsZero() || d.DateCreated.Before(sp.oldest) {
+		sp.oldest = d.DateCreated
+	}
+	if d.DateCreated.After(sp.newest) {
+		sp.newest = d.DateCreated
+	}
+}
+
+// Add indexes the body of the message with the given sid, in the named
+// account. Messages that are already in the index are ignored.
+func (i *Index) Add(account string, sid string, created time.Time, from, to, body string) error {
+	if account == "" {
+		return errors.New("index: cannot add a message without an account")
+	}
+	d := &doc{
+		Account:     account,
+		Sid:         sid,
+		DateCreated: created.UTC(),
+		From:        from,
+		To:          to,
+		Terms:       Terms(body),
+	}
+	bits, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	bits = append(bits, '\n')
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.f == nil {
+		return errors.New("index: Add called on a closed Index")
+	}
+	if i.sids[sid] {
+		return nil
+	}
+	if _, err := i.f.Write(bits); err != nil {
+		return err
+	}
+	i.add(d)
+	return nil
+}
+
+// Has reports whether the message with the given sid has been indexed.
+func (i *Index) Has(sid string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.sids[sid]
+}
+
+// Len returns the number of messages in the index.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.docs)
+}
+
+// Range returns the DateCreated of the oldest and newest messages in the
+// index for the named account. Both are zero if the index has no messages
+// from the account.
+func (i *Index) Range(account string) (oldest time.Time, newest time.Time) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	sp, ok := i.spans[account]
+	if !ok {
+		return time.Time{}, time.Time{}
+	}
+	return sp.oldest, sp.newest
+}
+
+// A Query describes the messages to search for.
+type Query struct {
+	// Only match messages in the account with this name.
+	Account string
+	// Every word in Body must appear in a message for it to match.
+	Body string
+	// If set, only match messages from or to this number, in E.164 format.
+	From string
+	To   string
+	// If set, only match messages created on or after Start, and before End.
+	Start time.Time
+	End   time.Time
+	// If set, only match messages for which Keep returns true, for example
+	// the ones the searcher is allowed to view. Matches are filtered before
+	// they're counted or limited. Keep must not call the Index.
+	Keep func(from string, to string, created time.Time) bool
+	// The maximum number of SIDs to return. Zero means no limit.
+	Limit int
+	// If set, only return messages that come after this position in the
+	// results. Use the Next value from the previous page's Result.
+	After string
+}
+
+// ErrInvalidCursor is returned when a Query's After value wasn't returned by
+// Search.
+var ErrInvalidCursor = errors.New("index: invalid cursor")
+
+// A Result is one page of the messages that match a Query.
+type Result struct {
+	// The SIDs of the messages on the page, newest first.
+	Sids []string
+	// The number of messages that match, on every page.
+	Total int
+	// The position of the last message on the page, to use as the After
+	// value for the next page. Empty if this is the last page.
+	Next string
+}
+
+// cursor returns the position of d in the results, for a Result's Next.
+func cursor(d *doc) string {
+	return strconv.FormatInt(d.DateCreated.UnixNano(), 10) + "." + d.Sid
+}
+
+// parseCursor returns a doc with the date and sid in a cursor.
+func parseCursor(c string) (*doc, error) {
+	parts := strings.SplitN(c, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, ErrInvalidCursor
+	}
+	nsec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &doc{Sid: parts[1], DateCreated: time.Unix(0, nsec).UTC()}, nil
+}
+
+// Search returns the SIDs of messages that match q, newest first. Messages
+// created at the same time are ordered by SID, so the order is the same on
+// every page.
+func (i *Index) Search(q Query) (*Result, error) {
+	var after *doc
+	if q.After != "" {
+		var err error
+		after, err = parseCursor(q.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+	terms := Terms(q.Body)
+	if len(terms) == 0 {
+		return &Result{Sids: []string{}}, nil
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	// Start with the shortest posting list, since the result can't be any
+	// longer than that.
+	lists := make([][]int, len(terms))
+	for j, term := range terms {
+		lists[j] = i.terms[term]
+		if len(lists[j]) == 0 {
+			return &Result{Sids: []string{}}, nil
+		}
+	}
+	sort.Sort(byLength(lists))
+	matches := lists[0]
+	for _, list := range lists[1:] {
+		matches = intersect(matches, list)
+	}
+	docs := make([]*doc, 0, len(matches))
+	for _, id := range matches {
+		d := i.docs[id]
+		if d.Account != q.Account {
+			continue
+		}
+		if q.From != "" && d.From != q.From {
+			continue
+		}
+		if q.To != "" && d.To != q.To {
+			continue
+		}
+		if !q.Start.IsZero() && d.DateCreated.Before(q.Start) {
+			continue
+		}
+		if !q.End.IsZero() && !d.DateCreated.Before(q.End) {
+			continue
+		}
+		if q.Keep != nil && !q.Keep(d.From, d.To, d.DateCreated) {
+			continue
+		}
+		docs = append(docs, d)
+	}
+	sort.Sort(newestFirst(docs))
+	result := &Result{Total: len(docs)}
+	if after != nil {
+		k := sort.Search(len(docs), func(j int) bool {
+			return newestFirst{after, docs[j]}.Less(0, 1)
+		})
+		docs = docs[k:]
+	}
+	if q.Limit > 0 && len(docs) > q.Limit {
+		docs = docs[:q.Limit]
+		result.Next = cursor(docs[len(docs)-1])
+	}
+	result.Sids = make([]string, len(docs))
+	for j, d := range docs {
+		result.Sids[j] = d.Sid
+	}
+	return result, nil
+}
+
+type byLength [][]int
+
+func (b byLength) Len() int           { return len(b) }
+func (b byLength) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byLength) Less(i, j int) bool { return len(b[i]) < len(b[j]) }
+
+type newestFirst []*doc
+
+func (n newestFirst) Len() int      { return len(n) }
+func (n newestFirst) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n newestFirst) Less(i, j int) bool {
+	if n[i].DateCreated.Equal(n[j].DateCreated) {
+		return n[i].Sid > n[j].Sid
+	}
+	return n[i].DateCreated.After(n[j].DateCreated)
+}
+
+// intersect returns the values present in both a and b, which must be sorted
+// in increasing order. Posting lists are sorted since document ids only ever
+// increase.
+func intersect(a, b []int) []int {
+	result := make([]int, 0)
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case a[0] > b[0]:
+			b = b[1:]
+		default:
+			result = append(result, a[0])
+			a = a[1:]
+			b = b[1:]
+		}
+	}
+	return result
+}
+
+// Close closes the index file. The index can't be used after it's closed.
+func (i *Index) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.f == nil {
+		return nil
+	}
+	err := i.f.Close()
+	i.f = nil
+	return err
+}
+
+// Terms splits s into the lowercase words that we index, with duplicates
+// removed. Words are runs of letters and digits.
+func Terms(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	seen := make(map[string]bool, len(words))
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
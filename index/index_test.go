@@ -0,0 +1,205 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tempIndex(t *testing.T) (*Index, string) {
+	dir, err := ioutil.TempDir("", "logrole-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return idx, dir
+}
+
+var now = time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)
+
+func search(t *testing.T, idx *Index, q Query) ([]string, int) {
+	result, err := idx.Search(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Sids, result.Total
+}
+
+func TestTerms(t *testing.T) {
+	t.Parallel()
+	terms := Terms("Your code is 1234. Don't share your code!")
+	want := []string{"your", "code", "is", "1234", "don", "t", "share"}
+	if !reflect.DeepEqual(terms, want) {
+		t.Errorf("Terms: got %q, want %q", terms, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+	idx, dir := tempIndex(t)
+	defer os.RemoveAll(dir)
+	defer idx.Close()
+	idx.Add("main", "SM1", now.Add(-2*time.Hour), "+19253920364", "+14105551234", "Your package has shipped")
+	idx.Add("main", "SM2", now.Add(-1*time.Hour), "+19253920364", "+14105555678", "Your package was delivered")
+	idx.Add("main", "SM3", now, "+14105551234", "+19253920364", "Where is my package?")
+	sids, total := search(t, idx, Query{Account: "main", Body: "PACKAGE"})
+	if want := []string{"SM3", "SM2", "SM1"}; !reflect.DeepEqual(sids, want) {
+		t.Errorf("expected newest first %v, got %v", want, sids)
+	}
+	if total != 3 {
+		t.Errorf("expected 3 matches, got %d", total)
+	}
+	sids, _ = search(t, idx, Query{Account: "main", Body: "your package"})
+	if want := []string{"SM2", "SM1"}; !reflect.DeepEqual(sids, want) {
+		t.Errorf("expected every term to match: want %v, got %v", want, sids)
+	}
+	sids, _ = search(t, idx, Query{Account: "main", Body: "package", From: "+19253920364", To: "+14105551234"})
+	if want := []string{"SM1"}; !reflect.DeepEqual(sids, want) {
+		t.Errorf("expected from/to filter to apply: want %v, got %v", want, sids)
+	}
+	sids, _ = search(t, idx, Query{Account: "main", Body: "package", Start: now.Add(-90 * time.Minute), End: now})
+	if want := []string{"SM2"}; !reflect.DeepEqual(sids, want) {
+		t.Errorf("expected date filter to apply: want %v, got %v", want, sids)
+	}
+	sids, total = search(t, idx, Query{Account: "main", Body: "package", Limit: 1})
+	if len(sids) != 1 || total != 3 {
+		t.Errorf("expected one sid of three matches, got %v (total %d)", sids, total)
+	}
+	keep := func(from string, to string, created time.Time) bool {
+		return to != "+14105551234"
+	}
+	sids, total = search(t, idx, Query{Account: "main", Body: "package", Keep: keep, Limit: 2})
+	if want := []string{"SM3", "SM2"}; !reflect.DeepEqual(sids, want) || total != 2 {
+		t.Errorf("expected Keep to apply before the count: want %v, got %v (total %d)", want, sids, total)
+	}
+	if sids, _ = search(t, idx, Query{Account: "main", Body: "refund"}); len(sids) != 0 {
+		t.Errorf("expected no matches, got %v", sids)
+	}
+}
+
+func TestOpenLoadsExistingIndex(t *testing.T) {
+	t.Parallel()
+	idx, dir := tempIndex(t)
+	defer os.RemoveAll(dir)
+	idx.Add("main", "SM1", now, "+19253920364", "+14105551234", "hello world")
+	idx.Add("main", "SM1", now, "+19253920364", "+14105551234", "hello world")
+	idx.Close()
+	// Simulate a crash in the middle of a write.
+	f, err := os.OpenFile(filepath.Join(dir, filename), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"sid":"SM2","da`))
+	f.Close()
+
+	idx, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if idx.Len() != 1 {
+		t.Errorf("expected 1 message in the index, got %d", idx.Len())
+	}
+	if !idx.Has("SM1") {
+		t.Error("expected SM1 to be loaded from disk")
+	}
+	if err := idx.Add("main", "SM2", now, "+19253920364", "+14105551234", "hello again"); err != nil {
+		t.Fatal(err)
+	}
+	sids, _ := search(t, idx, Query{Account: "main", Body: "hello"})
+	if want := []string{"SM1", "SM2"}; len(sids) != 2 {
+		t.Errorf("expected %v after truncating partial write, got %v", want, sids)
+	}
+	oldest, newest := idx.Range("main")
+	if !oldest.Equal(now) || !newest.Equal(now) {
+		t.Errorf("unexpected range: %v - %v", oldest, newest)
+	}
+}
+
+func TestSearchAccount(t *testing.T) {
+	t.Parallel()
+	idx, dir := tempIndex(t)
+	defer os.RemoveAll(dir)
+	defer idx.Close()
+	idx.Add("main", "SM1", now.Add(-time.Hour), "+19253920364", "+14105551234", "Your package has shipped")
+	idx.Add("other", "SM2", now, "+19253920364", "+14105551234", "Your package was delivered")
+	sids, total := search(t, idx, Query{Account: "other", Body: "package"})
+	if want := []string{"SM2"}; !reflect.DeepEqual(sids, want) || total != 1 {
+		t.Errorf("expected only matches in the account: want %v, got %v (total %d)", want, sids, total)
+	}
+	if oldest, _ := idx.Range("main"); !oldest.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected each account to have its own range, got %v", oldest)
+	}
+	if oldest, newest := idx.Range("missing"); !oldest.IsZero() || !newest.IsZero() {
+		t.Errorf("expected empty range for unknown account, got %v - %v", oldest, newest)
+	}
+	if err := idx.Add("", "SM3", now, "+19253920364", "+14105551234", "hello"); err == nil {
+		t.Error("expected error adding a message without an account, got nil")
+	}
+}
+
+func TestOpenSkipsDocumentsWithoutAccount(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	line := `{"sid":"SM1","date_created":"2016-11-01T12:00:00Z","from":"+19253920364","to":"+14105551234","terms":["hello"]}` + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if idx.Has("SM1") {
+		t.Error("expected document without an account to be skipped")
+	}
+	if err := idx.Add("main", "SM1", now, "+19253920364", "+14105551234", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if sids, _ := search(t, idx, Query{Account: "main", Body: "hello"}); len(sids) != 1 {
+		t.Errorf("expected skipped document to be added again, got %v", sids)
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	t.Parallel()
+	idx, dir := tempIndex(t)
+	defer os.RemoveAll(dir)
+	defer idx.Close()
+	idx.Add("main", "SM1", now.Add(-time.Hour), "+19253920364", "+14105551234", "Your package has shipped")
+	idx.Add("main", "SM2", now, "+19253920364", "+14105551234", "Your package was delivered")
+	idx.Add("main", "SM3", now, "+19253920364", "+14105551234", "Your package is late")
+	var sids []string
+	q := Query{Account: "main", Body: "package", Limit: 2}
+	for i := 0; i < 3; i++ {
+		result, err := idx.Search(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 3 {
+			t.Errorf("expected 3 matches on every page, got %d", result.Total)
+		}
+		sids = append(sids, result.Sids...)
+		if result.Next == "" {
+			break
+		}
+		q.After = result.Next
+	}
+	if want := []string{"SM3", "SM2", "SM1"}; !reflect.DeepEqual(sids, want) {
+		t.Errorf("expected pages to contain %v, got %v", want, sids)
+	}
+	if _, err := idx.Search(Query{Account: "main", Body: "package", After: "/2010-04-01/Accounts"}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/views"
+	"golang.org/x/net/context"
+)
+
+// Visiting any page under /accounts/<name> shows it for that account, and
+// makes it the account for the rest of the user's pages.
+var accountRoute = regexp.MustCompile(`^/accounts/([-_a-zA-Z0-9]+)(/.*)?$`)
+
+const accountCookie = "account"
+
+type accountCtxVar int
+
+var accountsKey accountCtxVar = 0
+
+// accountChoice is the account for a request, and the other accounts the user
+// can switch to.
+type accountChoice struct {
+	Current string
+	Names   []string
+}
+
+type accountLink struct {
+	Name string
+	URL  string
+}
+
+// chooseAccount picks the Twilio account for each request and stores it in
+// the request context. The account comes from an /accounts/<name> prefix on
+// the path, which is removed before the request is routed, or from a cookie
+// set by an earlier request, or is the first account the user can view.
+//
+// chooseAccount must run after the user is authenticated.
+func chooseAccount(h http.Handler, names []string, allowUnencryptedTraffic bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := config.GetUser(r)
+		if !ok {
+			rest.ServerError(w, r, errors.New("No user available"))
+			return
+		}
+		allowed := make([]string, 0, len(names))
+		for _, name := range names {
+			if u.CanViewAccount(name) {
+				allowed = append(allowed, name)
+			}
+		}
+		if len(allowed) == 0 {
+			rest.Forbidden(w, r, &rest.Error{Title: "You don't have access to any Twilio accounts"})
+			return
+		}
+		var current string
+		if match := accountRoute.FindStringSubmatch(r.URL.Path); len(match) > 0 {
+			current = match[1]
+			if !contains(names, current) {
+				rest.NotFound(w, r)
+				return
+			}
+			if !u.CanViewAccount(current) {
+				rest.Forbidden(w, r, &rest.Error{Title: "You don't have access to the " + current + " account"})
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     accountCookie,
+				Value:    current,
+				Path:     "/",
+				Secure:   !allowUnencryptedTraffic,
+				HttpOnly: true,
+				MaxAge:   60 * 60 * 24 * 365,
+			})
+			r.URL.Path = match[2]
+			r.URL.RawPath = ""
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+		} else if cookie, err := r.Cookie(accountCookie); err == nil && contains(allowed, cookie.Value) {
+			current = cookie.Value
+		} else {
+			current = allowed[0]
+		}
+		ctx := views.NewAccountContext(r.Context(), current)
+		ctx = context.WithValue(ctx, accountsKey, &accountChoice{Current: current, Names: allowed})
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func contains(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// getAccountChoice returns the account chosen for r, if one exists.
+func getAccountChoice(r *http.Request) (*accountChoice, bool) {
+	ac, ok := r.Context().Value(accountsKey).(*accountChoice)
+	return ac, ok
+}
+
+// links returns a link to path in each of the accounts in ac. Instance
+// pages link to the list page for the same resource, since the resource
+// belongs to the current account.
+func (ac *accountChoice) links(path string) []*accountLink {
+	section := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	links := make([]*accountLink, len(ac.Names))
+	for i, name := range ac.Names {
+		u := "/accounts/" + name
+		if section != "" {
+			u += "/" + section
+		}
+		links[i] = &accountLink{Name: name, URL: u}
+	}
+	return links
+}
+
+// backgroundContext returns a context for fetching resources after r is
+// done, in the same account as r.
+func backgroundContext(r *http.Request) context.Context {
+	ctx := context.Background()
+	if name, ok := views.AccountFromContext(r.Context()); ok {
+		ctx = views.NewAccountContext(ctx, name)
+	}
+	return ctx
+}
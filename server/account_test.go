@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/views"
+)
+
+func TestChooseAccount(t *testing.T) {
+	t.Parallel()
+	var path, account string
+	h := chooseAccount(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		account, _ = views.AccountFromContext(r.Context())
+	}), []string{"main", "sub"}, true)
+
+	req, _ := http.NewRequest("GET", "/accounts/sub/messages", nil)
+	req = config.SetUser(req, config.DefaultUser)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected Code to be 200, got %d", w.Code)
+	}
+	if path != "/messages" || account != "sub" {
+		t.Errorf("expected /messages in the sub account, got %s in %s", path, account)
+	}
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "sub" {
+		t.Fatalf("expected an account cookie, got %v", cookies)
+	}
+
+	req, _ = http.NewRequest("GET", "/calls", nil)
+	req.AddCookie(cookies[0])
+	req = config.SetUser(req, config.DefaultUser)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if path != "/calls" || account != "sub" {
+		t.Errorf("expected the cookie to choose the sub account, got %s", account)
+	}
+
+	req, _ = http.NewRequest("GET", "/accounts/other/calls", nil)
+	req = config.SetUser(req, config.DefaultUser)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Errorf("expected unknown account to return 404, got %d", w.Code)
+	}
+}
+
+func TestChooseAccountPolicy(t *testing.T) {
+	t.Parallel()
+	policy := &config.Policy{&config.Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: config.AllUserSettings(),
+		Accounts:    []string{"sub"},
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account string
+	h := chooseAccount(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		account, _ = views.AccountFromContext(r.Context())
+	}), []string{"main", "sub"}, true)
+	req, _ := http.NewRequest("GET", "/messages", nil)
+	h.ServeHTTP(httptest.NewRecorder(), config.SetUser(req, u))
+	if account != "sub" {
+		t.Errorf("expected user to get the first account they can view, got %s", account)
+	}
+	req, _ = http.NewRequest("GET", "/accounts/main/messages", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, config.SetUser(req, u))
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
+
+func TestAccountLinks(t *testing.T) {
+	t.Parallel()
+	ac := &accountChoice{Current: "main", Names: []string{"main", "sub"}}
+	links := ac.links("/messages/SM123")
+	if len(links) != 2 || links[1].URL != "/accounts/sub/messages" {
+		t.Errorf("expected links to the messages list in each account, got %v", links)
+	}
+	if links := ac.links("/"); links[1].URL != "/accounts/sub" {
+		t.Errorf("expected link to the sub account's home page, got %s", links[1].URL)
+	}
+}
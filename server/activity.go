@@ -0,0 +1,313 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+	"golang.org/x/net/context"
+)
+
+// An activityWindow is a time range that can be shown in the activity chart
+// on the phone number page.
+type activityWindow struct {
+	Name    string
+	Buckets int
+	// If true, each bucket is one hour, otherwise each bucket is one day.
+	Hourly bool
+}
+
+var activityWindows = []activityWindow{
+	{Name: "24h", Buckets: 24, Hourly: true},
+	{Name: "7d", Buckets: 7},
+	{Name: "30d", Buckets: 30},
+}
+
+const defaultActivityWindow = "7d"
+
+// The most pages of messages or calls in each direction to count for the
+// activity chart. Pages are as large as the API allows, so busy numbers will
+// have incomplete charts, but the page will still load quickly.
+const maxActivityPages = 10
+
+// How long to spend counting activity. If the counts take longer, we show
+// what we counted so far, and mark the chart as truncated.
+const activityTimeout = 5 * time.Second
+
+const activityPageSize = 1000
+
+const activityChartWidth = 720
+const activityChartHeight = 100
+
+func getActivityWindow(name string) (activityWindow, bool) {
+	if name == "" {
+		name = defaultActivityWindow
+	}
+	for _, w := range activityWindows {
+		if w.Name == name {
+			return w, true
+		}
+	}
+	return activityWindow{}, false
+}
+
+// An activityBucket counts the resources created in one hour or day.
+type activityBucket struct {
+	Start          time.Time
+	End            time.Time
+	Received       int
+	ReceivedFailed int
+	Sent           int
+	SentFailed     int
+}
+
+// activity counts the messages or calls sent by and received by a phone
+// number, over every bucket in a window.
+type activity struct {
+	Window  activityWindow
+	Buckets []*activityBucket
+	// True if there were too many resources to count them all, or we ran out
+	// of time.
+	Truncated bool
+
+	mu sync.Mutex
+}
+
+// newActivity creates empty buckets for window, ending with the bucket that
+// contains now. Buckets start on the hour, or at midnight, in now's location.
+// Keeping the boundaries stable means the same range gets requested (and
+// cached) until a new bucket starts.
+func newActivity(window activityWindow, now time.Time) *activity {
+	var start time.Time
+	if window.Hourly {
+		start = time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+		start = start.Add(-time.Duration(window.Buckets-1) * time.Hour)
+	} else {
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		start = start.AddDate(0, 0, -(window.Buckets - 1))
+	}
+	a := &activity{
+		Window:  window,
+		Buckets: make([]*activityBucket, window.Buckets),
+	}
+	for i := range a.Buckets {
+		var end time.Time
+		if window.Hourly {
+			end = start.Add(time.Hour)
+		} else {
+			end = start.AddDate(0, 0, 1)
+		}
+		a.Buckets[i] = &activityBucket{Start: start, End: end}
+		start = end
+	}
+	return a
+}
+
+func (a *activity) Start() time.Time {
+	return a.Buckets[0].Start
+}
+
+func (a *activity) End() time.Time {
+	return a.Buckets[len(a.Buckets)-1].End
+}
+
+// add counts a resource created at t. Resources outside of the window are
+// ignored.
+func (a *activity) add(t time.Time, sent bool, failed bool) {
+	i := sort.Search(len(a.Buckets), func(i int) bool {
+		return a.Buckets[i].End.After(t)
+	})
+	if i == len(a.Buckets) || t.Before(a.Buckets[i].Start) {
+		return
+	}
+	b := a.Buckets[i]
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case sent && failed:
+		b.SentFailed++
+	case sent:
+		b.Sent++
+	case failed:
+		b.ReceivedFailed++
+	default:
+		b.Received++
+	}
+}
+
+func (a *activity) bucketLabel(b *activityBucket) string {
+	if a.Window.Hourly {
+		return b.Start.Format("Mon Jan 2, 3PM")
+	}
+	return b.Start.Format("Mon Jan 2, 2006")
+}
+
+// activityHref returns a link to the list page at path, filtered to the
+// resources sent by (or to) pn during b.
+func activityHref(path string, startParam string, endParam string, pn string, sent bool, b *activityBucket) string {
+	query := url.Values{}
+	if sent {
+		query.Set("from", pn)
+	} else {
+		query.Set("to", pn)
+	}
+	query.Set(startParam, b.Start.Format(HTML5DatetimeLocalFormat))
+	query.Set(endParam, b.End.Format(HTML5DatetimeLocalFormat))
+	return path + "?" + query.Encode()
+}
+
+// chart renders a bar for each bucket. noun is the name of the counted
+// resources, e.g. "messages". Each segment of a bar links to the list page at
+// path for the same number, direction and time range.
+func (a *activity) chart(noun string, path string, startParam string, endParam string, pn string) template.HTML {
+	bars := make([]stackedBar, len(a.Buckets))
+	for i, b := range a.Buckets {
+		total := b.Received + b.ReceivedFailed + b.Sent + b.SentFailed
+		label := a.bucketLabel(b)
+		received := activityHref(path, startParam, endParam, pn, false, b)
+		sent := activityHref(path, startParam, endParam, pn, true, b)
+		bars[i] = stackedBar{
+			Label: fmt.Sprintf("%s: %d %s", label, total, noun),
+			Segments: []chartSegment{
+				{Label: fmt.Sprintf("%s: %d received", label, b.Received), Value: float64(b.Received), Class: "chart-bar-received", Href: received},
+				{Label: fmt.Sprintf("%s: %d received, failed", label, b.ReceivedFailed), Value: float64(b.ReceivedFailed), Class: "chart-bar-failed", Href: received},
+				{Label: fmt.Sprintf("%s: %d sent", label, b.Sent), Value: float64(b.Sent), Class: "chart-bar-sent", Href: sent},
+				{Label: fmt.Sprintf("%s: %d sent, failed or undelivered", label, b.SentFailed), Value: float64(b.SentFailed), Class: "chart-bar-failed", Href: sent},
+			},
+		}
+	}
+	return stackedBarChart(bars, activityChartWidth, activityChartHeight)
+}
+
+func messageFailed(m *views.Message) bool {
+	status, err := m.Status()
+	if err != nil {
+		return false
+	}
+	return status == twilio.StatusFailed || status == twilio.StatusUndelivered
+}
+
+// truncate marks a as truncated.
+func (a *activity) truncate() {
+	a.mu.Lock()
+	a.Truncated = true
+	a.mu.Unlock()
+}
+
+// countErr returns the error to report for an error fetching a page of
+// activity. If we ran out of time, a is marked as truncated instead.
+func countErr(ctx context.Context, err error, a *activity) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		a.truncate()
+		return nil
+	}
+	return err
+}
+
+// countMessages pages through the messages sent by (or to) pn during the
+// window and adds them to a. The pages are large, and nobody else will view
+// them, so ctx should come from views.NewUncachedContext.
+func countMessages(ctx context.Context, vc views.Client, u *config.User, pn string, sent bool, a *activity) error {
+	data := url.Values{}
+	if sent {
+		data.Set("From", pn)
+	} else {
+		data.Set("To", pn)
+	}
+	data.Set("PageSize", strconv.Itoa(activityPageSize))
+	start, end := a.Start(), a.End()
+	page, _, err := vc.GetMessagePageInRange(ctx, u, start, end, data)
+	for i := 1; ; i++ {
+		if err == twilio.NoMoreResults {
+			return nil
+		}
+		if err != nil {
+			return countErr(ctx, err, a)
+		}
+		for _, m := range page.Messages() {
+			created, err := m.DateCreated()
+			if err != nil || !created.Valid {
+				continue
+			}
+			a.add(created.Time, sent, messageFailed(m))
+		}
+		next := page.NextPageURI()
+		if !next.Valid {
+			return nil
+		}
+		if i >= maxActivityPages {
+			a.truncate()
+			return nil
+		}
+		page, _, err = vc.GetNextMessagePageInRange(ctx, u, start, end, next.String)
+	}
+}
+
+// callTime returns the time to use for c in the activity chart. Calls that
+// never connected don't have a start time, so use the time they were
+// created.
+func callTime(c *views.Call) (time.Time, bool) {
+	if started, err := c.StartTime(); err == nil && started.Valid {
+		return started.Time, true
+	}
+	if created, err := c.DateCreated(); err == nil && created.Valid {
+		return created.Time, true
+	}
+	return time.Time{}, false
+}
+
+// countCalls pages through the calls made by (or to) pn during the window and
+// adds them to a, like countMessages.
+func countCalls(ctx context.Context, vc views.Client, u *config.User, pn string, sent bool, a *activity) error {
+	data := url.Values{}
+	if sent {
+		data.Set("From", pn)
+	} else {
+		data.Set("To", pn)
+	}
+	data.Set("PageSize", strconv.Itoa(activityPageSize))
+	start, end := a.Start(), a.End()
+	page, _, err := vc.GetCallPageInRange(ctx, u, start, end, data)
+	for i := 1; ; i++ {
+		if err == twilio.NoMoreResults {
+			return nil
+		}
+		if err != nil {
+			return countErr(ctx, err, a)
+		}
+		for _, c := range page.Calls() {
+			t, ok := callTime(c)
+			if !ok {
+				continue
+			}
+			failed, _ := c.Failed()
+			a.add(t, sent, failed)
+		}
+		next := page.NextPageURI()
+		if !next.Valid {
+			return nil
+		}
+		if i >= maxActivityPages {
+			a.truncate()
+			return nil
+		}
+		page, _, err = vc.GetNextCallPageInRange(ctx, u, start, end, next.String)
+	}
+}
+
+// activityWindowNames returns the name of every activity window, for the
+// window selector.
+func activityWindowNames() []string {
+	names := make([]string, len(activityWindows))
+	for i, w := range activityWindows {
+		names[i] = w.Name
+	}
+	return names
+}
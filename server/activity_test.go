@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	types "github.com/kevinburke/go-types"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+	"golang.org/x/net/context"
+)
+
+func TestActivityBuckets(t *testing.T) {
+	t.Parallel()
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2016, 11, 9, 14, 35, 0, 0, loc)
+	w, _ := getActivityWindow("")
+	a := newActivity(w, now)
+	if len(a.Buckets) != 7 {
+		t.Fatalf("expected 7 buckets, got %d", len(a.Buckets))
+	}
+	if want := time.Date(2016, 11, 3, 0, 0, 0, 0, loc); !a.Start().Equal(want) {
+		t.Errorf("expected start to be %v, got %v", want, a.Start())
+	}
+	if want := time.Date(2016, 11, 10, 0, 0, 0, 0, loc); !a.End().Equal(want) {
+		t.Errorf("expected end to be %v, got %v", want, a.End())
+	}
+	a.add(now, true, false)
+	a.add(now.Add(-time.Hour), true, true)
+	a.add(time.Date(2016, 11, 3, 0, 0, 0, 0, loc), false, false)
+	a.add(time.Date(2016, 11, 4, 8, 0, 0, 0, time.UTC), false, true)
+	// outside of the window
+	a.add(time.Date(2016, 11, 2, 23, 59, 0, 0, loc), true, false)
+	a.add(a.End(), true, false)
+	last := a.Buckets[6]
+	if last.Sent != 1 || last.SentFailed != 1 {
+		t.Errorf("expected 1 sent and 1 failed in the last bucket, got %d and %d", last.Sent, last.SentFailed)
+	}
+	if a.Buckets[0].Received != 1 {
+		t.Errorf("expected 1 received in the first bucket, got %d", a.Buckets[0].Received)
+	}
+	// 8AM UTC is midnight Pacific time
+	if a.Buckets[1].ReceivedFailed != 1 {
+		t.Errorf("expected 1 failed in the second bucket, got %d", a.Buckets[1].ReceivedFailed)
+	}
+	var total int
+	for _, b := range a.Buckets {
+		total += b.Received + b.ReceivedFailed + b.Sent + b.SentFailed
+	}
+	if total != 4 {
+		t.Errorf("expected 4 resources to be counted, got %d", total)
+	}
+}
+
+func TestHourlyActivityBuckets(t *testing.T) {
+	t.Parallel()
+	w, ok := getActivityWindow("24h")
+	if !ok {
+		t.Fatal("expected 24h to be a valid window")
+	}
+	now := time.Date(2016, 11, 9, 14, 35, 0, 0, time.UTC)
+	a := newActivity(w, now)
+	if len(a.Buckets) != 24 {
+		t.Fatalf("expected 24 buckets, got %d", len(a.Buckets))
+	}
+	if want := time.Date(2016, 11, 8, 15, 0, 0, 0, time.UTC); !a.Start().Equal(want) {
+		t.Errorf("expected start to be %v, got %v", want, a.Start())
+	}
+	if _, ok := getActivityWindow("1y"); ok {
+		t.Error("expected 1y to be an invalid window")
+	}
+}
+
+func TestActivityChart(t *testing.T) {
+	t.Parallel()
+	w, _ := getActivityWindow("7d")
+	now := time.Date(2016, 11, 9, 14, 35, 0, 0, time.UTC)
+	a := newActivity(w, now)
+	a.add(now, true, false)
+	a.add(now, false, true)
+	chart := string(a.chart("messages", "/messages", "start", "end", "+19253920364"))
+	if !strings.Contains(chart, `href="/messages?end=2016-11-10T00%3A00&amp;from=%2B19253920364&amp;start=2016-11-09T00%3A00"`) {
+		t.Errorf("expected chart to link to sent messages, got %s", chart)
+	}
+	if !strings.Contains(chart, `class="chart-bar chart-bar-failed"`) {
+		t.Errorf("expected chart to have a failed segment, got %s", chart)
+	}
+	if strings.Contains(chart, `class="chart-bar chart-bar-received"`) {
+		t.Errorf("expected chart to skip empty segments, got %s", chart)
+	}
+	if !strings.Contains(chart, "<title>Wed Nov 9, 2016: 2 messages</title>") {
+		t.Errorf("expected chart to label the bar, got %s", chart)
+	}
+}
+
+// slowMessagesClient returns one page of messages, and waits for the context
+// to expire before returning the next one.
+type slowMessagesClient struct {
+	views.Client
+	messages []*twilio.Message
+}
+
+func (c *slowMessagesClient) GetMessagePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*views.MessagePage, uint64, error) {
+	mp := &twilio.MessagePage{
+		Messages: c.messages,
+		Page:     twilio.Page{NextPageURI: types.NullString{Valid: true, String: "/next"}},
+	}
+	page, err := views.NewMessagePage(mp, config.NewPermission(config.DefaultMaxResourceAge), u, nil)
+	return page, 0, err
+}
+
+func (c *slowMessagesClient) GetNextMessagePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, next string) (*views.MessagePage, uint64, error) {
+	<-ctx.Done()
+	return nil, 0, ctx.Err()
+}
+
+func TestCountMessagesTruncatesOnTimeout(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	vc := &slowMessagesClient{messages: []*twilio.Message{
+		{Sid: "SM123", From: "+19253920364", DateCreated: twilio.TwilioTime{Valid: true, Time: now}},
+	}}
+	w, _ := getActivityWindow("24h")
+	a := newActivity(w, now)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := countMessages(ctx, vc, config.NewUser(config.AllUserSettings()), "+19253920364", true, a); err != nil {
+		t.Fatalf("expected a timeout to truncate the count, got %v", err)
+	}
+	if !a.Truncated {
+		t.Error("expected activity to be truncated")
+	}
+	if sent := a.Buckets[len(a.Buckets)-1].Sent; sent != 1 {
+		t.Errorf("expected to keep the messages counted before the timeout, got %d", sent)
+	}
+}
@@ -26,6 +26,16 @@ const alertPattern = `(?P<sid>NO[a-f0-9]{32})`
 
 var alertInstanceRoute = regexp.MustCompile("^/alerts/" + alertPattern + "$")
 
+// The most pages of alerts we'll fetch to fill a page of alerts that match an
+// error code or host filter.
+const maxAlertFilterPages = 10
+
+// Checking whether every alert in a list is for a message or call in the
+// user's scope would take a request to Twilio per alert, so groups that are
+// limited to some phone numbers can't list alerts. They can still view the
+// alerts for a call on the call's page.
+var errScopedAlertList = errors.New("Groups that are limited to some phone numbers can't list alerts")
+
 var validAlertLevels = []twilio.LogLevel{
 	twilio.LogLevelError,
 	twilio.LogLevelWarning,
@@ -99,6 +109,11 @@ type alertInstanceData struct {
 	Loc   *time.Location
 }
 
+// alertInstanceResponse is the JSON representation of an alert instance page.
+type alertInstanceResponse struct {
+	Alert *views.Alert `json:"alert"`
+}
+
 func (a *alertInstanceData) Title() string {
 	return "Alert Details"
 }
@@ -121,6 +136,9 @@ func (s *alertInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	switch err {
 	case nil:
 		break
+	case config.ErrOutOfScope:
+		rest.NotFound(w, r)
+		return
 	case config.PermissionDenied, config.ErrTooOld:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
@@ -138,6 +156,12 @@ func (s *alertInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, &alertInstanceResponse{Alert: alert}); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	data := &baseData{
 		LF:       s.LocationFinder,
 		Duration: monotime.Since(start),
@@ -194,6 +218,7 @@ func (c *alertListData) NextQuery() template.URL {
 	if end, ok := c.Query["alert-end"]; ok {
 		data.Set("alert-end", end[0])
 	}
+	setAlertMatchQuery(c.Query, data)
 	return template.URL(data.Encode())
 }
 
@@ -208,9 +233,22 @@ func (c *alertListData) PreviousQuery() template.URL {
 	if end, ok := c.Query["alert-end"]; ok {
 		data.Set("alert-end", end[0])
 	}
+	setAlertMatchQuery(c.Query, data)
 	return template.URL(data.Encode())
 }
 
+// setAlertMatchQuery copies the error code and host filters from query to
+// data. Twilio can't filter alerts by error code or host, so we filter each
+// page ourselves, and have to pass the filters along to the next page.
+func setAlertMatchQuery(query url.Values, data url.Values) {
+	if code := query.Get("error-code"); code != "" {
+		data.Set("error-code", code)
+	}
+	if host := query.Get("host"); host != "" {
+		data.Set("host", host)
+	}
+}
+
 type alertFrequency struct {
 	Since    time.Duration
 	Name     string
@@ -293,6 +331,10 @@ func (s *alertListServer) renderError(w http.ResponseWriter, r *http.Request, co
 			Page:  new(views.AlertPage),
 		},
 	}
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(code)
 	if err := render(w, r, s.tpl, "base", data); err != nil {
@@ -301,8 +343,34 @@ func (s *alertListServer) renderError(w http.ResponseWriter, r *http.Request, co
 	}
 }
 
+// fillFilteredPage fetches the pages after page, and adds the alerts that
+// match keep, until page has PageSize alerts or there are no more pages.
+// Twilio can't filter alerts by error code or host, so otherwise a filter
+// that matches a few alerts would show mostly empty pages. It fetches at most
+// maxAlertFilterPages pages, and stops early if a fetch fails; the next page
+// URI of the returned page continues after the last page we fetched.
+func (s *alertListServer) fillFilteredPage(ctx context.Context, u *config.User, start, end time.Time, page *views.AlertPage, keep func(*views.Alert) bool) *views.AlertPage {
+	for i := 1; i < maxAlertFilterPages && len(page.Alerts()) < int(s.PageSize); i++ {
+		next := page.NextPageURI()
+		if !next.Valid {
+			break
+		}
+		np, _, err := s.Client.GetNextAlertPageInRange(ctx, u, start, end, next.String)
+		if err == twilio.NoMoreResults {
+			np = new(views.AlertPage)
+			err = nil
+		}
+		if err != nil {
+			s.Debug("Error fetching alerts to fill a filtered page", "err", err)
+			break
+		}
+		page = page.Append(np.Filter(keep))
+	}
+	return page
+}
+
 func (s *alertListServer) validParams() []string {
-	return []string{"log-level", "resource-sid", "next", "alert-start", "alert-end"}
+	return []string{"log-level", "resource-sid", "next", "alert-start", "alert-end", "error-code", "host"}
 }
 
 func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -315,6 +383,10 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
 		return
 	}
+	if u.HasPhoneNumberScope() {
+		rest.Forbidden(w, r, &rest.Error{Title: errScopedAlertList.Error()})
+		return
+	}
 	query := r.URL.Query()
 	if err := validateParams(s.validParams(), query); err != nil {
 		s.renderError(w, r, http.StatusBadRequest, query, err)
@@ -327,9 +399,15 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if wroteError {
 		return
 	}
+	errorCode, err := parseErrorCode(query.Get("error-code"))
+	if err != nil {
+		query.Del("error-code")
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	host := strings.TrimSpace(query.Get("host"))
 	ctx, cancel := getContext(r.Context(), 3*time.Second)
 	defer cancel()
-	var err error
 	next, nextErr := getNext(query, s.secretKey)
 	if nextErr != nil {
 		err = errors.New("Could not decrypt `next` query parameter: " + nextErr.Error())
@@ -376,10 +454,16 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if errorCode != 0 || host != "" {
+		keep := func(a *views.Alert) bool {
+			return alertMatches(a, errorCode, host)
+		}
+		page = s.fillFilteredPage(ctx, u, startTime, endTime, page.Filter(keep), keep)
+	}
 	// Fetch the next page into the cache
 	go func(u *config.User, n types.NullString, start, end time.Time) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextAlertPageInRange(context.Background(), u, start, end, n.String); err != nil {
+			if _, _, err := s.Client.GetNextAlertPageInRange(backgroundContext(r), u, start, end, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
@@ -390,6 +474,7 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	if cachedAt > 0 {
 		data.CachedDuration = monotime.Since(cachedAt)
+		data.Stale = page.Stale()
 	}
 	ad := &alertListData{
 		Page:                  page,
@@ -408,6 +493,12 @@ func (s *alertListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		ad.Freq = freq
 	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(page, ad.EncryptedNextPage, ad)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	data.Data = ad
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(200)
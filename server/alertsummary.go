@@ -0,0 +1,459 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+)
+
+var alertSummaryRoute = regexp.MustCompile(`^/alerts/summary$`)
+
+// The most pages of alerts to count for the summary. Each page has up to
+// alertSummaryPageSize alerts.
+const maxAlertSummaryPages = 10
+
+const alertSummaryPageSize = 1000
+
+// The number of bars in each group's sparkline.
+const alertSparklineBuckets = 24
+
+const sparklineWidth = 120
+const sparklineHeight = 20
+
+// alertHost returns the host of the URL that triggered a, or the empty string
+// if there isn't one or the user can't see it.
+func alertHost(a *views.Alert) string {
+	reqURL, err := a.RequestURL()
+	if err != nil || reqURL == "" {
+		return ""
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// alertMatches returns true if a has the error code and host. A zero code or
+// an empty host matches every alert.
+func alertMatches(a *views.Alert, code twilio.Code, host string) bool {
+	if code != 0 {
+		if c, err := a.ErrorCode(); err != nil || c != code {
+			return false
+		}
+	}
+	if host != "" && alertHost(a) != host {
+		return false
+	}
+	return true
+}
+
+// parseErrorCode parses the "error-code" query parameter, returning 0 if it's
+// empty.
+func parseErrorCode(val string) (twilio.Code, error) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return 0, nil
+	}
+	code, err := strconv.Atoi(val)
+	if err != nil || code <= 0 {
+		return 0, errors.New("Invalid error code: " + val)
+	}
+	return twilio.Code(code), nil
+}
+
+// An alertGroup is every alert with the same error code, or for the same
+// host.
+type alertGroup struct {
+	ErrorCode twilio.Code `json:"error_code,omitempty"`
+	Host      string      `json:"host,omitempty"`
+	// A link to the more_info page for the error code.
+	MoreInfo  string    `json:"more_info,omitempty"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// The number of alerts in each part of the summary's time range, oldest
+	// first.
+	Counts []int `json:"counts"`
+	// A link to the alert list, filtered to this group.
+	Href string `json:"-"`
+}
+
+// alertGroups sorts groups by the number of alerts, most first.
+type alertGroups []*alertGroup
+
+func (g alertGroups) Len() int      { return len(g) }
+func (g alertGroups) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g alertGroups) Less(i, j int) bool {
+	if g[i].Count != g[j].Count {
+		return g[i].Count > g[j].Count
+	}
+	if g[i].ErrorCode != g[j].ErrorCode {
+		return g[i].ErrorCode < g[j].ErrorCode
+	}
+	return g[i].Host < g[j].Host
+}
+
+// alertSummary groups the alerts created between Start and End by error code
+// and by host.
+type alertSummary struct {
+	Start time.Time
+	End   time.Time
+	Total int
+	// True if there were too many alerts to count them all.
+	Truncated bool
+	byCode    map[twilio.Code]*alertGroup
+	byHost    map[string]*alertGroup
+}
+
+func newAlertSummary(start, end time.Time) *alertSummary {
+	return &alertSummary{
+		Start:  start,
+		End:    end,
+		byCode: make(map[twilio.Code]*alertGroup),
+		byHost: make(map[string]*alertGroup),
+	}
+}
+
+func (s *alertSummary) bucketDuration() time.Duration {
+	return s.End.Sub(s.Start) / alertSparklineBuckets
+}
+
+func (g *alertGroup) add(created time.Time, bucket int) {
+	g.Count++
+	if g.FirstSeen.IsZero() || created.Before(g.FirstSeen) {
+		g.FirstSeen = created
+	}
+	if created.After(g.LastSeen) {
+		g.LastSeen = created
+	}
+	g.Counts[bucket]++
+}
+
+// add counts a. Alerts without a visible creation date, or outside of the
+// summary's time range, are ignored.
+func (s *alertSummary) add(a *views.Alert) {
+	created, err := a.DateCreated()
+	if err != nil || !created.Valid {
+		return
+	}
+	if created.Time.Before(s.Start) || !created.Time.Before(s.End) {
+		return
+	}
+	bucket := int(created.Time.Sub(s.Start) / s.bucketDuration())
+	if bucket >= alertSparklineBuckets {
+		bucket = alertSparklineBuckets - 1
+	}
+	s.Total++
+	if code, err := a.ErrorCode(); err == nil {
+		g, ok := s.byCode[code]
+		if !ok {
+			g = &alertGroup{ErrorCode: code, Counts: make([]int, alertSparklineBuckets)}
+			g.MoreInfo, _ = a.MoreInfo()
+			s.byCode[code] = g
+		}
+		g.add(created.Time, bucket)
+	}
+	if host := alertHost(a); host != "" {
+		g, ok := s.byHost[host]
+		if !ok {
+			g = &alertGroup{Host: host, Counts: make([]int, alertSparklineBuckets)}
+			s.byHost[host] = g
+		}
+		g.add(created.Time, bucket)
+	}
+}
+
+// ByErrorCode returns a group for each error code, with the most common error
+// code first.
+func (s *alertSummary) ByErrorCode() []*alertGroup {
+	groups := make(alertGroups, 0, len(s.byCode))
+	for _, g := range s.byCode {
+		groups = append(groups, g)
+	}
+	sort.Sort(groups)
+	return groups
+}
+
+// ByHost returns a group for each host, with the most common host first.
+func (s *alertSummary) ByHost() []*alertGroup {
+	groups := make(alertGroups, 0, len(s.byHost))
+	for _, g := range s.byHost {
+		groups = append(groups, g)
+	}
+	sort.Sort(groups)
+	return groups
+}
+
+type alertSummaryServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	MaxResourceAge time.Duration
+	tpl            *template.Template
+}
+
+func newAlertSummaryServer(l log.Logger, vc views.Client, lf services.LocationFinder, maxResourceAge time.Duration) (*alertSummaryServer, error) {
+	s := &alertSummaryServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+		MaxResourceAge: maxResourceAge,
+	}
+	tpl, err := newTpl(template.FuncMap{
+		"min": minFunc(s.MaxResourceAge),
+		"max": maxLoc,
+	}, base+alertSummaryTpl)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+type alertSummaryData struct {
+	Err     string
+	Loc     *time.Location
+	Query   url.Values
+	Summary *alertSummary
+	// Values for the search form.
+	StartVal string
+	EndVal   string
+	// The groups, with the most common first.
+	ByErrorCode []*alertGroup
+	ByHost      []*alertGroup
+}
+
+// alertSummaryResponse is the JSON representation of the alert summary page.
+type alertSummaryResponse struct {
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	Total       int           `json:"total"`
+	Truncated   bool          `json:"truncated"`
+	ByErrorCode []*alertGroup `json:"by_error_code"`
+	ByHost      []*alertGroup `json:"by_host"`
+}
+
+func (d *alertSummaryData) Title() string {
+	return "Alert Summary"
+}
+
+func (d *alertSummaryData) Path() string {
+	return "/alerts/summary"
+}
+
+func (d *alertSummaryData) LogLevels() []twilio.LogLevel {
+	return validAlertLevels
+}
+
+// Sparkline returns a small chart of the number of alerts in g over the
+// summary's time range.
+func (d *alertSummaryData) Sparkline(g *alertGroup) template.HTML {
+	step := d.Summary.bucketDuration()
+	bars := make([]chartBar, len(g.Counts))
+	for i, count := range g.Counts {
+		start := d.Summary.Start.Add(time.Duration(i) * step).In(d.Loc)
+		bars[i] = chartBar{
+			Label: fmt.Sprintf("%s: %d alerts", start.Format("Jan 2, 3:04PM"), count),
+			Value: float64(count),
+		}
+	}
+	return barChart(bars, sparklineWidth, sparklineHeight)
+}
+
+// AllHref returns a link to the alert list for the summary's time range and
+// log level.
+func (d *alertSummaryData) AllHref() string {
+	return d.listHref("", "")
+}
+
+// listHref returns a link to the alert list for the summary's time range and
+// log level, filtered by param, if it's set.
+func (d *alertSummaryData) listHref(param, val string) string {
+	query := url.Values{}
+	query.Set("alert-start", d.StartVal)
+	query.Set("alert-end", d.EndVal)
+	if level := d.Query.Get("log-level"); level != "" {
+		query.Set("log-level", level)
+	}
+	if param != "" {
+		query.Set(param, val)
+	}
+	return "/alerts?" + query.Encode()
+}
+
+func (s *alertSummaryServer) validParams() []string {
+	return []string{"log-level", "alert-start", "alert-end"}
+}
+
+func (s *alertSummaryServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	str := cleanError(err)
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
+	loc := s.LocationFinder.GetLocationReq(r)
+	data := &baseData{
+		LF: s.LocationFinder,
+		Data: &alertSummaryData{
+			Err:      str,
+			Loc:      loc,
+			Query:    query,
+			StartVal: query.Get("alert-start"),
+			EndVal:   query.Get("alert-end"),
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+}
+
+// alertSummaryTimes returns the time range to summarize. The range defaults
+// to the last 24 hours, rounded up to the next hour.
+func alertSummaryTimes(query url.Values, loc *time.Location) (time.Time, time.Time, error) {
+	end := time.Now().In(loc).Add(time.Hour).Truncate(time.Hour)
+	if val := query.Get("alert-end"); val != "" {
+		var err error
+		end, err = time.ParseInLocation(HTML5DatetimeLocalFormat, val, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid end time: " + val)
+		}
+	}
+	start := end.Add(-24 * time.Hour)
+	if val := query.Get("alert-start"); val != "" {
+		var err error
+		start, err = time.ParseInLocation(HTML5DatetimeLocalFormat, val, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid start time: " + val)
+		}
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, errors.New("Start time must be before the end time")
+	}
+	return start, end, nil
+}
+
+func (s *alertSummaryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewAlerts() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	if u.HasPhoneNumberScope() {
+		rest.Forbidden(w, r, &rest.Error{Title: errScopedAlertList.Error()})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	loc := s.LocationFinder.GetLocationReq(r)
+	startTime, endTime, err := alertSummaryTimes(query, loc)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	vals := url.Values{}
+	vals.Set("PageSize", strconv.Itoa(alertSummaryPageSize))
+	if err := setPageFilters(query, vals); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 10*time.Second)
+	defer cancel()
+	start := monotime.Now()
+	summary := newAlertSummary(startTime, endTime)
+	page, _, err := s.Client.GetAlertPageInRange(ctx, u, startTime, endTime, vals)
+	for i := 1; err == nil; i++ {
+		for _, alert := range page.Alerts() {
+			summary.add(alert)
+		}
+		next := page.NextPageURI()
+		if !next.Valid {
+			break
+		}
+		if i >= maxAlertSummaryPages {
+			summary.Truncated = true
+			break
+		}
+		page, _, err = s.Client.GetNextAlertPageInRange(ctx, u, startTime, endTime, next.String)
+	}
+	if err == twilio.NoMoreResults {
+		err = nil
+	}
+	if err != nil {
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.StatusCode {
+			case 400:
+				s.renderError(w, r, http.StatusBadRequest, query, err)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	ad := &alertSummaryData{
+		Loc:         loc,
+		Query:       query,
+		Summary:     summary,
+		StartVal:    startTime.Format(HTML5DatetimeLocalFormat),
+		EndVal:      endTime.Format(HTML5DatetimeLocalFormat),
+		ByErrorCode: summary.ByErrorCode(),
+		ByHost:      summary.ByHost(),
+	}
+	for _, g := range ad.ByErrorCode {
+		g.Href = ad.listHref("error-code", strconv.Itoa(int(g.ErrorCode)))
+	}
+	for _, g := range ad.ByHost {
+		g.Href = ad.listHref("host", g.Host)
+	}
+	if wantsJSON(r) {
+		resp := &alertSummaryResponse{
+			Start:       summary.Start,
+			End:         summary.End,
+			Total:       summary.Total,
+			Truncated:   summary.Truncated,
+			ByErrorCode: ad.ByErrorCode,
+			ByHost:      ad.ByHost,
+		}
+		if err := renderJSON(w, http.StatusOK, resp); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data:     ad,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	types "github.com/kevinburke/go-types"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/test/harness"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+	"golang.org/x/net/context"
+)
+
+func newTestAlert(t *testing.T, code twilio.Code, reqURL string, created time.Time) *views.Alert {
+	talert := &twilio.Alert{
+		Sid:         "NO123",
+		ErrorCode:   code,
+		RequestURL:  reqURL,
+		DateCreated: twilio.TwilioTime{Valid: true, Time: created},
+	}
+	alert, err := views.NewAlert(talert, config.NewPermission(config.DefaultMaxResourceAge), config.NewUser(config.AllUserSettings()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alert
+}
+
+func TestAlertSummary(t *testing.T) {
+	t.Parallel()
+	end := time.Now().UTC().Truncate(time.Hour)
+	start := end.Add(-24 * time.Hour)
+	s := newAlertSummary(start, end)
+	s.add(newTestAlert(t, 11200, "https://example.com/sms", start))
+	s.add(newTestAlert(t, 11200, "https://example.com/voice?foo=bar", start.Add(90*time.Minute)))
+	s.add(newTestAlert(t, 11200, "https://example.net/sms", end.Add(-time.Minute)))
+	s.add(newTestAlert(t, 13227, "", start.Add(3*time.Hour)))
+	// outside of the range
+	s.add(newTestAlert(t, 13227, "", end))
+	s.add(newTestAlert(t, 13227, "", start.Add(-time.Minute)))
+	if s.Total != 4 {
+		t.Errorf("expected to count 4 alerts, got %d", s.Total)
+	}
+	codes := s.ByErrorCode()
+	if len(codes) != 2 {
+		t.Fatalf("expected 2 error codes, got %d", len(codes))
+	}
+	g := codes[0]
+	if g.ErrorCode != 11200 || g.Count != 3 {
+		t.Errorf("expected 3 alerts for 11200 first, got %d for %d", g.Count, g.ErrorCode)
+	}
+	if !g.FirstSeen.Equal(start) {
+		t.Errorf("expected first seen to be %v, got %v", start, g.FirstSeen)
+	}
+	if want := end.Add(-time.Minute); !g.LastSeen.Equal(want) {
+		t.Errorf("expected last seen to be %v, got %v", want, g.LastSeen)
+	}
+	if g.Counts[0] != 1 || g.Counts[1] != 1 || g.Counts[alertSparklineBuckets-1] != 1 {
+		t.Errorf("wrong sparkline counts: %v", g.Counts)
+	}
+	hosts := s.ByHost()
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(hosts))
+	}
+	if hosts[0].Host != "example.com" || hosts[0].Count != 2 {
+		t.Errorf("expected 2 alerts for example.com first, got %d for %s", hosts[0].Count, hosts[0].Host)
+	}
+}
+
+func TestAlertMatches(t *testing.T) {
+	t.Parallel()
+	alert := newTestAlert(t, 11200, "https://example.com/sms", time.Now())
+	tests := []struct {
+		code  twilio.Code
+		host  string
+		match bool
+	}{
+		{0, "", true},
+		{11200, "", true},
+		{11205, "", false},
+		{0, "example.com", true},
+		{11200, "example.net", false},
+	}
+	for _, tt := range tests {
+		if got := alertMatches(alert, tt.code, tt.host); got != tt.match {
+			t.Errorf("alertMatches(%d, %q): got %t, want %t", tt.code, tt.host, got, tt.match)
+		}
+	}
+}
+
+func TestAlertSummaryTimes(t *testing.T) {
+	t.Parallel()
+	query := url.Values{}
+	query.Set("alert-start", "2016-11-09T10:00")
+	query.Set("alert-end", "2016-11-10T10:00")
+	start, end, err := alertSummaryTimes(query, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2016, 11, 9, 10, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("expected start to be %v, got %v", want, start)
+	}
+	if want := time.Date(2016, 11, 10, 10, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("expected end to be %v, got %v", want, end)
+	}
+	query.Set("alert-start", "2016-11-11T10:00")
+	if _, _, err := alertSummaryTimes(query, time.UTC); err == nil {
+		t.Error("expected an error when start is after end, got nil")
+	}
+	start, end, err = alertSummaryTimes(url.Values{}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.Sub(start) != 24*time.Hour {
+		t.Errorf("expected to default to 24 hours, got %v", end.Sub(start))
+	}
+}
+
+func TestUnauthorizedUserCantViewAlertSummary(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newAlertSummaryServer(dlog, vc, lf, config.DefaultMaxResourceAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/alerts/summary", nil)
+	us := config.AllUserSettings()
+	us.CanViewAlerts = false
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+func TestScopedUserCantListAlerts(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	policy := &config.Policy{&config.Group{
+		Name:         "support",
+		Users:        []string{"test@example.com"},
+		Permissions:  config.AllUserSettings(),
+		PhoneNumbers: []string{"+19253920364"},
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := newAlertListServer(dlog, vc, lf, 50, config.DefaultMaxResourceAge, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := newAlertSummaryServer(dlog, vc, lf, config.DefaultMaxResourceAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path string
+		h    http.Handler
+	}{
+		{"/alerts", list},
+		{"/alerts/summary", summary},
+	} {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req = config.SetUser(req, u)
+		w := httptest.NewRecorder()
+		tt.h.ServeHTTP(w, req)
+		if w.Code != 403 {
+			t.Errorf("%s: expected to get 403, got %d", tt.path, w.Code)
+		}
+	}
+}
+
+func TestAlertListRejectsInvalidErrorCode(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newAlertListServer(dlog, vc, lf, 50, config.DefaultMaxResourceAge, services.NewRandomKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/alerts?error-code=abc", nil)
+	req = config.SetUser(req, config.NewUser(config.AllUserSettings()))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected to get 400, got %d", w.Code)
+	}
+}
+
+// alertPagesClient returns pages of alerts. The first page is stored at "",
+// and the rest at their next page URI.
+type alertPagesClient struct {
+	views.Client
+	pages map[string]*twilio.AlertPage
+}
+
+func (c *alertPagesClient) page(u *config.User, uri string) (*views.AlertPage, uint64, error) {
+	page, err := views.NewAlertPage(c.pages[uri], config.NewPermission(config.DefaultMaxResourceAge), u)
+	return page, 0, err
+}
+
+func (c *alertPagesClient) GetAlertPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*views.AlertPage, uint64, error) {
+	return c.page(u, "")
+}
+
+func (c *alertPagesClient) GetNextAlertPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, next string) (*views.AlertPage, uint64, error) {
+	return c.page(u, next)
+}
+
+func TestAlertListFillsFilteredPage(t *testing.T) {
+	t.Parallel()
+	now := twilio.TwilioTime{Valid: true, Time: time.Now().UTC()}
+	nextURI := func(i int) types.NullString {
+		return types.NullString{Valid: true, String: twilio.MonitorBaseURL + "/Alerts?Page=" + strconv.Itoa(i)}
+	}
+	vc := &alertPagesClient{pages: make(map[string]*twilio.AlertPage)}
+	// Every page has one 11200 alert and one 13227 alert.
+	uri := ""
+	for i := 1; i <= 4; i++ {
+		ap := &twilio.AlertPage{
+			Alerts: []*twilio.Alert{
+				{Sid: "NO" + strconv.Itoa(i) + "a", ErrorCode: 11200, DateCreated: now},
+				{Sid: "NO" + strconv.Itoa(i) + "b", ErrorCode: 13227, DateCreated: now},
+			},
+		}
+		if i < 4 {
+			ap.Meta.NextPageURL = nextURI(i)
+		}
+		vc.pages[uri] = ap
+		uri = nextURI(i).String
+	}
+	s, err := newAlertListServer(dlog, vc, lf, 2, config.DefaultMaxResourceAge, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := config.NewUser(config.AllUserSettings())
+	keep := func(a *views.Alert) bool { return alertMatches(a, 13227, "") }
+	first, _, _ := vc.page(u, "")
+	page := s.fillFilteredPage(context.Background(), u, time.Time{}, time.Time{}, first.Filter(keep), keep)
+	if len(page.Alerts()) != 2 {
+		t.Fatalf("expected to fill the page with 2 alerts, got %d", len(page.Alerts()))
+	}
+	for _, a := range page.Alerts() {
+		if code, _ := a.ErrorCode(); code != 13227 {
+			t.Errorf("expected only 13227 alerts, got %d", code)
+		}
+	}
+	if next := page.NextPageURI(); next != nextURI(2) {
+		t.Errorf("expected the next page to continue after the last page fetched, got %v", next)
+	}
+	ad := &alertListData{
+		Query:             url.Values{"error-code": []string{"13227"}},
+		EncryptedNextPage: getEncryptedPage(page.NextPageURI(), key),
+	}
+	if next, _ := url.ParseQuery(string(ad.NextQuery())); next.Get("error-code") != "13227" {
+		t.Errorf("expected the next page to keep the filter, got %v", next)
+	}
+	// The last page has no next page.
+	third, _, _ := vc.page(u, nextURI(2).String)
+	page = s.fillFilteredPage(context.Background(), u, time.Time{}, time.Time{}, third.Filter(keep), keep)
+	if len(page.Alerts()) != 2 || page.NextPageURI().Valid {
+		t.Errorf("expected 2 alerts and no next page, got %d and %v", len(page.Alerts()), page.NextPageURI())
+	}
+}
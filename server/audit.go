@@ -0,0 +1,230 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/audit"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+)
+
+var auditRoute = regexp.MustCompile(`^/audit$`)
+
+// List pages, their exports and the alert summary are recorded as searches.
+var auditListRoute = regexp.MustCompile(`^/(messages|calls|conferences|conversations|recordings|alerts|phone-numbers)(/export|/summary)?$`)
+
+// The first capture group of each of these is the resource's SID (or phone
+// number).
+var auditInstanceRoutes = []*regexp.Regexp{
+	messageInstanceRoute,
+	callInstanceRoute,
+	conferenceInstanceRoute,
+	alertInstanceRoute,
+	numberInstanceRoute,
+	transcriptionInstanceRoute,
+	recordingInstanceRoute,
+}
+
+var anySid = regexp.MustCompile(`[A-Z]{2}[a-f0-9]{32}`)
+
+// The most records to show on the audit page.
+const auditPageSize = 200
+
+// recordAccess records every request for a resource in al before serving it.
+// Requests are recorded whether or not the user is allowed to see the
+// resource. h must run after the Authenticator, so we know who the user is.
+func recordAccess(h http.Handler, l log.Logger, al audit.Log, secretKey *[32]byte) http.Handler {
+	if al == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rec := newAuditRecord(r, secretKey); rec != nil {
+			if err := al.Record(rec); err != nil {
+				l.Error("Couldn't write audit record", "err", err, "path", r.URL.Path)
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// newAuditRecord returns a Record for r, or nil if r isn't a request for a
+// resource.
+func newAuditRecord(r *http.Request, secretKey *[32]byte) *audit.Record {
+	if r.Method != "GET" {
+		return nil
+	}
+	rec := &audit.Record{
+		Time:      time.Now().UTC(),
+		RequestID: r.Header.Get("X-Request-Id"),
+		Path:      r.URL.Path,
+	}
+	if u, ok := config.GetUser(r); ok {
+		rec.User = u.ID()
+	}
+	// chooseAccount removes /accounts/<name> from the path, so get the
+	// account from the context instead.
+	if name, ok := views.AccountFromContext(r.Context()); ok {
+		rec.Account = name
+	}
+	if match := imageRoute.FindStringSubmatch(r.URL.Path); match != nil {
+		rec.Action = audit.ActionMedia
+		rec.Sid = sidFromEncryptedURL(match[1], secretKey)
+		return rec
+	}
+	if match := audioRoute.FindStringSubmatch(r.URL.Path); match != nil {
+		rec.Action = audit.ActionRecording
+		rec.Sid = sidFromEncryptedURL(match[1], secretKey)
+		return rec
+	}
+	if auditListRoute.MatchString(r.URL.Path) {
+		rec.Action = audit.ActionSearch
+		rec.Query = r.URL.RawQuery
+		return rec
+	}
+	for _, route := range auditInstanceRoutes {
+		if match := route.FindStringSubmatch(r.URL.Path); match != nil {
+			rec.Action = audit.ActionView
+			rec.Sid = match[1]
+			return rec
+		}
+	}
+	return nil
+}
+
+// sidFromEncryptedURL returns the first SID in the path of the encrypted
+// Twilio API URL that isn't an Account SID, for example the Message SID in
+// /2010-04-01/Accounts/AC123/Messages/MM123/Media/ME123. It returns the empty
+// string if the URL can't be decrypted.
+func sidFromEncryptedURL(encrypted string, secretKey *[32]byte) string {
+	urlStr, err := services.Unopaque(encrypted, secretKey)
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	for _, sid := range anySid.FindAllString(u.Path, -1) {
+		if !strings.HasPrefix(sid, "AC") {
+			return sid
+		}
+	}
+	return ""
+}
+
+// auditServer lets admins search the audit log.
+type auditServer struct {
+	log.Logger
+	Log            audit.Log
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+}
+
+func newAuditServer(l log.Logger, al audit.Log, lf services.LocationFinder) (*auditServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+auditTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &auditServer{
+		Logger:         l,
+		Log:            al,
+		LocationFinder: lf,
+		tpl:            tpl,
+	}, nil
+}
+
+type auditData struct {
+	Records []*audit.Record
+	Loc     *time.Location
+	Query   url.Values
+	Err     string
+}
+
+func (a *auditData) Title() string {
+	return "Audit Log"
+}
+
+// Truncated reports whether there may be more records than we're showing.
+func (a *auditData) Truncated() bool {
+	return len(a.Records) >= auditPageSize
+}
+
+type auditResponse struct {
+	Records []*audit.Record `json:"records"`
+}
+
+func (s *auditServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	str := cleanError(err)
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
+	data := &baseData{LF: s.LocationFinder, Data: &auditData{
+		Err:     str,
+		Loc:     s.LocationFinder.GetLocationReq(r),
+		Query:   query,
+		Records: []*audit.Record{},
+	}}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+func (s *auditServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.IsAdmin() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams([]string{"user", "sid", "start", "end"}, query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	loc := s.LocationFinder.GetLocationReq(r)
+	startTime, endTime, wroteError := getTimes(w, r, "start", "end", loc, query, s)
+	if wroteError {
+		return
+	}
+	records, err := s.Log.Search(audit.Query{
+		User:  strings.TrimSpace(query.Get("user")),
+		Sid:   strings.TrimSpace(query.Get("sid")),
+		Start: startTime,
+		End:   endTime,
+		Limit: auditPageSize,
+	})
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, &auditResponse{Records: records}); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{LF: s.LocationFinder, Data: &auditData{
+		Records: records,
+		Loc:     loc,
+		Query:   query,
+	}}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/saintpete/logrole/audit"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+)
+
+func tempAuditLog(t *testing.T) (*audit.FileLog, func()) {
+	dir, err := ioutil.TempDir("", "logrole-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	al, err := audit.NewFileLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return al, func() {
+		al.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRecordAccess(t *testing.T) {
+	t.Parallel()
+	al, cleanup := tempAuditLog(t)
+	defer cleanup()
+	policy := &config.Policy{&config.Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: config.AllUserSettings(),
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := recordAccess(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), dlog, al, key)
+	h = chooseAccount(h, []string{"main", "staging"}, true)
+	media := "/2010-04-01/Accounts/AC58f1e8f2b1c6b88ca90a012a4be0c279/Messages/MMd04242a0544234abba080942e0535505/Media/ME4e2d6b3d1ba1b15ab45a7b4fc2a8f6d1"
+	for _, uri := range []string{
+		"/messages/SMd04242a0544234abba080942e0535505",
+		"/accounts/staging/calls?to=%2B14105551234",
+		"/images/" + services.Opaque(media, key),
+		"/",
+	} {
+		req, _ := http.NewRequest("GET", uri, nil)
+		req.Header.Set("X-Request-Id", "7a1a0b3e-4d2c-4a8e-9f6b-2d1c3b4a5e6f")
+		req = config.SetUser(req, u)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	records, err := al.Search(audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	mediaRec, search, view := records[0], records[1], records[2]
+	if view.Action != audit.ActionView || view.Sid != "SMd04242a0544234abba080942e0535505" {
+		t.Errorf("unexpected instance view record: %#v", view)
+	}
+	if view.User != "test@example.com" || view.RequestID != "7a1a0b3e-4d2c-4a8e-9f6b-2d1c3b4a5e6f" {
+		t.Errorf("expected record to identify the user and request, got %#v", view)
+	}
+	if search.Action != audit.ActionSearch || search.Query != "to=%2B14105551234" || search.Account != "staging" {
+		t.Errorf("unexpected search record: %#v", search)
+	}
+	if view.Account != "main" {
+		t.Errorf("expected view to record the default account, got %q", view.Account)
+	}
+	if mediaRec.Action != audit.ActionMedia || mediaRec.Sid != "MMd04242a0544234abba080942e0535505" {
+		t.Errorf("unexpected media record: %#v", mediaRec)
+	}
+}
+
+func TestAuditPageRequiresAdmin(t *testing.T) {
+	t.Parallel()
+	al, cleanup := tempAuditLog(t)
+	defer cleanup()
+	s, err := newAuditServer(dlog, al, lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/audit", nil)
+	req = config.SetUser(req, config.DefaultUser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+	req, _ = http.NewRequest("GET", "/audit?sid=SMd04242a0544234abba080942e0535505", nil)
+	req = config.SetUser(req, newAdminUser())
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("expected Code to be 200, got %d", w.Code)
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/cache"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/views"
+)
+
+var cacheStatsRoute = regexp.MustCompile(`^/debug/cache$`)
+var cacheRoute = regexp.MustCompile(`^/cache$`)
+var cachePurgeRoute = regexp.MustCompile(`^/cache/purge$`)
+
+// How many of the largest keys to show on the cache page.
+const largestKeysCount = 20
+
+// cacheStatsServer reports the size of the cache to admins, for monitoring.
+type cacheStatsServer struct {
+	Cache *cache.Cache
+}
+
+type cacheStatsResponse struct {
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+	Entries   int    `json:"entries"`
+	Evictions uint64 `json:"evictions"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Expired   uint64 `json:"expired"`
+	Stale     uint64 `json:"stale"`
+}
+
+func newCacheStatsResponse(stats cache.Stats) *cacheStatsResponse {
+	return &cacheStatsResponse{
+		Bytes:     stats.Bytes,
+		MaxBytes:  stats.MaxBytes,
+		Entries:   stats.Entries,
+		Evictions: stats.Evictions,
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Expired:   stats.Expired,
+		Stale:     stats.Stale,
+	}
+}
+
+func (s *cacheStatsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.IsAdmin() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	if err := renderJSON(w, http.StatusOK, newCacheStatsResponse(s.Cache.Stats())); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+// cacheServer shows admins what's in the cache, and lets them purge it.
+type cacheServer struct {
+	log.Logger
+	Cache     *cache.Cache
+	Accounts  []*views.Account
+	PageSize  uint
+	secretKey *[32]byte
+	tpl       *template.Template
+}
+
+func newCacheServer(l log.Logger, c *cache.Cache, accounts []*views.Account, pageSize uint, secretKey *[32]byte) (*cacheServer, error) {
+	tpl, err := newTpl(template.FuncMap{
+		"bytes": friendlyBytes,
+	}, base+cacheTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheServer{
+		Logger:    l,
+		Cache:     c,
+		Accounts:  accounts,
+		PageSize:  pageSize,
+		secretKey: secretKey,
+		tpl:       tpl,
+	}, nil
+}
+
+type cacheData struct {
+	Stats cache.Stats
+	// The front page entries warmed by CacheCommonQueries, by resource name,
+	// prefixed with the account name if there's more than one account.
+	// Missing if the entry isn't in the cache.
+	FrontPages map[string]*cache.EntryInfo
+	Largest    []*cache.EntryInfo
+	// The number of entries removed by the last purge, or -1 if we didn't
+	// just purge anything.
+	Purged int
+	// Sent with each purge form.
+	CSRFToken string
+}
+
+func (c *cacheData) Title() string {
+	return "Cache"
+}
+
+// HitRate returns the percentage of lookups that found a value.
+func (c *cacheData) HitRate() string {
+	total := c.Stats.Hits + c.Stats.Stale + c.Stats.Misses + c.Stats.Expired
+	if total == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(100*float64(c.Stats.Hits+c.Stats.Stale)/float64(total), 'f', 1, 64) + "%"
+}
+
+// friendlyBytes formats n as a number of bytes, kilobytes or megabytes.
+func friendlyBytes(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return strconv.FormatFloat(float64(n)/(1024*1024), 'f', 1, 64) + " MB"
+	case n >= 1024:
+		return strconv.FormatFloat(float64(n)/1024, 'f', 1, 64) + " KB"
+	default:
+		return strconv.FormatInt(n, 10) + " bytes"
+	}
+}
+
+type cacheResponse struct {
+	*cacheStatsResponse
+	Largest []*cacheEntryResponse `json:"largest"`
+}
+
+type cacheEntryResponse struct {
+	Key        string  `json:"key"`
+	Bytes      int64   `json:"bytes"`
+	AgeSeconds float64 `json:"age_seconds"`
+	TTLSeconds float64 `json:"ttl_seconds"`
+}
+
+func (s *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.IsAdmin() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	largest, err := s.Cache.Largest(largestKeysCount)
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	stats := s.Cache.Stats()
+	if wantsJSON(r) {
+		resp := &cacheResponse{
+			cacheStatsResponse: newCacheStatsResponse(stats),
+			Largest:            make([]*cacheEntryResponse, len(largest)),
+		}
+		for i, info := range largest {
+			resp.Largest[i] = &cacheEntryResponse{
+				Key:        info.Key,
+				Bytes:      info.Bytes,
+				AgeSeconds: info.Age.Seconds(),
+				TTLSeconds: info.TTL.Seconds(),
+			}
+		}
+		if err := renderJSON(w, http.StatusOK, resp); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	frontPages := make(map[string]*cache.EntryInfo)
+	for _, a := range s.Accounts {
+		for typ, key := range views.FrontPageCacheKeys(a.AccountSid, s.PageSize) {
+			info, err := s.Cache.Peek(key)
+			if err != nil {
+				continue
+			}
+			if len(s.Accounts) > 1 {
+				typ = a.Name + " " + typ
+			}
+			frontPages[typ] = info
+		}
+	}
+	data := &cacheData{
+		Stats:      stats,
+		FrontPages: frontPages,
+		Largest:    largest,
+		Purged:     -1,
+		CSRFToken:  newCSRFToken(u, s.secretKey),
+	}
+	if purged := r.URL.Query().Get("purged"); purged != "" {
+		if n, err := strconv.Atoi(purged); err == nil && n >= 0 {
+			data.Purged = n
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", &baseData{Data: data}); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+// cachePurgeServer removes values from the cache: a single key, every key with
+// a prefix, or everything.
+type cachePurgeServer struct {
+	log.Logger
+	Cache     *cache.Cache
+	secretKey *[32]byte
+}
+
+func (s *cachePurgeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.IsAdmin() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		rest.BadRequest(w, r, &rest.Error{Title: "Could not parse form"})
+		return
+	}
+	if err := checkCSRFToken(r, u, s.secretKey); err != nil {
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return
+	}
+	var count int
+	switch {
+	case r.PostForm.Get("key") != "":
+		key := r.PostForm.Get("key")
+		if _, err := s.Cache.Peek(key); err == nil {
+			count = 1
+		}
+		s.Cache.Remove(key)
+	case strings.TrimSpace(r.PostForm.Get("prefix")) != "":
+		var err error
+		count, err = s.Cache.RemovePrefix(strings.TrimSpace(r.PostForm.Get("prefix")))
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+	case r.PostForm.Get("all") == "true":
+		var err error
+		count, err = s.Cache.RemovePrefix("")
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+	default:
+		rest.BadRequest(w, r, &rest.Error{Title: "Please specify a key, a prefix, or all to purge"})
+		return
+	}
+	s.Info("Purged cache", "key", r.PostForm.Get("key"), "prefix", r.PostForm.Get("prefix"), "count", count)
+	http.Redirect(w, r, "/cache?purged="+strconv.Itoa(count), 302)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saintpete/logrole/cache"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+)
+
+// newAdminUser returns a user with every permission, including admin access.
+func newAdminUser() *config.User {
+	us := config.AllUserSettings()
+	us.IsAdmin = true
+	return config.NewUser(us)
+}
+
+func TestCachePageRequiresAdmin(t *testing.T) {
+	t.Parallel()
+	s, err := newCacheServer(dlog, cache.NewCache(1024*1024, dlog), nil, 50, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/cache", nil)
+	req = config.SetUser(req, config.DefaultUser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
+
+func TestCacheStatsRequiresAdmin(t *testing.T) {
+	t.Parallel()
+	s := &cacheStatsServer{Cache: cache.NewCache(1024*1024, dlog)}
+	req, _ := http.NewRequest("GET", "/debug/cache", nil)
+	req = config.SetUser(req, config.DefaultUser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+	req = config.SetUser(req, newAdminUser())
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("expected Code to be 200, got %d", w.Code)
+	}
+}
+
+func TestCachePurgePrefix(t *testing.T) {
+	t.Parallel()
+	c := cache.NewCache(1024*1024, dlog)
+	c.Set("messages|a", "value", time.Hour)
+	c.Set("calls|a", "value", time.Hour)
+	s := &cachePurgeServer{Logger: dlog, Cache: c, secretKey: key}
+	admin := newAdminUser()
+	body := url.Values{
+		"prefix": []string{"messages|"},
+		"csrf":   []string{newCSRFToken(admin, key)},
+	}.Encode()
+	req, _ := http.NewRequest("POST", "/cache/purge", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = config.SetUser(req, admin)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 302 {
+		t.Errorf("expected Code to be 302, got %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "/cache?purged=1" {
+		t.Errorf("expected redirect to /cache?purged=1, got %s", loc)
+	}
+	if entries := c.Stats().Entries; entries != 1 {
+		t.Errorf("expected 1 entry left in the cache, got %d", entries)
+	}
+}
+
+func TestCachePurgeRequiresCSRFToken(t *testing.T) {
+	t.Parallel()
+	c := cache.NewCache(1024*1024, dlog)
+	c.Set("messages|a", "value", time.Hour)
+	s := &cachePurgeServer{Logger: dlog, Cache: c, secretKey: key}
+	admin := newAdminUser()
+	for _, token := range []string{"", "bad", newCSRFToken(admin, services.NewRandomKey())} {
+		body := url.Values{"all": []string{"true"}, "csrf": []string{token}}.Encode()
+		req, _ := http.NewRequest("POST", "/cache/purge", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = config.SetUser(req, admin)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != 403 {
+			t.Errorf("token %q: expected Code to be 403, got %d", token, w.Code)
+		}
+	}
+	if entries := c.Stats().Entries; entries != 1 {
+		t.Errorf("expected the cache to be untouched, got %d entries", entries)
+	}
+}
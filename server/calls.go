@@ -47,8 +47,7 @@ func newCallListServer(l log.Logger, vc views.Client, lf services.LocationFinder
 		MaxResourceAge: maxResourceAge,
 		secretKey:      secretKey,
 	}
-	tpl, err := newTpl(template.FuncMap{
-		"is_our_pn": vc.IsTwilioNumber,
+	tpl, err := newNumberTpl(vc, template.FuncMap{
 		"min":       minFunc(cs.MaxResourceAge),
 		"max":       maxLoc,
 		"start_val": cs.StartSearchVal,
@@ -75,9 +74,7 @@ func newCallInstanceServer(l log.Logger, vc views.Client,
 		Client:         vc,
 		LocationFinder: lf,
 	}
-	tpl, err := newTpl(template.FuncMap{
-		"is_our_pn": vc.IsTwilioNumber,
-	}, base+callInstanceTpl+recordingTpl+phoneTpl+sidTpl+copyScript)
+	tpl, err := newNumberTpl(vc, template.FuncMap{}, base+callInstanceTpl+recordingTpl+phoneTpl+sidTpl+copyScript)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +88,18 @@ type callInstanceData struct {
 	Recordings *recordingResp
 	AlertError error
 	Alerts     *views.AlertPage
+	// The parent of the call, and the calls it dialed, in the order they
+	// should be displayed.
+	Legs    []*views.CallLeg
+	LegsErr error
+	// The user making the request, for the "phonenumber" snippet.
+	User *config.User
+}
+
+// ShowLegs returns true if the call has a parent or children, or we couldn't
+// retrieve them.
+func (c *callInstanceData) ShowLegs() bool {
+	return c.LegsErr != nil || len(c.Legs) > 1
 }
 
 type callListData struct {
@@ -100,6 +109,12 @@ type callListData struct {
 	Loc                   *time.Location
 	Query                 url.Values
 	Err                   string
+	// Set if the search filters by a masked phone number.
+	Masked *maskedSearch
+	// Set if the search filters by a number the user sees as a pseudonym.
+	Pseudonyms *pseudonymSearch
+	// The user making the request, for the "phonenumber" snippet.
+	User *config.User
 }
 
 func (c *callListData) Title() string {
@@ -121,6 +136,21 @@ func (c *callListData) NextQuery() template.URL {
 	if end, ok := c.Query["start-before"]; ok {
 		data.Set("start-before", end[0])
 	}
+	c.Masked.addTo(data)
+	c.Pseudonyms.addTo(data)
+	return template.URL(data.Encode())
+}
+
+// ExportQuery returns the filters for the current search, for use with the
+// export page.
+func (c *callListData) ExportQuery() template.URL {
+	data := url.Values{}
+	for _, key := range []string{"from", "to", "start-after", "start-before"} {
+		if val := c.Query.Get(key); val != "" {
+			data.Set(key, val)
+		}
+	}
+	c.Pseudonyms.addTo(data)
 	return template.URL(data.Encode())
 }
 
@@ -135,6 +165,8 @@ func (c *callListData) PreviousQuery() template.URL {
 	if end, ok := c.Query["start-before"]; ok {
 		data.Set("start-before", end[0])
 	}
+	c.Masked.addTo(data)
+	c.Pseudonyms.addTo(data)
 	return template.URL(data.Encode())
 }
 
@@ -158,7 +190,7 @@ func (s *callListServer) EndSearchVal(query url.Values, loc *time.Location) stri
 }
 
 func (s *callListServer) validParams() []string {
-	return []string{"from", "to", "next", "start-after", "start-before"}
+	return []string{"from", "to", "masked-from", "masked-to", "pseudonym-from", "pseudonym-to", "next", "start-after", "start-before"}
 }
 
 func (s *callListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -185,9 +217,23 @@ func (s *callListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if wroteError {
 		return
 	}
+	masked, err := newMaskedSearch(query, s.secretKey, u.MaskedDigits())
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	if (masked.from != "" && !u.CanViewCallFrom() && !u.CanViewMaskedCallFrom()) ||
+		(masked.to != "" && !u.CanViewCallTo() && !u.CanViewMaskedCallTo()) {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	ps, err := newPseudonymSearch(query, s.secretKey, u.CanViewPseudonymousCallFrom(), u.CanViewPseudonymousCallTo())
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
 	ctx, cancel := getContext(r.Context(), 3*time.Second)
 	defer cancel()
-	var err error
 	next, nextErr := getNext(query, s.secretKey)
 	if nextErr != nil {
 		err = errors.New("Could not decrypt `next` query parameter: " + nextErr.Error())
@@ -213,8 +259,12 @@ func (s *callListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			s.renderError(w, r, http.StatusBadRequest, query, filterErr)
 			return
 		}
+		ps.setFilters(data)
+		masked.setFilters(data)
 		page, cachedAt, err = s.Client.GetCallPageInRange(ctx, u, startTime, endTime, data)
 	}
+	ps.show(query)
+	masked.hide(query)
 	if err == twilio.NoMoreResults {
 		page = new(views.CallPage)
 		err = nil
@@ -226,7 +276,7 @@ func (s *callListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Fetch the next page into the cache
 	go func(u *config.User, n types.NullString, startTime, endTime time.Time) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextCallPageInRange(context.Background(), u, startTime, endTime, n.String); err != nil {
+			if _, _, err := s.Client.GetNextCallPageInRange(backgroundContext(r), u, startTime, endTime, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
@@ -237,14 +287,25 @@ func (s *callListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	if cachedAt > 0 {
 		data.CachedDuration = monotime.Since(cachedAt)
+		data.Stale = page.Stale()
 	}
-	data.Data = &callListData{
+	cld := &callListData{
 		Page:                  page,
 		Loc:                   loc,
 		Query:                 query,
 		EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
 		EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
+		Masked:                masked,
+		Pseudonyms:            ps,
+		User:                  u,
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(page, cld.EncryptedNextPage, cld)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
 	}
+	data.Data = cld
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(200)
 	if err := render(w, r, s.tpl, "base", data); err != nil {
@@ -268,6 +329,10 @@ func (c *callListServer) renderError(w http.ResponseWriter, r *http.Request, cod
 	} else {
 		c.Warn("Error responding to request", "status", code, "url", r.URL.String(), "err", err)
 	}
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(code)
@@ -281,11 +346,44 @@ func (c *callInstanceData) Title() string {
 	return "Call Details"
 }
 
+// callInstanceResponse is the JSON representation of a call instance page.
+// Recordings, alerts and legs are omitted if the user can't view them, or we
+// couldn't retrieve them.
+type callInstanceResponse struct {
+	Call       *views.Call        `json:"call"`
+	Recordings []*views.Recording `json:"recordings,omitempty"`
+	Alerts     *views.AlertPage   `json:"alerts,omitempty"`
+	Legs       []*views.CallLeg   `json:"legs,omitempty"`
+	// Keyed by recording sid.
+	Transcriptions map[string][]*views.Transcription `json:"transcriptions,omitempty"`
+}
+
+func newCallInstanceResponse(data *callInstanceData) *callInstanceResponse {
+	resp := &callInstanceResponse{Call: data.Call}
+	if data.Recordings != nil && data.Recordings.Err == nil {
+		resp.Recordings = data.Recordings.Recordings
+		if data.Recordings.TranscriptionsErr == nil {
+			resp.Transcriptions = data.Recordings.Transcriptions
+		}
+	}
+	if data.AlertError == nil && data.Call.CanViewCallAlerts() {
+		resp.Alerts = data.Alerts
+	}
+	if data.LegsErr == nil && len(data.Legs) > 1 {
+		resp.Legs = data.Legs
+	}
+	return resp
+}
+
 type recordingResp struct {
 	Err                  error
 	Recordings           []*views.Recording
 	CanPlayRecording     bool
 	CanViewNumRecordings bool
+	// Transcriptions of each recording, keyed by recording sid.
+	Transcriptions        map[string][]*views.Transcription
+	TranscriptionsErr     error
+	CanViewTranscriptions bool
 }
 
 func (c *callInstanceServer) fetchRecordings(ctx context.Context, sid string, u *config.User, rch chan<- *recordingResp) {
@@ -322,11 +420,16 @@ func (c *callInstanceServer) fetchRecordings(ctx context.Context, sid string, u
 			break
 		}
 	}
-	rch <- &recordingResp{
-		Recordings:           rs,
-		CanPlayRecording:     canPlayRecording,
-		CanViewNumRecordings: u.CanViewNumRecordings(),
+	resp := &recordingResp{
+		Recordings:            rs,
+		CanPlayRecording:      canPlayRecording,
+		CanViewNumRecordings:  u.CanViewNumRecordings(),
+		CanViewTranscriptions: u.CanViewTranscriptions(),
 	}
+	if canPlayRecording && u.CanViewTranscriptions() && len(rs) > 0 {
+		resp.Transcriptions, resp.TranscriptionsErr = c.Client.GetTranscriptionsForRecordings(ctx, u, rs)
+	}
+	rch <- resp
 }
 
 func (c *callInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -356,6 +459,9 @@ func (c *callInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch err {
 	case nil:
 		break
+	case config.ErrOutOfScope:
+		rest.NotFound(w, r)
+		return
 	case config.PermissionDenied, config.ErrTooOld:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
@@ -373,6 +479,10 @@ func (c *callInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	legs, legsErr := c.Client.GetCallLegs(ctx, u, call)
+	if legsErr != nil {
+		c.Warn("Could not fetch call legs", "sid", sid, "err", legsErr)
+	}
 	alertsErr := g.Wait()
 	data := &baseData{
 		LF:       c.LocationFinder,
@@ -383,11 +493,20 @@ func (c *callInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Loc:        c.LocationFinder.GetLocationReq(r),
 		AlertError: alertsErr,
 		Alerts:     alerts,
+		Legs:       legs,
+		LegsErr:    legsErr,
+		User:       u,
 	}
 	if u.CanViewNumRecordings() {
 		r := <-rch
 		cid.Recordings = r
 	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newCallInstanceResponse(cid)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	data.Data = cid
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := render(w, r, c.tpl, "base", data); err != nil {
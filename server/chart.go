@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+)
+
+// A chartBar is one bar in a bar chart.
+type chartBar struct {
+	// Shown when the user hovers over the bar.
+	Label string
+	Value float64
+	// If set, the bar links to Href.
+	Href string
+}
+
+// A chartSegment is one part of a bar in a stacked bar chart.
+type chartSegment struct {
+	// Shown when the user hovers over the segment.
+	Label string
+	Value float64
+	// Added to the segment's class, so segments can have different colors.
+	Class string
+	// If set, the segment links to Href.
+	Href string
+}
+
+// A stackedBar is one bar in a stacked bar chart. Segments are drawn from the
+// bottom of the bar up.
+type stackedBar struct {
+	// Shown when the user hovers over the bar.
+	Label string
+	// If set, the whole bar links to Href, and the segment links are ignored.
+	Href     string
+	Segments []chartSegment
+}
+
+func (b stackedBar) total() float64 {
+	var total float64
+	for _, s := range b.Segments {
+		total += s.Value
+	}
+	return total
+}
+
+// barChart renders bars as an SVG bar chart, width by height pixels. Bars are
+// scaled so the tallest bar fills the chart.
+func barChart(bars []chartBar, width, height int) template.HTML {
+	stacked := make([]stackedBar, len(bars))
+	for i, b := range bars {
+		stacked[i] = stackedBar{
+			Label:    b.Label,
+			Href:     b.Href,
+			Segments: []chartSegment{{Value: b.Value}},
+		}
+	}
+	return stackedBarChart(stacked, width, height)
+}
+
+// stackedBarChart renders bars as an SVG stacked bar chart, width by height
+// pixels. Bars are scaled so the tallest bar fills the chart. Empty segments
+// are not drawn.
+func stackedBarChart(bars []stackedBar, width, height int) template.HTML {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg class="chart" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		width, height, width, height)
+	var max float64
+	for _, b := range bars {
+		if total := b.total(); total > max {
+			max = total
+		}
+	}
+	if len(bars) > 0 {
+		barWidth := float64(width) / float64(len(bars))
+		gap := 0.0
+		if barWidth > 4 {
+			gap = 1
+		}
+		for i, b := range bars {
+			if b.Href != "" {
+				fmt.Fprintf(buf, `<a href="%s">`, template.HTMLEscapeString(b.Href))
+			}
+			// Draw the full height of the chart so every bar can be hovered
+			// over, even if it's empty.
+			fmt.Fprintf(buf, `<g><title>%s</title><rect class="chart-bg" x="%.1f" y="0" width="%.1f" height="%d"></rect>`,
+				template.HTMLEscapeString(b.Label),
+				float64(i)*barWidth, barWidth, height)
+			y := float64(height)
+			for _, s := range b.Segments {
+				if s.Value <= 0 {
+					continue
+				}
+				h := 0.0
+				if max > 0 {
+					h = s.Value / max * float64(height)
+				}
+				y -= h
+				class := "chart-bar"
+				if s.Class != "" {
+					class += " " + s.Class
+				}
+				link := s.Href != "" && b.Href == ""
+				if link {
+					fmt.Fprintf(buf, `<a href="%s">`, template.HTMLEscapeString(s.Href))
+				}
+				fmt.Fprintf(buf, `<rect class="%s" x="%.1f" y="%.1f" width="%.1f" height="%.1f">`,
+					template.HTMLEscapeString(class),
+					float64(i)*barWidth+gap, y, barWidth-2*gap, h)
+				if s.Label != "" {
+					fmt.Fprintf(buf, `<title>%s</title>`, template.HTMLEscapeString(s.Label))
+				}
+				buf.WriteString("</rect>")
+				if link {
+					buf.WriteString("</a>")
+				}
+			}
+			buf.WriteString("</g>")
+			if b.Href != "" {
+				buf.WriteString("</a>")
+			}
+		}
+	}
+	fmt.Fprintf(buf, `<line class="chart-axis" x1="0" y1="%d" x2="%d" y2="%d"></line></svg>`, height, width, height)
+	return template.HTML(buf.String())
+}
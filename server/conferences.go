@@ -18,7 +18,6 @@ import (
 	"github.com/saintpete/logrole/services"
 	"github.com/saintpete/logrole/views"
 	twilio "github.com/saintpete/twilio-go"
-	"golang.org/x/net/context"
 )
 
 const conferencePattern = `(?P<sid>CF[a-f0-9]{32})`
@@ -66,7 +65,7 @@ func newConferenceInstanceServer(l log.Logger, vc views.Client,
 		Client:         vc,
 		LocationFinder: lf,
 	}
-	tpl, err := newTpl(template.FuncMap{}, base+conferenceInstanceTpl+sidTpl+copyScript)
+	tpl, err := newNumberTpl(vc, template.FuncMap{}, base+conferenceInstanceTpl+phoneTpl+sidTpl+copyScript)
 	if err != nil {
 		return nil, err
 	}
@@ -164,6 +163,10 @@ func (c *conferenceListServer) renderError(w http.ResponseWriter, r *http.Reques
 			Page:  new(views.ConferencePage),
 		},
 	}
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(code)
 	if err := render(w, r, c.tpl, "base", data); err != nil {
@@ -238,25 +241,33 @@ func (c *conferenceListServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	// Fetch the next page into the cache
 	go func(u *config.User, n types.NullString, start, end time.Time) {
 		if n.Valid {
-			if _, _, err := c.Client.GetNextConferencePageInRange(context.Background(), u, start, end, n.String); err != nil {
+			if _, _, err := c.Client.GetNextConferencePageInRange(backgroundContext(r), u, start, end, n.String); err != nil {
 				c.Debug("Error fetching next page", "err", err)
 			}
 		}
 	}(u, page.NextPageURI(), startTime, endTime)
+	cld := &conferenceListData{
+		Query:                 r.URL.Query(),
+		Page:                  page,
+		Loc:                   loc,
+		EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), c.secretKey),
+		EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), c.secretKey),
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(page, cld.EncryptedNextPage, cld)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	data := &baseData{
 		LF:       c.LocationFinder,
 		Duration: monotime.Since(start),
-		Data: &conferenceListData{
-			Query:                 r.URL.Query(),
-			Page:                  page,
-			Loc:                   loc,
-			EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), c.secretKey),
-			EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), c.secretKey),
-		},
+		Data:     cld,
 	}
 	if cachedAt > 0 {
 		data.CachedDuration = monotime.Since(cachedAt)
+		data.Stale = page.Stale()
 	}
 	if err = render(w, r, c.tpl, "base", data); err != nil {
 		rest.ServerError(w, r, err)
@@ -298,12 +309,34 @@ func (c *conferenceInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		}
 		return
 	}
+	var participants []*views.Participant
+	var participantsErr error
+	// Only conferences that are in progress show up in the Participants
+	// resource; completed ones come from Voice Insights.
+	if status, err := conference.Status(); err == nil && u.CanViewCalls() {
+		live := status != twilio.StatusCompleted
+		participants, participantsErr = c.Client.GetConferenceParticipants(ctx, u, sid, live)
+		if participantsErr != nil {
+			c.Warn("Could not fetch conference participants", "sid", sid, "err", participantsErr)
+		}
+	}
+	if wantsJSON(r) {
+		resp := &conferenceInstanceResponse{Conference: conference, Participants: participants}
+		if err := renderJSON(w, http.StatusOK, resp); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	data := &baseData{
 		LF:       c.LocationFinder,
 		Duration: monotime.Since(start),
 		Data: &conferenceInstanceData{
-			Conference: conference,
-			Loc:        c.LocationFinder.GetLocationReq(r),
+			Conference:      conference,
+			Participants:    participants,
+			ParticipantsErr: participantsErr,
+			CanViewCalls:    u.CanViewCalls(),
+			Loc:             c.LocationFinder.GetLocationReq(r),
+			User:            u,
 		},
 	}
 	if err := render(w, r, c.tpl, "base", data); err != nil {
@@ -311,9 +344,21 @@ func (c *conferenceInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// conferenceInstanceResponse is the JSON representation of a conference
+// instance page.
+type conferenceInstanceResponse struct {
+	Conference   *views.Conference    `json:"conference"`
+	Participants []*views.Participant `json:"participants,omitempty"`
+}
+
 type conferenceInstanceData struct {
-	Conference *views.Conference
-	Loc        *time.Location
+	Conference      *views.Conference
+	Participants    []*views.Participant
+	ParticipantsErr error
+	CanViewCalls    bool
+	Loc             *time.Location
+	// The user making the request, for the "phonenumber" snippet.
+	User *config.User
 }
 
 func (c *conferenceInstanceData) Title() string {
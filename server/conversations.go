@@ -0,0 +1,424 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+	"golang.org/x/net/context"
+)
+
+// The most pages to skip through when every message on a page was already
+// shown.
+const maxConversationSkips = 5
+
+// The most requests for media URL's to make at once.
+const maxConversationMediaFetches = 5
+
+type conversationServer struct {
+	log.Logger
+	Client             views.Client
+	LocationFinder     services.LocationFinder
+	PageSize           uint
+	ShowMediaByDefault bool
+	secretKey          *[32]byte
+	tpl                *template.Template
+}
+
+func newConversationServer(l log.Logger, vc views.Client, lf services.LocationFinder,
+	pageSize uint, smbd bool, secretKey *[32]byte) (*conversationServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+conversationTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &conversationServer{
+		Logger:             l,
+		Client:             vc,
+		LocationFinder:     lf,
+		PageSize:           pageSize,
+		ShowMediaByDefault: smbd,
+		secretKey:          secretKey,
+		tpl:                tpl,
+	}, nil
+}
+
+// A conversationCursor is the position of one direction of a conversation.
+type conversationCursor struct {
+	// The page to fetch, or the empty string for the first page.
+	Page string `json:"page,omitempty"`
+	// Messages created at or after Before were shown on a newer page.
+	Before time.Time `json:"before"`
+	// True if every message in this direction has been shown.
+	Done bool `json:"done,omitempty"`
+}
+
+// conversationCursors are encrypted and sent as the "next" query parameter,
+// so we can page back through both directions together.
+type conversationCursors struct {
+	AB conversationCursor `json:"ab"`
+	BA conversationCursor `json:"ba"`
+}
+
+// A conversationEntry is one message in a conversation.
+type conversationEntry struct {
+	Message *views.Message `json:"message"`
+	// "a" or "b"
+	Sender string `json:"sender"`
+	// Media URL's, behind the image proxy. Only fetched if the server shows
+	// media by default.
+	Media    []string `json:"media,omitempty"`
+	MediaErr error    `json:"-"`
+	created  time.Time
+}
+
+// FromB returns true if the message was sent by the second number.
+func (e *conversationEntry) FromB() bool {
+	return e.Sender == "b"
+}
+
+type entriesByDateCreated []*conversationEntry
+
+func (e entriesByDateCreated) Len() int      { return len(e) }
+func (e entriesByDateCreated) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e entriesByDateCreated) Less(i, j int) bool {
+	return e[i].created.Before(e[j].created)
+}
+
+type conversationData struct {
+	Err               string
+	A                 twilio.PhoneNumber
+	B                 twilio.PhoneNumber
+	Query             url.Values
+	Entries           []*conversationEntry
+	Loc               *time.Location
+	EncryptedNextPage string
+	ShowMedia         bool
+}
+
+func (d *conversationData) Title() string {
+	return "Conversation"
+}
+
+func (d *conversationData) Path() string {
+	return "/conversations"
+}
+
+func (d *conversationData) NextQuery() template.URL {
+	data := url.Values{}
+	data.Set("a", string(d.A))
+	data.Set("b", string(d.B))
+	if d.EncryptedNextPage != "" {
+		data.Set("next", d.EncryptedNextPage)
+	}
+	return template.URL(data.Encode())
+}
+
+func (s *conversationServer) validParams() []string {
+	return []string{"a", "b", "next"}
+}
+
+func (s *conversationServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	str := cleanError(err)
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
+	data := &baseData{
+		LF: s.LocationFinder,
+		Data: &conversationData{
+			Err:   str,
+			Query: query,
+			Loc:   s.LocationFinder.GetLocationReq(r),
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+// conversationSide is the part of a page of messages in one direction that
+// hasn't been shown yet.
+type conversationSide struct {
+	// The page the messages came from, or the empty string for the first
+	// page.
+	page     string
+	next     string
+	entries  []*conversationEntry
+	cursor   conversationCursor
+	finished bool
+}
+
+// oldest returns the creation time of the oldest message in the side.
+func (cs *conversationSide) oldest() time.Time {
+	var t time.Time
+	for _, e := range cs.entries {
+		if t.IsZero() || e.created.Before(t) {
+			t = e.created
+		}
+	}
+	return t
+}
+
+// fetchSide retrieves the messages sent in one direction at cursor. If every
+// message on the page was already shown, it skips to the next page.
+func (s *conversationServer) fetchSide(ctx context.Context, u *config.User, filters url.Values, cursor conversationCursor, sender string) (*conversationSide, error) {
+	side := &conversationSide{page: cursor.Page, cursor: cursor}
+	if cursor.Done {
+		side.finished = true
+		return side, nil
+	}
+	for i := 0; i < maxConversationSkips; i++ {
+		var page *views.MessagePage
+		var err error
+		if side.page == "" {
+			page, _, err = s.Client.GetMessagePageInRange(ctx, u, twilio.Epoch, twilio.HeatDeath, filters)
+		} else {
+			page, _, err = s.Client.GetNextMessagePageInRange(ctx, u, twilio.Epoch, twilio.HeatDeath, side.page)
+		}
+		if err == twilio.NoMoreResults {
+			page = new(views.MessagePage)
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		side.entries = side.entries[:0]
+		for _, m := range page.Messages() {
+			created, err := m.DateCreated()
+			if err != nil || !created.Valid {
+				continue
+			}
+			if !side.cursor.Before.IsZero() && !created.Time.Before(side.cursor.Before) {
+				continue
+			}
+			side.entries = append(side.entries, &conversationEntry{
+				Message: m,
+				Sender:  sender,
+				created: created.Time,
+			})
+		}
+		if n := page.NextPageURI(); n.Valid {
+			side.next = n.String
+		} else {
+			side.next = ""
+			side.finished = true
+		}
+		if len(side.entries) > 0 || side.finished {
+			return side, nil
+		}
+		side.page = side.next
+		side.cursor = conversationCursor{Page: side.next}
+	}
+	return side, nil
+}
+
+// mergeConversation returns the messages from ab and ba that can be shown
+// together, oldest first, and the cursors for the page of older messages.
+// Messages older than the oldest message on a page that has more pages after
+// it are held back, because we haven't fetched the messages sent in the other
+// direction at the same time.
+func mergeConversation(ab, ba *conversationSide) ([]*conversationEntry, conversationCursors) {
+	var cutoff time.Time
+	for _, side := range []*conversationSide{ab, ba} {
+		if side.finished || len(side.entries) == 0 {
+			continue
+		}
+		if oldest := side.oldest(); oldest.After(cutoff) {
+			cutoff = oldest
+		}
+	}
+	entries := make([]*conversationEntry, 0, len(ab.entries)+len(ba.entries))
+	var cursors [2]conversationCursor
+	for i, side := range []*conversationSide{ab, ba} {
+		heldBack := false
+		for _, e := range side.entries {
+			if e.created.Before(cutoff) {
+				heldBack = true
+				continue
+			}
+			entries = append(entries, e)
+		}
+		switch {
+		case heldBack:
+			// Show the rest of this page next time.
+			cursors[i] = conversationCursor{Page: side.page, Before: cutoff}
+		case side.finished:
+			cursors[i] = conversationCursor{Done: true}
+		default:
+			cursors[i] = conversationCursor{Page: side.next}
+		}
+	}
+	sort.Stable(entriesByDateCreated(entries))
+	return entries, conversationCursors{AB: cursors[0], BA: cursors[1]}
+}
+
+// getConversationCursors decrypts the "next" query parameter.
+func (s *conversationServer) getConversationCursors(query url.Values) (conversationCursors, error) {
+	var cursors conversationCursors
+	next, err := getNext(query, s.secretKey)
+	if err != nil {
+		return cursors, errors.New("Could not decrypt `next` query parameter: " + err.Error())
+	}
+	if next == "" {
+		return cursors, nil
+	}
+	if err := json.Unmarshal([]byte(next), &cursors); err != nil {
+		return cursors, errors.New("Invalid `next` query parameter")
+	}
+	for _, c := range []conversationCursor{cursors.AB, cursors.BA} {
+		if c.Page != "" && !strings.HasPrefix(c.Page, "/"+twilio.APIVersion) {
+			return cursors, errors.New("Invalid next page uri")
+		}
+	}
+	return cursors, nil
+}
+
+// getMedia fetches the media URL's for every entry with media, a few at a
+// time.
+func (s *conversationServer) getMedia(ctx context.Context, u *config.User, entries []*conversationEntry) {
+	sem := make(chan bool, maxConversationMediaFetches)
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		if !e.Message.CanViewMedia() {
+			continue
+		}
+		if numMedia, err := e.Message.NumMedia(); err != nil || numMedia == 0 {
+			continue
+		}
+		sid, err := e.Message.Sid()
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(e *conversationEntry, sid string) {
+			defer wg.Done()
+			sem <- true
+			urls, err := s.Client.GetMediaURLs(ctx, u, sid)
+			<-sem
+			if err != nil {
+				e.MediaErr = err
+				return
+			}
+			for _, mu := range urls {
+				e.Media = append(e.Media, mu.String())
+			}
+		}(e, sid)
+	}
+	wg.Wait()
+}
+
+func (s *conversationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewMessages() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	if query.Get("a") == "" || query.Get("b") == "" {
+		s.renderError(w, r, http.StatusBadRequest, query, errors.New("Enter two phone numbers to see the messages between them"))
+		return
+	}
+	a, err := twilio.NewPhoneNumber(query.Get("a"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	b, err := twilio.NewPhoneNumber(query.Get("b"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	query.Set("a", string(a))
+	query.Set("b", string(b))
+	cursors, err := s.getConversationCursors(query)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 5*time.Second)
+	defer cancel()
+	start := monotime.Now()
+	pageSize := strconv.FormatUint(uint64(s.PageSize), 10)
+	abFilters := url.Values{"From": []string{string(a)}, "To": []string{string(b)}, "PageSize": []string{pageSize}}
+	baFilters := url.Values{"From": []string{string(b)}, "To": []string{string(a)}, "PageSize": []string{pageSize}}
+	var ab, ba *conversationSide
+	var abErr, baErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ab, abErr = s.fetchSide(ctx, u, abFilters, cursors.AB, "a")
+	}()
+	go func() {
+		defer wg.Done()
+		ba, baErr = s.fetchSide(ctx, u, baFilters, cursors.BA, "b")
+	}()
+	wg.Wait()
+	if abErr != nil {
+		rest.ServerError(w, r, abErr)
+		return
+	}
+	if baErr != nil {
+		rest.ServerError(w, r, baErr)
+		return
+	}
+	entries, next := mergeConversation(ab, ba)
+	cd := &conversationData{
+		A:         a,
+		B:         b,
+		Query:     query,
+		Entries:   entries,
+		Loc:       s.LocationFinder.GetLocationReq(r),
+		ShowMedia: s.ShowMediaByDefault,
+	}
+	if !next.AB.Done || !next.BA.Done {
+		nextBytes, err := json.Marshal(next)
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+		cd.EncryptedNextPage = services.Opaque(string(nextBytes), s.secretKey)
+	}
+	if s.ShowMediaByDefault && u.CanViewMedia() {
+		s.getMedia(ctx, u, entries)
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(entries, cd.EncryptedNextPage, cd)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data:     cd,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/test/harness"
+)
+
+func conversationEntries(sender string, now time.Time, minutesAgo ...int) []*conversationEntry {
+	entries := make([]*conversationEntry, len(minutesAgo))
+	for i, m := range minutesAgo {
+		entries[i] = &conversationEntry{
+			Sender:  sender,
+			created: now.Add(-time.Duration(m) * time.Minute),
+		}
+	}
+	return entries
+}
+
+func TestMergeConversationHoldsBackOlderMessages(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	ab := &conversationSide{
+		next:    "/2010-04-01/Accounts/AC123/Messages.json?Page=1",
+		entries: conversationEntries("a", now, 2, 4, 6),
+	}
+	ba := &conversationSide{
+		next:    "/2010-04-01/Accounts/AC123/Messages.json?Page=1&From=b",
+		entries: conversationEntries("b", now, 1, 3),
+	}
+	entries, cursors := mergeConversation(ab, ba)
+	// The oldest message from b was sent 3 minutes ago, so we don't know
+	// whether b sent anything between 3 and 6 minutes ago.
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	wantSenders := []string{"b", "a", "b"}
+	for i, e := range entries {
+		if e.Sender != wantSenders[i] {
+			t.Errorf("entry %d: expected sender %s, got %s", i, wantSenders[i], e.Sender)
+		}
+		if i > 0 && e.created.Before(entries[i-1].created) {
+			t.Errorf("expected entries to be sorted oldest first")
+		}
+	}
+	if cursors.AB.Page != "" || !cursors.AB.Before.Equal(now.Add(-3*time.Minute)) {
+		t.Errorf("expected to show the rest of the first page from a, got %#v", cursors.AB)
+	}
+	if cursors.BA.Page != ba.next || !cursors.BA.Before.IsZero() || cursors.BA.Done {
+		t.Errorf("expected to fetch the next page from b, got %#v", cursors.BA)
+	}
+}
+
+func TestMergeConversationFinished(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	ab := &conversationSide{entries: conversationEntries("a", now, 2, 10), finished: true}
+	ba := &conversationSide{entries: conversationEntries("b", now, 1), finished: true}
+	entries, cursors := mergeConversation(ab, ba)
+	if len(entries) != 3 {
+		t.Errorf("expected every entry to be shown, got %d", len(entries))
+	}
+	if !cursors.AB.Done || !cursors.BA.Done {
+		t.Errorf("expected both directions to be done, got %#v", cursors)
+	}
+}
+
+func TestUnauthorizedUserCantViewConversation(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newConversationServer(dlog, vc, lf, 50, true, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/conversations?a=+14105551234&b=+19253920364", nil)
+	us := config.AllUserSettings()
+	us.CanViewMessages = false
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+func TestConversationRequiresTwoNumbers(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newConversationServer(dlog, vc, lf, 50, true, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/conversations?a=%2B14105551234", nil)
+	req = config.SetUser(req, config.NewUser(config.AllUserSettings()))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected to get 400, got %d", w.Code)
+	}
+}
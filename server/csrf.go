@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+)
+
+// How long a form can sit open in a browser before it has to be reloaded.
+const csrfTokenAge = 12 * time.Hour
+
+// The name of the form field holding the CSRF token.
+const csrfField = "csrf"
+
+var errInvalidCSRFToken = errors.New("This form is invalid or has expired. Please reload the page and try again")
+
+// newCSRFToken returns a token to put in a form that changes state on behalf
+// of u. The token is the time and the user's identity, encrypted with the
+// secret key, so another site can't make one, and one user's token won't work
+// for another user.
+func newCSRFToken(u *config.User, secretKey *[32]byte) string {
+	return services.Opaque(strconv.FormatInt(time.Now().Unix(), 10)+"|"+u.ID(), secretKey)
+}
+
+// checkCSRFToken returns an error if r's form doesn't have a valid CSRF token
+// for u. Call r.ParseForm first. Requests authenticated with an API token
+// don't need a CSRF token, because the browser won't add the token to a
+// request made by another site.
+func checkCSRFToken(r *http.Request, u *config.User, secretKey *[32]byte) error {
+	if u.FromAPIToken() {
+		return nil
+	}
+	token := r.PostForm.Get(csrfField)
+	if token == "" {
+		return errInvalidCSRFToken
+	}
+	val, err := services.Unopaque(token, secretKey)
+	if err != nil {
+		return errInvalidCSRFToken
+	}
+	parts := strings.SplitN(val, "|", 2)
+	if len(parts) != 2 || parts[1] != u.ID() {
+		return errInvalidCSRFToken
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return errInvalidCSRFToken
+	}
+	if time.Since(time.Unix(ts, 0)) > csrfTokenAge {
+		return errInvalidCSRFToken
+	}
+	return nil
+}
@@ -33,6 +33,10 @@ func (e *errorServer) Serve401(w http.ResponseWriter, r *http.Request) {
 	domain := rest.CtxDomain(r)
 	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, domain))
 
+	if wantsJSON(r) {
+		renderJSONError(w, 401, "Unauthorized")
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(401)
 	if err := render(w, r, e.tpl, "base", data); err != nil {
@@ -58,6 +62,10 @@ func (e *errorServer) Serve403(w http.ResponseWriter, r *http.Request) {
 		Description: "You don't have permission to access this page. If you think something is broken, please report a problem.",
 		Mailto:      e.Mailto,
 	}}
+	if wantsJSON(r) {
+		renderJSONError(w, 403, "Forbidden")
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(403)
 	if err := render(w, r, e.tpl, "base", data); err != nil {
@@ -71,6 +79,10 @@ func (e *errorServer) Serve404(w http.ResponseWriter, r *http.Request) {
 		Description: "Oops, the page you're looking for does not exist. You may want to head back to the homepage. If you think something is broken, report a problem.",
 		Mailto:      e.Mailto,
 	}}
+	if wantsJSON(r) {
+		renderJSONError(w, 404, "Page Not Found")
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(404)
 	if err := render(w, r, e.tpl, "base", data); err != nil {
@@ -84,6 +96,10 @@ func (e *errorServer) Serve405(w http.ResponseWriter, r *http.Request) {
 		Description: fmt.Sprintf("You can't make a %s request to this page.", r.Method),
 		Mailto:      e.Mailto,
 	}}
+	if wantsJSON(r) {
+		renderJSONError(w, 405, "Method not allowed")
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(405)
 	if err := render(w, r, e.tpl, "base", data); err != nil {
@@ -102,6 +118,10 @@ func (e *errorServer) Serve500(w http.ResponseWriter, r *http.Request) {
 	if e.Reporter != nil {
 		e.Reporter.ReportError(err, false)
 	}
+	if wantsJSON(r) {
+		renderJSONError(w, 500, "Server Error")
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(500)
 	if err := render(w, r, e.tpl, "base", data); err != nil {
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+	"golang.org/x/net/context"
+)
+
+var messageExportRoute = regexp.MustCompile(`^/messages/export$`)
+var callExportRoute = regexp.MustCompile(`^/calls/export$`)
+
+// The largest page size the Twilio API allows; fewer pages means fewer round
+// trips for a big export.
+const exportPageSize = 1000
+
+// exportTimeout is the longest we'll spend walking pages for one export. It's
+// shorter than the server's WriteTimeout, and longer than the timeout we set
+// on every other request, so we don't use the request's Context.
+const exportTimeout = 50 * time.Second
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// exportWriter writes one resource at a time, in either CSV or JSON Lines
+// format.
+type exportWriter struct {
+	w   io.Writer
+	csv *csv.Writer
+	enc *json.Encoder
+}
+
+func newExportWriter(w http.ResponseWriter, format string, filename string) *exportWriter {
+	ew := &exportWriter{w: w}
+	switch format {
+	case formatJSONL:
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		ew.enc = json.NewEncoder(w)
+	default:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		ew.csv = csv.NewWriter(w)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	return ew
+}
+
+// Header writes the CSV header row. It's a no-op for JSON Lines.
+func (ew *exportWriter) Header(header []string) error {
+	if ew.csv == nil {
+		return nil
+	}
+	return ew.csv.Write(header)
+}
+
+// Write writes a single resource. v is serialized as JSON, or record is
+// written as a CSV row.
+func (ew *exportWriter) Write(v interface{}, record []string) error {
+	if ew.csv == nil {
+		return ew.enc.Encode(v)
+	}
+	return ew.csv.Write(record)
+}
+
+// Flush sends everything written so far to the client, so large exports start
+// downloading right away.
+func (ew *exportWriter) Flush() error {
+	if ew.csv != nil {
+		ew.csv.Flush()
+		if err := ew.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := ew.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func getExportFormat(query url.Values) (string, error) {
+	switch format := query.Get("format"); format {
+	case "", formatCSV:
+		return formatCSV, nil
+	case formatJSONL:
+		return formatJSONL, nil
+	default:
+		return "", fmt.Errorf(`Unknown export format "%s"`, format)
+	}
+}
+
+func renderExportError(l log.Logger, w http.ResponseWriter, r *http.Request, code int, err error) {
+	l.Warn("Error responding to request", "status", code, "url", r.URL.String(), "err", err)
+	if code >= 500 {
+		rest.ServerError(w, r, err)
+		return
+	}
+	rest.BadRequest(w, r, &rest.Error{Title: cleanError(err)})
+}
+
+type messageExportServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	// Used to decrypt the numbers behind pseudonyms.
+	secretKey *[32]byte
+}
+
+func (s *messageExportServer) validParams() []string {
+	return []string{"start", "end", "to", "from", "pseudonym-from", "pseudonym-to", "format"}
+}
+
+func (s *messageExportServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	renderExportError(s.Logger, w, r, code, err)
+}
+
+// ServeHTTP walks every page of messages that match the filters, and streams
+// them to the client. Paging stops once we reach messages older than the
+// user's MaxResourceAge, since views.NewMessagePage drops the next page URI
+// for a page with no viewable messages.
+func (s *messageExportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewMessages() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	format, err := getExportFormat(query)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	loc := s.LocationFinder.GetLocationReq(r)
+	startTime, endTime, wroteError := getTimes(w, r, "start", "end", loc, query, s)
+	if wroteError {
+		return
+	}
+	ps, err := newPseudonymSearch(query, s.secretKey, u.CanViewPseudonymousMessageFrom(), u.CanViewPseudonymousMessageTo())
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	data := url.Values{}
+	data.Set("PageSize", strconv.Itoa(exportPageSize))
+	if filterErr := setPageFilters(query, data); filterErr != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, filterErr)
+		return
+	}
+	ps.setFilters(data)
+	ctx, cancel := context.WithTimeout(backgroundContext(r), exportTimeout)
+	defer cancel()
+	page, _, err := s.Client.GetMessagePageInRange(ctx, u, startTime, endTime, data)
+	if err == twilio.NoMoreResults {
+		page = new(views.MessagePage)
+		err = nil
+	}
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, query, err)
+		return
+	}
+	ew := newExportWriter(w, format, "messages")
+	if err := ew.Header(views.MessageExportHeader(u)); err != nil {
+		s.Warn("Error writing export", "err", err)
+		return
+	}
+	count := 0
+	for {
+		for _, message := range page.Messages() {
+			if err := ew.Write(message, message.ExportRecord()); err != nil {
+				s.Warn("Error writing export", "err", err)
+				return
+			}
+			count++
+		}
+		if err := ew.Flush(); err != nil {
+			s.Warn("Error writing export", "err", err)
+			return
+		}
+		next := page.NextPageURI()
+		if !next.Valid {
+			break
+		}
+		page, _, err = s.Client.GetNextMessagePageInRange(ctx, u, startTime, endTime, next.String)
+		if err == twilio.NoMoreResults {
+			break
+		}
+		if err != nil {
+			// We've already written a 200, so all we can do is stop.
+			s.Error("Error fetching page for export", "err", err, "count", count)
+			return
+		}
+	}
+	s.Info("Exported messages", "count", count, "format", format)
+}
+
+type callExportServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	// Used to decrypt the numbers behind pseudonyms.
+	secretKey *[32]byte
+}
+
+func (s *callExportServer) validParams() []string {
+	return []string{"start-after", "start-before", "to", "from", "pseudonym-from", "pseudonym-to", "format"}
+}
+
+func (s *callExportServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	renderExportError(s.Logger, w, r, code, err)
+}
+
+// ServeHTTP walks every page of calls that match the filters, and streams
+// them to the client. Paging stops once we reach calls older than the user's
+// MaxResourceAge.
+func (s *callExportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewCalls() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	format, err := getExportFormat(query)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	loc := s.LocationFinder.GetLocationReq(r)
+	startTime, endTime, wroteError := getTimes(w, r, "start-after", "start-before", loc, query, s)
+	if wroteError {
+		return
+	}
+	ps, err := newPseudonymSearch(query, s.secretKey, u.CanViewPseudonymousCallFrom(), u.CanViewPseudonymousCallTo())
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	data := url.Values{}
+	data.Set("PageSize", strconv.Itoa(exportPageSize))
+	if filterErr := setPageFilters(query, data); filterErr != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, filterErr)
+		return
+	}
+	ps.setFilters(data)
+	ctx, cancel := context.WithTimeout(backgroundContext(r), exportTimeout)
+	defer cancel()
+	page, _, err := s.Client.GetCallPageInRange(ctx, u, startTime, endTime, data)
+	if err == twilio.NoMoreResults {
+		page = new(views.CallPage)
+		err = nil
+	}
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, query, err)
+		return
+	}
+	ew := newExportWriter(w, format, "calls")
+	if err := ew.Header(views.CallExportHeader(u)); err != nil {
+		s.Warn("Error writing export", "err", err)
+		return
+	}
+	count := 0
+	for {
+		for _, call := range page.Calls() {
+			if err := ew.Write(call, call.ExportRecord()); err != nil {
+				s.Warn("Error writing export", "err", err)
+				return
+			}
+			count++
+		}
+		if err := ew.Flush(); err != nil {
+			s.Warn("Error writing export", "err", err)
+			return
+		}
+		next := page.NextPageURI()
+		if !next.Valid {
+			break
+		}
+		page, _, err = s.Client.GetNextCallPageInRange(ctx, u, startTime, endTime, next.String)
+		if err == twilio.NoMoreResults {
+			break
+		}
+		if err != nil {
+			s.Error("Error fetching page for export", "err", err, "count", count)
+			return
+		}
+	}
+	s.Info("Exported calls", "count", count, "format", format)
+}
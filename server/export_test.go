@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/test/harness"
+)
+
+func TestExportInvalidFormat(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s := &messageExportServer{Logger: dlog, Client: vc, LocationFinder: lf}
+	req, _ := http.NewRequest("GET", "/messages/export?format=xlsx", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected Code to be 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Unknown export format") {
+		t.Errorf("expected Body to contain error message, got %s", w.Body.String())
+	}
+}
+
+func TestExportRequiresPermission(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.CanViewCalls = false
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s := &callExportServer{Logger: dlog, Client: vc, LocationFinder: lf}
+	req, _ := http.NewRequest("GET", "/calls/export", nil)
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
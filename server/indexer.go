@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/index"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+	"golang.org/x/net/context"
+)
+
+// How often to check for new messages to add to the index.
+var indexInterval = 1 * time.Minute
+
+// The most pages of older messages to index in each crawl, so the first
+// crawl of a large account doesn't hog the API. The rest are fetched on
+// later crawls.
+const indexBackfillPages = 10
+
+// messageIndexer crawls messages in every account through a views.Client and
+// adds their bodies to an Index.
+type messageIndexer struct {
+	log.Logger
+	Client views.Client
+	Index  *index.Index
+	// The name of each account to crawl.
+	Accounts []string
+	// The crawler needs to read every message body, regardless of who ends up
+	// searching the index.
+	user *config.User
+	// The accounts where we've reached the oldest message we're allowed to
+	// view.
+	backfilled map[string]bool
+}
+
+func newMessageIndexer(l log.Logger, vc views.Client, idx *index.Index, accounts []string) *messageIndexer {
+	return &messageIndexer{
+		Logger:     l,
+		Client:     vc,
+		Index:      idx,
+		Accounts:   accounts,
+		user:       config.NewUser(config.AllUserSettings()),
+		backfilled: make(map[string]bool, len(accounts)),
+	}
+}
+
+// Run crawls for messages every indexInterval until doneCh receives a value.
+func (m *messageIndexer) Run(doneCh <-chan bool) {
+	timeout := time.After(1 * time.Millisecond)
+	for {
+		select {
+		case <-timeout:
+			for _, name := range m.Accounts {
+				// The crawler's pages are large and no one will view them,
+				// so keep them out of the page cache.
+				ctx := views.NewUncachedContext(views.NewAccountContext(context.Background(), name))
+				m.crawl(ctx, name)
+			}
+		case <-doneCh:
+			return
+		}
+		timeout = time.After(indexInterval)
+	}
+}
+
+// crawl indexes new messages in the named account, and some of the older
+// ones. ctx should name the same account (see views.NewAccountContext).
+func (m *messageIndexer) crawl(ctx context.Context, account string) {
+	oldest, newest := m.Index.Range(account)
+	empty := oldest.IsZero()
+	if !empty {
+		// Messages sent since the last crawl. There shouldn't be many, so
+		// there's no limit on the number of pages.
+		if _, err := m.crawlRange(ctx, account, newest, twilio.HeatDeath, 0); err != nil {
+			m.Warn("Error indexing new messages", "account", account, "err", err)
+			return
+		}
+	}
+	if m.backfilled[account] {
+		return
+	}
+	end := twilio.HeatDeath
+	if !empty {
+		// Messages created in the same second as the oldest one may not have
+		// been indexed yet; Add skips the ones that have.
+		end = oldest.Add(time.Second)
+	}
+	done, err := m.crawlRange(ctx, account, twilio.Epoch, end, indexBackfillPages)
+	if err != nil {
+		m.Warn("Error indexing old messages", "account", account, "err", err)
+		return
+	}
+	if done {
+		m.backfilled[account] = true
+		m.Info("Finished indexing old messages", "account", account, "count", m.Index.Len())
+	}
+}
+
+// crawlRange indexes messages between start and end, newest first. It stops
+// after maxPages pages (zero means no limit), and reports whether it reached
+// the last page.
+func (m *messageIndexer) crawlRange(ctx context.Context, account string, start, end time.Time, maxPages int) (bool, error) {
+	data := url.Values{}
+	data.Set("PageSize", strconv.Itoa(exportPageSize))
+	page, _, err := m.Client.GetMessagePageInRange(ctx, m.user, start, end, data)
+	for i := 1; ; i++ {
+		if err == twilio.NoMoreResults {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, message := range page.Messages() {
+			if err := m.add(account, message); err != nil {
+				return false, err
+			}
+		}
+		next := page.NextPageURI()
+		if !next.Valid {
+			return true, nil
+		}
+		if maxPages > 0 && i >= maxPages {
+			return false, nil
+		}
+		page, _, err = m.Client.GetNextMessagePageInRange(ctx, m.user, start, end, next.String)
+	}
+}
+
+func (m *messageIndexer) add(account string, message *views.Message) error {
+	sid, err := message.Sid()
+	if err != nil {
+		return err
+	}
+	if m.Index.Has(sid) {
+		return nil
+	}
+	created, err := message.DateCreated()
+	if err != nil {
+		return err
+	}
+	from, err := message.From()
+	if err != nil {
+		return err
+	}
+	to, err := message.To()
+	if err != nil {
+		return err
+	}
+	body, err := message.Body()
+	if err != nil {
+		return err
+	}
+	return m.Index.Add(account, sid, created.Time, string(from), string(to), body)
+}
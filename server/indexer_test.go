@@ -0,0 +1,65 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/index"
+	"github.com/saintpete/logrole/views"
+	"golang.org/x/net/context"
+)
+
+// accountMessagesClient returns a single page of messages from the account
+// named in the request context.
+type accountMessagesClient struct {
+	views.Client
+	messages map[string][]*twilio.Message
+}
+
+func (c *accountMessagesClient) GetMessagePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*views.MessagePage, uint64, error) {
+	name, _ := views.AccountFromContext(ctx)
+	mp := &twilio.MessagePage{Messages: c.messages[name]}
+	page, err := views.NewMessagePage(mp, config.NewPermission(config.DefaultMaxResourceAge), u, nil)
+	return page, 0, err
+}
+
+func TestIndexerCrawlsEveryAccount(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idx, err := index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	now := twilio.TwilioTime{Valid: true, Time: time.Now().UTC()}
+	vc := &accountMessagesClient{messages: map[string][]*twilio.Message{
+		"main":  {{Sid: "SM1", From: "+14105551234", To: "+19253920364", Body: "hello main", DateCreated: now}},
+		"other": {{Sid: "SM2", From: "+14105551234", To: "+19253920364", Body: "hello other", DateCreated: now}},
+	}}
+	m := newMessageIndexer(dlog, vc, idx, []string{"main", "other"})
+	for _, name := range m.Accounts {
+		m.crawl(views.NewAccountContext(context.Background(), name), name)
+	}
+	for name, want := range map[string][]string{"main": {"SM1"}, "other": {"SM2"}} {
+		result, err := idx.Search(index.Query{Account: name, Body: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.Sids, want) {
+			t.Errorf("account %s: expected %v, got %v", name, want, result.Sids)
+		}
+		if !m.backfilled[name] {
+			t.Errorf("expected account %s to be backfilled", name)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/kevinburke/rest"
+)
+
+// wantsJSON returns true if the client would rather get a JSON response than
+// an HTML page. Browsers send "text/html" before any wildcard, so we only
+// serve JSON when the client asks for it before anything else.
+func wantsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// renderJSON writes v to w as JSON with the given status code. Resources in
+// the views package only serialize the fields the user is allowed to see.
+func renderJSON(w http.ResponseWriter, code int, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_, err = w.Write(b)
+	return err
+}
+
+// renderJSONError writes a JSON error in the same format as the rest package.
+func renderJSONError(w http.ResponseWriter, code int, title string) {
+	renderJSON(w, code, &rest.Error{
+		Title:      title,
+		StatusCode: code,
+	})
+}
+
+// listResponse is the JSON representation of a list page. Next is the
+// encrypted cursor for the next page; pass it back as the "next" query
+// parameter, or request NextPageURI, to get the next page of results.
+type listResponse struct {
+	Resources   interface{} `json:"resources"`
+	Next        string      `json:"next,omitempty"`
+	NextPageURI string      `json:"next_page_uri,omitempty"`
+	// True if the resources came from an expired cache entry, which is being
+	// refreshed.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// pageData is implemented by every list view's data.
+type pageData interface {
+	Path() string
+	NextQuery() template.URL
+}
+
+func newListResponse(resources interface{}, encryptedNextPage string, pd pageData) *listResponse {
+	lr := &listResponse{Resources: resources}
+	if s, ok := resources.(interface {
+		Stale() bool
+	}); ok {
+		lr.Stale = s.Stale()
+	}
+	if encryptedNextPage != "" {
+		lr.Next = encryptedNextPage
+		lr.NextPageURI = pd.Path() + "?" + string(pd.NextQuery())
+	}
+	return lr
+}
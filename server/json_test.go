@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/test/harness"
+)
+
+var wantsJSONTests = []struct {
+	accept string
+	want   bool
+}{
+	{"", false},
+	{"application/json", true},
+	{"application/json; charset=utf-8", true},
+	{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+	{"*/*", false},
+	{"application/xml, application/json", true},
+}
+
+func TestWantsJSON(t *testing.T) {
+	t.Parallel()
+	for _, tt := range wantsJSONTests {
+		req, _ := http.NewRequest("GET", "/messages", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := wantsJSON(req); got != tt.want {
+			t.Errorf("wantsJSON(%q): got %t, want %t", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidNextJSON(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := services.Opaque("invalid", key)
+	req, _ := http.NewRequest("GET", "/messages?next="+enc, nil)
+	req.Header.Set("Accept", "application/json")
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected Code to be 400, got %d", w.Code)
+	}
+	if ctype := w.Header().Get("Content-Type"); ctype != "application/json; charset=utf-8" {
+		t.Errorf("expected JSON Content-Type, got %q", ctype)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["title"] != "Invalid next page uri" {
+		t.Errorf("expected title to be error message, got %v", body["title"])
+	}
+}
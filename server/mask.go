@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+)
+
+// A maskedSearch filters a list by phone numbers the user can only see part
+// of. The numbers are encrypted in the "masked-from" and "masked-to" query
+// parameters, so they never appear in the page.
+type maskedSearch struct {
+	// The encrypted numbers, as they appear in the query.
+	EncryptedFrom string
+	EncryptedTo   string
+	// The masked numbers, for display.
+	From string
+	To   string
+
+	from twilio.PhoneNumber
+	to   twilio.PhoneNumber
+}
+
+// newMaskedSearch decrypts the masked-from and masked-to parameters in query.
+// digits is the number of digits to show in the masked numbers.
+func newMaskedSearch(query url.Values, secretKey *[32]byte, digits int) (*maskedSearch, error) {
+	m := &maskedSearch{
+		EncryptedFrom: query.Get("masked-from"),
+		EncryptedTo:   query.Get("masked-to"),
+	}
+	var err error
+	if m.from, err = unmaskNumber(m.EncryptedFrom, secretKey); err != nil {
+		return nil, err
+	}
+	if m.to, err = unmaskNumber(m.EncryptedTo, secretKey); err != nil {
+		return nil, err
+	}
+	if m.from != "" {
+		m.From = views.MaskPhoneNumber(m.from, digits)
+	}
+	if m.to != "" {
+		m.To = views.MaskPhoneNumber(m.to, digits)
+	}
+	return m, nil
+}
+
+func unmaskNumber(encrypted string, secretKey *[32]byte) (twilio.PhoneNumber, error) {
+	if encrypted == "" {
+		return "", nil
+	}
+	pn, err := services.Unopaque(encrypted, secretKey)
+	if err != nil {
+		return "", errors.New("Could not decrypt masked phone number: " + err.Error())
+	}
+	return twilio.PhoneNumber(pn), nil
+}
+
+// Active reports whether the search filters by a masked number.
+func (m *maskedSearch) Active() bool {
+	return m != nil && (m.from != "" || m.to != "")
+}
+
+// setFilters sets the Twilio search filters for the masked numbers. They
+// override any unmasked "from" or "to" filter.
+func (m *maskedSearch) setFilters(pageFilters url.Values) {
+	if m.from != "" {
+		pageFilters.Set("From", string(m.from))
+	}
+	if m.to != "" {
+		pageFilters.Set("To", string(m.to))
+	}
+}
+
+// hide removes the unmasked numbers from query, so we don't render them. The
+// next page URI contains the numbers, and setNextPageValsOnQuery copies them
+// into the query.
+func (m *maskedSearch) hide(query url.Values) {
+	if m.from != "" {
+		query.Del("from")
+	}
+	if m.to != "" {
+		query.Del("to")
+	}
+}
+
+// addTo adds the masked parameters to data, so the next and previous pages
+// search for the same numbers.
+func (m *maskedSearch) addTo(data url.Values) {
+	if m == nil {
+		return
+	}
+	if m.EncryptedFrom != "" {
+		data.Set("masked-from", m.EncryptedFrom)
+	}
+	if m.EncryptedTo != "" {
+		data.Set("masked-to", m.EncryptedTo)
+	}
+}
@@ -15,10 +15,10 @@ import (
 	types "github.com/kevinburke/go-types"
 	"github.com/kevinburke/rest"
 	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/index"
 	"github.com/saintpete/logrole/services"
 	"github.com/saintpete/logrole/views"
 	twilio "github.com/saintpete/twilio-go"
-	"golang.org/x/net/context"
 )
 
 const messagePattern = `(?P<sid>(MM|SM)[a-f0-9]{32})`
@@ -40,9 +40,7 @@ func newMessageInstanceServer(l log.Logger, vc views.Client, lf services.Locatio
 		LocationFinder:     lf,
 		ShowMediaByDefault: smbd,
 	}
-	tpl, err := newTpl(template.FuncMap{
-		"is_our_pn": vc.IsTwilioNumber,
-	}, base+messageInstanceTpl+phoneTpl+sidTpl+copyScript)
+	tpl, err := newNumberTpl(vc, template.FuncMap{}, base+messageInstanceTpl+phoneTpl+sidTpl+copyScript)
 	if err != nil {
 		return nil, err
 	}
@@ -55,12 +53,31 @@ type messageInstanceData struct {
 	Loc                *time.Location
 	Media              *mediaResp
 	ShowMediaByDefault bool
+	// The user making the request, for the "phonenumber" snippet.
+	User *config.User
 }
 
 func (m *messageInstanceData) Title() string {
 	return "Message Details"
 }
 
+// messageInstanceResponse is the JSON representation of a message instance
+// page.
+type messageInstanceResponse struct {
+	Message *views.Message `json:"message"`
+	Media   []string       `json:"media,omitempty"`
+}
+
+func newMessageInstanceResponse(data *messageInstanceData) *messageInstanceResponse {
+	resp := &messageInstanceResponse{Message: data.Message}
+	if data.Media != nil && data.Media.Err == nil {
+		for _, u := range data.Media.URLs {
+			resp.Media = append(resp.Media, u.String())
+		}
+	}
+	return resp
+}
+
 type mediaResp struct {
 	Err  error
 	URLs []*url.URL
@@ -89,6 +106,9 @@ func (s *messageInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request
 	switch err {
 	case nil:
 		break
+	case config.ErrOutOfScope:
+		rest.NotFound(w, r)
+		return
 	case config.PermissionDenied, config.ErrTooOld:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
@@ -118,6 +138,7 @@ func (s *messageInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request
 		Message:            message,
 		Loc:                s.LocationFinder.GetLocationReq(r),
 		ShowMediaByDefault: s.ShowMediaByDefault,
+		User:               u,
 	}
 	numMedia, err := message.NumMedia()
 	switch {
@@ -127,6 +148,12 @@ func (s *messageInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request
 		r := <-rch
 		data.Media = r
 	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newMessageInstanceResponse(data)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	baseData.Data = data
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := render(w, r, s.tpl, "base", baseData); err != nil {
@@ -141,7 +168,9 @@ type messageListServer struct {
 	PageSize       uint
 	secretKey      *[32]byte
 	MaxResourceAge time.Duration
-	tpl            *template.Template
+	// Used to search message bodies. If nil, body search is disabled.
+	Index *index.Index
+	tpl   *template.Template
 }
 
 func (s *messageListServer) StartSearchVal(query url.Values, loc *time.Location) string {
@@ -163,7 +192,7 @@ func (s *messageListServer) EndSearchVal(query url.Values, loc *time.Location) s
 	return maxLoc(loc)
 }
 
-func newMessageListServer(l log.Logger, vc views.Client, lf services.LocationFinder, pageSize uint, maxResourceAge time.Duration, secretKey *[32]byte) (*messageListServer, error) {
+func newMessageListServer(l log.Logger, vc views.Client, lf services.LocationFinder, pageSize uint, maxResourceAge time.Duration, secretKey *[32]byte, idx *index.Index) (*messageListServer, error) {
 	s := &messageListServer{
 		Logger:         l,
 		Client:         vc,
@@ -171,9 +200,9 @@ func newMessageListServer(l log.Logger, vc views.Client, lf services.LocationFin
 		PageSize:       pageSize,
 		MaxResourceAge: maxResourceAge,
 		secretKey:      secretKey,
+		Index:          idx,
 	}
-	tpl, err := newTpl(template.FuncMap{
-		"is_our_pn": vc.IsTwilioNumber,
+	tpl, err := newNumberTpl(vc, template.FuncMap{
 		"min":       minFunc(s.MaxResourceAge),
 		"max":       maxLoc,
 		"start_val": s.StartSearchVal,
@@ -194,6 +223,16 @@ type messageListData struct {
 	Query                 url.Values
 	Err                   string
 	MaxResourceAge        time.Duration
+	// Whether to show the message body search field.
+	BodySearch bool
+	// The number of messages that matched a body search, on every page.
+	Matches int
+	// Set if the search filters by a masked phone number.
+	Masked *maskedSearch
+	// Set if the search filters by a number the user sees as a pseudonym.
+	Pseudonyms *pseudonymSearch
+	// The user making the request, for the "phonenumber" snippet.
+	User *config.User
 }
 
 func (m *messageListData) Title() string {
@@ -215,6 +254,31 @@ func (m *messageListData) NextQuery() template.URL {
 	if start, ok := m.Query["start"]; ok {
 		data.Set("start", start[0])
 	}
+	// A body search pages through the index, not a Twilio next page URI, so
+	// it needs the search terms on every page.
+	if body := m.Query.Get("body"); body != "" {
+		data.Set("body", body)
+		for _, key := range []string{"from", "to"} {
+			if val := m.Query.Get(key); val != "" {
+				data.Set(key, val)
+			}
+		}
+	}
+	m.Masked.addTo(data)
+	m.Pseudonyms.addTo(data)
+	return template.URL(data.Encode())
+}
+
+// ExportQuery returns the filters for the current search, for use with the
+// export page.
+func (m *messageListData) ExportQuery() template.URL {
+	data := url.Values{}
+	for _, key := range []string{"from", "to", "start", "end"} {
+		if val := m.Query.Get(key); val != "" {
+			data.Set(key, val)
+		}
+	}
+	m.Pseudonyms.addTo(data)
 	return template.URL(data.Encode())
 }
 
@@ -229,6 +293,8 @@ func (m *messageListData) PreviousQuery() template.URL {
 	if start, ok := m.Query["start"]; ok {
 		data.Set("start", start[0])
 	}
+	m.Masked.addTo(data)
+	m.Pseudonyms.addTo(data)
 	return template.URL(data.Encode())
 }
 
@@ -241,6 +307,7 @@ func (s *messageListServer) renderError(w http.ResponseWriter, r *http.Request,
 			Query:          query,
 			Page:           new(views.MessagePage),
 			MaxResourceAge: s.MaxResourceAge,
+			BodySearch:     s.canSearchBodies(r),
 		}}
 	if code >= 500 {
 		s.Error("Error responding to request", "status", code, "url", r.URL.String(), "err", err)
@@ -248,6 +315,10 @@ func (s *messageListServer) renderError(w http.ResponseWriter, r *http.Request,
 		s.Warn("Error responding to request", "status", code, "url", r.URL.String(), "err", err)
 	}
 
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(code)
 	if err := render(w, r, s.tpl, "base", data); err != nil {
@@ -256,7 +327,117 @@ func (s *messageListServer) renderError(w http.ResponseWriter, r *http.Request,
 }
 
 func (s *messageListServer) validParams() []string {
-	return []string{"start", "end", "next", "to", "from"}
+	return []string{"start", "end", "next", "to", "from", "masked-from", "masked-to", "pseudonym-from", "pseudonym-to", "body"}
+}
+
+// canSearchBodies reports whether the user making r can search message
+// bodies.
+func (s *messageListServer) canSearchBodies(r *http.Request) bool {
+	if s.Index == nil {
+		return false
+	}
+	u, ok := config.GetUser(r)
+	return ok && userCanSearchBodies(u)
+}
+
+// userCanSearchBodies reports whether u can search message bodies. The index
+// holds the words from the unredacted bodies, so users with redactions can't
+// search: which messages match (or how many) would reveal the text we hide
+// from them.
+func userCanSearchBodies(u *config.User) bool {
+	return u.CanViewMessageBody() && !u.HasRedactions()
+}
+
+// serveBodySearch renders a page of messages whose bodies contain every word
+// in the "body" query parameter, newest first. Matching messages are fetched
+// from Twilio, so the usual permission checks apply to each one. The "next"
+// query parameter holds the encrypted position of the last message on the
+// previous page.
+func (s *messageListServer) serveBodySearch(w http.ResponseWriter, r *http.Request, u *config.User, query url.Values, masked *maskedSearch, ps *pseudonymSearch, startTime, endTime time.Time) {
+	if s.Index == nil {
+		s.renderError(w, r, http.StatusBadRequest, query, errors.New("Searching message bodies is not enabled"))
+		return
+	}
+	if !userCanSearchBodies(u) {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	filters := url.Values{}
+	if err := setPageFilters(query, filters); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	ps.setFilters(filters)
+	masked.setFilters(filters)
+	ps.show(query)
+	after, err := getNext(query, s.secretKey)
+	if err != nil {
+		err = errors.New("Could not decrypt `next` query parameter: " + err.Error())
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	start := monotime.Now()
+	// chooseAccount stores the account for every request, and the crawler
+	// records the account of every message, so this never matches messages
+	// from an account the user can't browse.
+	account, _ := views.AccountFromContext(r.Context())
+	// Drop the messages we won't be able to show before they're counted, so
+	// the count doesn't tell the user about numbers they can't view.
+	keep := func(from string, to string, created time.Time) bool {
+		return u.CanViewResource(created, s.MaxResourceAge) &&
+			s.Client.CanViewAnyPhoneNumber(r.Context(), u, twilio.PhoneNumber(from), twilio.PhoneNumber(to))
+	}
+	result, err := s.Index.Search(index.Query{
+		Account: account,
+		Body:    query.Get("body"),
+		From:    filters.Get("From"),
+		To:      filters.Get("To"),
+		Start:   startTime,
+		End:     endTime,
+		Keep:    keep,
+		Limit:   int(s.PageSize),
+		After:   after,
+	})
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, errors.New("Invalid next page"))
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	page, err := s.Client.GetMessagesBySid(ctx, u, result.Sids)
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	mld := &messageListData{
+		Page:           page,
+		Loc:            s.LocationFinder.GetLocationReq(r),
+		Query:          query,
+		MaxResourceAge: s.MaxResourceAge,
+		BodySearch:     true,
+		Matches:        result.Total,
+		Masked:         masked,
+		Pseudonyms:     ps,
+		User:           u,
+	}
+	if result.Next != "" {
+		mld.EncryptedNextPage = services.Opaque(result.Next, s.secretKey)
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(page, mld.EncryptedNextPage, mld)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data:     mld,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, query, err)
+	}
 }
 
 func (s *messageListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -282,6 +463,25 @@ func (s *messageListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if wroteError {
 		return
 	}
+	masked, err := newMaskedSearch(query, s.secretKey, u.MaskedDigits())
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	if (masked.from != "" && !u.CanViewMessageFrom() && !u.CanViewMaskedMessageFrom()) ||
+		(masked.to != "" && !u.CanViewMessageTo() && !u.CanViewMaskedMessageTo()) {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	ps, err := newPseudonymSearch(query, s.secretKey, u.CanViewPseudonymousMessageFrom(), u.CanViewPseudonymousMessageTo())
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	if strings.TrimSpace(query.Get("body")) != "" {
+		s.serveBodySearch(w, r, u, query, masked, ps, startTime, endTime)
+		return
+	}
 	ctx, cancel := getContext(r.Context(), 3*time.Second)
 	defer cancel()
 	next, nextErr := getNext(query, s.secretKey)
@@ -309,8 +509,12 @@ func (s *messageListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			s.renderError(w, r, http.StatusBadRequest, query, filterErr)
 			return
 		}
+		ps.setFilters(data)
+		masked.setFilters(data)
 		page, cachedAt, err = s.Client.GetMessagePageInRange(ctx, u, startTime, endTime, data)
 	}
+	ps.show(query)
+	masked.hide(query)
 	if err == twilio.NoMoreResults {
 		page = new(views.MessagePage)
 		err = nil
@@ -334,24 +538,37 @@ func (s *messageListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Fetch the next page into the cache
 	go func(u *config.User, n types.NullString, start, end time.Time) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextMessagePageInRange(context.Background(), u, start, end, n.String); err != nil {
+			if _, _, err := s.Client.GetNextMessagePageInRange(backgroundContext(r), u, start, end, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
 	}(u, page.NextPageURI(), startTime, endTime)
+	mld := &messageListData{
+		Page:                  page,
+		Loc:                   loc,
+		Query:                 query,
+		MaxResourceAge:        s.MaxResourceAge,
+		EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
+		EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
+		BodySearch:            s.canSearchBodies(r),
+		Masked:                masked,
+		Pseudonyms:            ps,
+		User:                  u,
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(page, mld.EncryptedNextPage, mld)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	data := &baseData{
 		LF:       s.LocationFinder,
 		Duration: monotime.Since(start),
-		Data: &messageListData{
-			Page:                  page,
-			Loc:                   loc,
-			Query:                 query,
-			MaxResourceAge:        s.MaxResourceAge,
-			EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
-			EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
-		}}
+		Data:     mld,
+	}
 	if cachedAt > 0 {
 		data.CachedDuration = monotime.Since(cachedAt)
+		data.Stale = page.Stale()
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := render(w, r, s.tpl, "base", data); err != nil {
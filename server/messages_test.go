@@ -2,8 +2,11 @@ package server
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -11,9 +14,11 @@ import (
 	log "github.com/inconshreveable/log15"
 	twilio "github.com/saintpete/twilio-go"
 	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/index"
 	"github.com/saintpete/logrole/services"
 	"github.com/saintpete/logrole/test"
 	"github.com/saintpete/logrole/test/harness"
+	"github.com/saintpete/logrole/views"
 )
 
 var dlog = log.New()
@@ -32,7 +37,7 @@ func init() {
 func TestInvalidNext(t *testing.T) {
 	t.Parallel()
 	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
-	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key)
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -94,7 +99,7 @@ func TestNoResultsIfAllResultsOld(t *testing.T) {
 	hrns := harness.ViewHarness{TestServer: server, SecretKey: key, MaxResourceAge: age}
 	vc := harness.ViewsClient(hrns)
 	lf, _ := services.NewLocationFinder("America/Los_Angeles")
-	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key)
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -111,3 +116,260 @@ func TestNoResultsIfAllResultsOld(t *testing.T) {
 		}
 	}
 }
+
+func TestBodySearchRequiresIndex(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/messages?body=hello", nil)
+	req = config.SetUser(req, config.NewUser(config.AllUserSettings()))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected Code to be 400, got %d", w.Code)
+	}
+}
+
+func TestBodySearchRequiresBodyPermission(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idx, err := index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// theUser can't view message bodies.
+	req, _ := http.NewRequest("GET", "/messages?body=hello", nil)
+	req = config.SetUser(req, theUser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
+
+func TestBodySearchForbiddenWithRedactions(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idx, err := index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &config.Policy{&config.Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: config.AllUserSettings(),
+		Redactions:  []*config.Redaction{{Name: "codes", Pattern: `\d{6}`}},
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/messages?body=123456", nil)
+	req = config.SetUser(req, u)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
+
+func TestBodySearchNextQuery(t *testing.T) {
+	t.Parallel()
+	query := url.Values{}
+	query.Set("body", "hello")
+	query.Set("from", "+14105551234")
+	query.Set("start", "2016-10-01")
+	mld := &messageListData{Query: query, EncryptedNextPage: "abc"}
+	next, err := url.ParseQuery(string(mld.NextQuery()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"body", "from", "start"} {
+		if next.Get(key) != query.Get(key) {
+			t.Errorf("expected next page to keep %s=%q, got %q", key, query.Get(key), next.Get(key))
+		}
+	}
+	if next.Get("next") != "abc" {
+		t.Errorf("expected next page cursor, got %q", next.Get("next"))
+	}
+}
+
+func TestBodySearchRejectsInvalidCursor(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idx, err := index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := services.Opaque("/2010-04-01/Accounts/AC123/Messages.json", key)
+	req, _ := http.NewRequest("GET", "/messages?body=hello&next="+url.QueryEscape(next), nil)
+	req = config.SetUser(req, config.NewUser(config.AllUserSettings()))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected Code to be 400, got %d", w.Code)
+	}
+}
+
+func TestMaskedSearchPermissions(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{SecretKey: key})
+	s, err := newMessageListServer(dlog, vc, lf, 50, time.Hour, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us := config.AllUserSettings()
+	us.CanViewMessageFrom = false
+	uri := "/messages?masked-from=" + url.QueryEscape(services.Opaque("+14105554412", key))
+	req, _ := http.NewRequest("GET", uri, nil)
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+
+	us.CanViewMaskedMessageFrom = true
+	req, _ = http.NewRequest("GET", "/messages?masked-from=invalid", nil)
+	req = config.SetUser(req, config.NewUser(us))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected Code to be 400, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "4105554412") {
+		t.Errorf("expected page not to contain the full number, got %s", w.Body.String())
+	}
+}
+
+func TestMaskedSearchHidesNumber(t *testing.T) {
+	t.Parallel()
+	enc := services.Opaque("+14105554412", key)
+	query := url.Values{"masked-from": []string{enc}}
+	m, err := newMaskedSearch(query, key, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "+1 ••••••4412" || m.To != "" {
+		t.Errorf("expected masked sender only, got %#v", m)
+	}
+	filters := url.Values{}
+	m.setFilters(filters)
+	if filters.Get("From") != "+14105554412" {
+		t.Errorf("expected From filter to be the full number, got %q", filters.Get("From"))
+	}
+	// As set by setNextPageValsOnQuery on the next page.
+	query.Set("from", "+14105554412")
+	m.hide(query)
+	if query.Get("from") != "" {
+		t.Errorf("expected hide to remove the full number, got %q", query.Get("from"))
+	}
+	data := url.Values{}
+	m.addTo(data)
+	if data.Get("masked-from") != enc {
+		t.Errorf("expected next page to keep the masked search, got %v", data)
+	}
+}
+
+func TestPseudonymSearch(t *testing.T) {
+	t.Parallel()
+	id := services.Pseudonym("+14105559876", key)
+	us := config.AllUserSettings()
+	us.CanViewMessageFrom = false
+	us.PseudonymousNumbers = true
+	u := config.NewUser(us)
+	msg, err := views.NewMessage(&twilio.Message{
+		From:        twilio.PhoneNumber("+14105559876"),
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}, config.NewPermission(time.Hour), u, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := msg.PseudonymousFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := url.Parse(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := link.Query()
+	ps, err := newPseudonymSearch(query, key, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := url.Values{}
+	ps.setFilters(filters)
+	if filters.Get("From") != "+14105559876" {
+		t.Errorf("expected From filter to be the number, got %q", filters.Get("From"))
+	}
+	ps.show(query)
+	if query.Get("from") != "" {
+		t.Errorf("expected number to be kept out of the query, got %q", query.Get("from"))
+	}
+	if ps.From != id {
+		t.Errorf("expected to show the pseudonym %s, got %q", id, ps.From)
+	}
+	data := url.Values{}
+	ps.addTo(data)
+	if pn, err := services.Unopaque(data.Get("pseudonym-from"), key); err != nil || pn != "+14105559876" {
+		t.Errorf("expected next page to keep the encrypted number, got %q (err %v)", pn, err)
+	}
+	// As set by setNextPageValsOnQuery on the next page.
+	query = url.Values{"from": []string{"+14105559876"}, "to": []string{"+19253920364"}}
+	ps, err = newPseudonymSearch(query, key, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.show(query)
+	if query.Get("from") != "" || ps.From != id {
+		t.Errorf("expected number to be replaced by its pseudonym, got %q and %q", query.Get("from"), ps.From)
+	}
+	if query.Get("to") != "+19253920364" || ps.To != "" {
+		t.Errorf("expected visible number to be unchanged, got %q", query.Get("to"))
+	}
+
+	_, err = newPseudonymSearch(url.Values{"from": []string{id}}, key, true, false)
+	if err != errPseudonymSearch {
+		t.Errorf("expected errPseudonymSearch, got %v", err)
+	}
+	// A masked number link is encrypted with the same key, but users who
+	// don't see pseudonyms can't search with it.
+	masked := url.Values{"pseudonym-from": []string{services.Opaque("+14105559876", key)}}
+	if _, err = newPseudonymSearch(masked, key, false, false); err != errUnexpectedPseudonym {
+		t.Errorf("expected errUnexpectedPseudonym, got %v", err)
+	}
+}
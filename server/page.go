@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -118,6 +119,12 @@ func setNextPageValsOnQuery(nextpageuri string, query url.Values) {
 	if level := nq.Get("LogLevel"); level != "" {
 		query.Set("log-level", level)
 	}
+	if sid := nq.Get("CallSid"); sid != "" {
+		query.Set("call-sid", sid)
+	}
+	if sid := nq.Get("ConferenceSid"); sid != "" {
+		query.Set("conference-sid", sid)
+	}
 }
 
 // Reverse of the function above, with validation. Every list filter calls this
@@ -159,5 +166,20 @@ func setPageFilters(query url.Values, pageFilters url.Values) error {
 	if level := query.Get("log-level"); level != "" {
 		pageFilters.Set("LogLevel", level)
 	}
+	// for recordings
+	if sid := strings.TrimSpace(query.Get("call-sid")); sid != "" {
+		if !callSid.MatchString(sid) {
+			query.Del("call-sid")
+			return errors.New("Invalid call sid: " + sid)
+		}
+		pageFilters.Set("CallSid", sid)
+	}
+	if sid := strings.TrimSpace(query.Get("conference-sid")); sid != "" {
+		if !conferenceSid.MatchString(sid) {
+			query.Del("conference-sid")
+			return errors.New("Invalid conference sid: " + sid)
+		}
+		pageFilters.Set("ConferenceSid", sid)
+	}
 	return nil
 }
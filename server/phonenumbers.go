@@ -1,7 +1,6 @@
 package server
 
 import (
-	"context"
 	"errors"
 	"html/template"
 	"net/http"
@@ -19,6 +18,7 @@ import (
 	"github.com/saintpete/logrole/services"
 	"github.com/saintpete/logrole/views"
 	twilio "github.com/saintpete/twilio-go"
+	"golang.org/x/net/context"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -76,6 +76,10 @@ func (s *numberListServer) renderError(w http.ResponseWriter, r *http.Request, c
 			Page:  new(views.IncomingNumberPage),
 		},
 	}
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(code)
 	if err := render(w, r, s.tpl, "base", data); err != nil {
@@ -180,23 +184,32 @@ func (s *numberListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	go func(u *config.User, n types.NullString) {
 		if n.Valid {
-			if _, _, err := s.Client.GetNextNumberPage(context.Background(), u, n.String); err != nil {
+			if _, _, err := s.Client.GetNextNumberPage(backgroundContext(r), u, n.String); err != nil {
 				s.Debug("Error fetching next page", "err", err)
 			}
 		}
 	}(u, page.NextPageURI())
+	nld := &numberListData{
+		Page:                  page,
+		Query:                 query,
+		Loc:                   loc,
+		EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
+		EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(page, nld.EncryptedNextPage, nld)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	data := &baseData{
 		LF:       s.LocationFinder,
 		Duration: monotime.Since(start),
-		Data: &numberListData{
-			Page:                  page,
-			Query:                 query,
-			Loc:                   loc,
-			EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
-			EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
-		}}
+		Data:     nld,
+	}
 	if cachedAt > 0 {
 		data.CachedDuration = monotime.Since(cachedAt)
+		data.Stale = page.Stale()
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(200)
@@ -218,9 +231,7 @@ func newNumberInstanceServer(l log.Logger, vc views.Client, lf services.Location
 		Client:         vc,
 		LocationFinder: lf,
 	}
-	tpl, err := newTpl(template.FuncMap{
-		"is_our_pn": vc.IsTwilioNumber,
-	}, base+messageStatusTpl+messageSummaryTpl+callSummaryTpl+phoneTpl+
+	tpl, err := newNumberTpl(vc, template.FuncMap{}, base+messageStatusTpl+messageSummaryTpl+callSummaryTpl+phoneTpl+
 		numberInstanceTpl+sidTpl+copyScript)
 	if err != nil {
 		return nil, err
@@ -236,6 +247,7 @@ type msgPageLoc struct {
 	IsFrom bool
 	Loc    *time.Location
 	Number string
+	User   *config.User
 }
 
 type callPageLoc struct {
@@ -244,6 +256,7 @@ type callPageLoc struct {
 	IsFrom bool
 	Loc    *time.Location
 	Number string
+	User   *config.User
 }
 
 type numberInstanceData struct {
@@ -258,6 +271,54 @@ type numberInstanceData struct {
 	CallsFromErr string
 	CallsTo      *callPageLoc
 	CallsToErr   string
+
+	// The phone number in the URL, for links from the activity charts.
+	PN                 string
+	Window             string
+	MessageActivity    *activity
+	MessageActivityErr string
+	CallActivity       *activity
+	CallActivityErr    string
+}
+
+func (n *numberInstanceData) Windows() []string {
+	return activityWindowNames()
+}
+
+func (n *numberInstanceData) MessageChart() template.HTML {
+	return n.MessageActivity.chart("messages", "/messages", "start", "end", n.PN)
+}
+
+func (n *numberInstanceData) CallChart() template.HTML {
+	return n.CallActivity.chart("calls", "/calls", "start-after", "start-before", n.PN)
+}
+
+// numberInstanceResponse is the JSON representation of a phone number
+// instance page. Number is omitted if the number does not belong to this
+// account.
+type numberInstanceResponse struct {
+	Number       *views.IncomingNumber `json:"number,omitempty"`
+	MessagesFrom *views.MessagePage    `json:"messages_from,omitempty"`
+	MessagesTo   *views.MessagePage    `json:"messages_to,omitempty"`
+	CallsFrom    *views.CallPage       `json:"calls_from,omitempty"`
+	CallsTo      *views.CallPage       `json:"calls_to,omitempty"`
+}
+
+func newNumberInstanceResponse(data *numberInstanceData) *numberInstanceResponse {
+	resp := &numberInstanceResponse{Number: data.Number}
+	if data.SMSFrom != nil {
+		resp.MessagesFrom = data.SMSFrom.Page
+	}
+	if data.SMSTo != nil {
+		resp.MessagesTo = data.SMSTo.Page
+	}
+	if data.CallsFrom != nil {
+		resp.CallsFrom = data.CallsFrom.Page
+	}
+	if data.CallsTo != nil {
+		resp.CallsTo = data.CallsTo.Page
+	}
+	return resp
 }
 
 func (n *numberInstanceData) Title() string {
@@ -277,6 +338,9 @@ func (s *numberInstanceServer) redirectPN(w http.ResponseWriter, r *http.Request
 	switch err {
 	case nil:
 		break
+	case config.ErrOutOfScope:
+		rest.NotFound(w, r)
+		return
 	case config.PermissionDenied, config.ErrTooOld:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
@@ -314,18 +378,28 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	pn := numberInstanceRoute.FindStringSubmatch(r.URL.Path)[1]
+	window, ok := getActivityWindow(r.URL.Query().Get("window"))
+	if !ok {
+		rest.BadRequest(w, r, &rest.Error{Title: "Unknown window: " + r.URL.Query().Get("window")})
+		return
+	}
 	ctx, cancel := getContext(r.Context(), 3*time.Second)
 	defer cancel()
 	g, errctx := errgroup.WithContext(ctx)
 	loc := s.LocationFinder.GetLocationReq(r)
 	innerData := &numberInstanceData{
-		Loc: loc,
+		Loc:    loc,
+		PN:     pn,
+		Window: window.Name,
 	}
 	start := monotime.Now()
 	number, err := s.Client.GetIncomingNumberByPN(ctx, u, pn)
 	switch err {
 	case nil:
 		break
+	case config.ErrOutOfScope:
+		rest.NotFound(w, r)
+		return
 	case config.PermissionDenied, config.ErrTooOld:
 		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
 		return
@@ -359,6 +433,7 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 				IsFrom: true,
 				Loc:    loc,
 				Number: pn,
+				User:   u,
 			}
 		} else {
 			innerData.SMSFromErr = err.Error()
@@ -377,6 +452,7 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 				IsFrom: false,
 				Loc:    loc,
 				Number: pn,
+				User:   u,
 			}
 		} else {
 			innerData.SMSToErr = err.Error()
@@ -395,6 +471,7 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 				IsFrom: false,
 				Loc:    loc,
 				Number: pn,
+				User:   u,
 			}
 		} else {
 			innerData.CallsToErr = err.Error()
@@ -413,13 +490,58 @@ func (s *numberInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 				IsFrom: false,
 				Loc:    loc,
 				Number: pn,
+				User:   u,
 			}
 		} else {
 			innerData.CallsFromErr = err.Error()
 		}
 		return nil
 	})
+	// Count activity in each direction separately, so a busy number doesn't
+	// delay the counts in the other direction. The counts page through a lot
+	// of resources, so they get their own time limit, and skip the page
+	// cache so they don't evict the pages people look at.
+	actx, acancel := context.WithTimeout(r.Context(), activityTimeout)
+	defer acancel()
+	actx = views.NewUncachedContext(actx)
+	var msgActivityErrs, callActivityErrs [2]error
+	if u.CanViewMessages() {
+		innerData.MessageActivity = newActivity(window, time.Now().In(loc))
+		for i, sent := range []bool{true, false} {
+			i, sent := i, sent
+			g.Go(func() error {
+				msgActivityErrs[i] = countMessages(actx, s.Client, u, pn, sent, innerData.MessageActivity)
+				return nil
+			})
+		}
+	}
+	if u.CanViewCalls() {
+		innerData.CallActivity = newActivity(window, time.Now().In(loc))
+		for i, sent := range []bool{true, false} {
+			i, sent := i, sent
+			g.Go(func() error {
+				callActivityErrs[i] = countCalls(actx, s.Client, u, pn, sent, innerData.CallActivity)
+				return nil
+			})
+		}
+	}
 	g.Wait()
+	for _, err := range msgActivityErrs {
+		if err != nil {
+			innerData.MessageActivityErr = err.Error()
+		}
+	}
+	for _, err := range callActivityErrs {
+		if err != nil {
+			innerData.CallActivityErr = err.Error()
+		}
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newNumberInstanceResponse(innerData)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(200)
 	data := &baseData{
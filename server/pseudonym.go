@@ -0,0 +1,125 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/services"
+)
+
+var errPseudonymSearch = errors.New("To search for a customer, click their pseudonym")
+var errUnexpectedPseudonym = errors.New("You can't search by pseudonym for numbers you're allowed to see")
+
+// A pseudonymSearch filters a list by the numbers behind pseudonyms. The
+// numbers are encrypted in the "pseudonym-from" and "pseudonym-to" query
+// parameters, so they never appear in the page. It also makes sure we show
+// the user a pseudonym, not a number, if that's all they're allowed to see.
+type pseudonymSearch struct {
+	secretKey *[32]byte
+	// Whether the user sees pseudonyms in place of the sender and recipient.
+	fromPseudonym bool
+	toPseudonym   bool
+	// The encrypted numbers, set by show if the user can't see the numbers
+	// we searched for.
+	EncryptedFrom string
+	EncryptedTo   string
+	// The pseudonyms for the numbers, for display.
+	From string
+	To   string
+
+	from twilio.PhoneNumber
+	to   twilio.PhoneNumber
+}
+
+// newPseudonymSearch decrypts the pseudonym-from and pseudonym-to parameters
+// in query. A pseudonym can't be turned back into a number, so it's an error
+// to type one in the "from" or "to" parameter. The parameters are only allowed
+// for users who see pseudonyms for that number; the same key encrypts masked
+// number links, and we don't want to search for a number that's only been
+// shown masked.
+func newPseudonymSearch(query url.Values, secretKey *[32]byte, fromPseudonym, toPseudonym bool) (*pseudonymSearch, error) {
+	p := &pseudonymSearch{
+		secretKey:     secretKey,
+		fromPseudonym: fromPseudonym,
+		toPseudonym:   toPseudonym,
+	}
+	for _, key := range []string{"from", "to"} {
+		if services.IsPseudonym(strings.TrimSpace(query.Get(key))) {
+			return nil, errPseudonymSearch
+		}
+	}
+	if (query.Get("pseudonym-from") != "" && !fromPseudonym) || (query.Get("pseudonym-to") != "" && !toPseudonym) {
+		return nil, errUnexpectedPseudonym
+	}
+	var err error
+	if p.from, err = decryptPseudonymNumber(query.Get("pseudonym-from"), secretKey); err != nil {
+		return nil, err
+	}
+	if p.to, err = decryptPseudonymNumber(query.Get("pseudonym-to"), secretKey); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func decryptPseudonymNumber(encrypted string, secretKey *[32]byte) (twilio.PhoneNumber, error) {
+	if encrypted == "" {
+		return "", nil
+	}
+	pn, err := services.Unopaque(encrypted, secretKey)
+	if err != nil {
+		return "", errors.New("Could not decrypt pseudonym: " + err.Error())
+	}
+	return twilio.PhoneNumber(pn), nil
+}
+
+// setFilters sets the Twilio search filters for the numbers behind the
+// pseudonyms.
+func (p *pseudonymSearch) setFilters(pageFilters url.Values) {
+	if p.from != "" {
+		pageFilters.Set("From", string(p.from))
+	}
+	if p.to != "" {
+		pageFilters.Set("To", string(p.to))
+	}
+}
+
+// show replaces the numbers we searched for with pseudonyms, if the user can't
+// see them. The numbers are never put in query. The next page URI contains the
+// numbers, and setNextPageValsOnQuery copies them into the query, so they're
+// removed from query as well.
+func (p *pseudonymSearch) show(query url.Values) {
+	p.EncryptedFrom, p.From = p.showNumber(query, "from", p.from, p.fromPseudonym)
+	p.EncryptedTo, p.To = p.showNumber(query, "to", p.to, p.toPseudonym)
+}
+
+// showNumber returns the encrypted number and the pseudonym to show for the
+// number in the key parameter, or empty strings if the user can see it.
+func (p *pseudonymSearch) showNumber(query url.Values, key string, pn twilio.PhoneNumber, pseudonymous bool) (string, string) {
+	if !pseudonymous {
+		return "", ""
+	}
+	if pn == "" {
+		pn = twilio.PhoneNumber(query.Get(key))
+	}
+	query.Del(key)
+	if pn == "" {
+		return "", ""
+	}
+	return services.Opaque(string(pn), p.secretKey), services.Pseudonym(string(pn), p.secretKey)
+}
+
+// addTo adds the encrypted numbers to data, so other pages search for the
+// same numbers. Call show first.
+func (p *pseudonymSearch) addTo(data url.Values) {
+	if p == nil {
+		return
+	}
+	if p.EncryptedFrom != "" {
+		data.Set("pseudonym-from", p.EncryptedFrom)
+	}
+	if p.EncryptedTo != "" {
+		data.Set("pseudonym-to", p.EncryptedTo)
+	}
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	types "github.com/kevinburke/go-types"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
+)
+
+const recordingPattern = `(?P<sid>RE[a-f0-9]{32})`
+
+var recordingInstanceRoute = regexp.MustCompile("^/recordings/" + recordingPattern + "$")
+
+var errRecordingScope = errors.New("Your group can only view recordings of calls to or from some phone numbers. Search for a call sid to see its recordings")
+
+type recordingListServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	PageSize       uint
+	MaxResourceAge time.Duration
+	secretKey      *[32]byte
+	tpl            *template.Template
+}
+
+type recordingListData struct {
+	Err                   string
+	Query                 url.Values
+	Page                  *views.RecordingPage
+	Loc                   *time.Location
+	EncryptedNextPage     string
+	EncryptedPreviousPage string
+}
+
+func (d *recordingListData) Title() string {
+	return "Recordings"
+}
+
+func (d *recordingListData) Path() string {
+	return "/recordings"
+}
+
+func newRecordingListServer(l log.Logger, vc views.Client, lf services.LocationFinder,
+	pageSize uint, maxResourceAge time.Duration,
+	secretKey *[32]byte) (*recordingListServer, error) {
+	s := &recordingListServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+		PageSize:       pageSize,
+		MaxResourceAge: maxResourceAge,
+		secretKey:      secretKey,
+	}
+	tpl, err := newTpl(template.FuncMap{
+		"min":       minFunc(s.MaxResourceAge),
+		"max":       maxLoc,
+		"start_val": s.StartSearchVal,
+		"end_val":   s.EndSearchVal,
+	}, base+recordingListTpl+pagingTpl)
+	if err != nil {
+		return nil, err
+	}
+	s.tpl = tpl
+	return s, nil
+}
+
+func (d *recordingListData) NextQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedNextPage != "" {
+		data.Set("next", d.EncryptedNextPage)
+	}
+	if end, ok := d.Query["created-before"]; ok {
+		data.Set("created-before", end[0])
+	}
+	if start, ok := d.Query["created-after"]; ok {
+		data.Set("created-after", start[0])
+	}
+	return template.URL(data.Encode())
+}
+
+func (d *recordingListData) PreviousQuery() template.URL {
+	data := url.Values{}
+	if d.EncryptedPreviousPage != "" {
+		data.Set("next", d.EncryptedPreviousPage)
+	}
+	if end, ok := d.Query["created-before"]; ok {
+		data.Set("created-before", end[0])
+	}
+	if start, ok := d.Query["created-after"]; ok {
+		data.Set("created-after", start[0])
+	}
+	return template.URL(data.Encode())
+}
+
+func (s *recordingListServer) StartSearchVal(query url.Values, loc *time.Location) string {
+	if start, ok := query["created-after"]; ok {
+		return start[0]
+	}
+	if s.MaxResourceAge == config.DefaultMaxResourceAge {
+		// one week ago, arbitrary
+		return minLoc(7*24*time.Hour, loc)
+	} else {
+		return minLoc(s.MaxResourceAge, loc)
+	}
+}
+
+func (s *recordingListServer) EndSearchVal(query url.Values, loc *time.Location) string {
+	if end, ok := query["created-before"]; ok {
+		return end[0]
+	}
+	return maxLoc(loc)
+}
+
+func (s *recordingListServer) renderError(w http.ResponseWriter, r *http.Request, code int, query url.Values, err error) {
+	str := cleanError(err)
+	data := &baseData{
+		LF: s.LocationFinder,
+		Data: &recordingListData{
+			Err:   str,
+			Query: query,
+			Loc:   s.LocationFinder.GetLocationReq(r),
+			Page:  new(views.RecordingPage),
+		},
+	}
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+}
+
+func (s *recordingListServer) validParams() []string {
+	return []string{"call-sid", "conference-sid", "next", "created-after", "created-before"}
+}
+
+func (s *recordingListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanPlayRecordings() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	loc := s.LocationFinder.GetLocationReq(r)
+	// We always set startTime and endTime on the request, though they may end
+	// up just being sentinels
+	startTime, endTime, wroteError := getTimes(w, r, "created-after", "created-before", loc, query, s)
+	if wroteError {
+		return
+	}
+	next, nextErr := getNext(query, s.secretKey)
+	if nextErr != nil {
+		err := errors.New("Could not decrypt `next` query parameter: " + nextErr.Error())
+		s.renderError(w, r, http.StatusBadRequest, query, err)
+		return
+	}
+	// valid values: https://www.twilio.com/docs/api/rest/recording#list
+	filters := url.Values{}
+	if next != "" {
+		if !strings.HasPrefix(next, "/"+twilio.APIVersion) {
+			s.Warn("Invalid next page URI", "next", next, "opaque", query.Get("next"))
+			s.renderError(w, r, http.StatusBadRequest, query, errors.New("Invalid next page uri"))
+			return
+		}
+		setNextPageValsOnQuery(next, query)
+	} else {
+		filters.Set("PageSize", strconv.FormatUint(uint64(s.PageSize), 10))
+		if filterErr := setPageFilters(query, filters); filterErr != nil {
+			s.renderError(w, r, http.StatusBadRequest, query, filterErr)
+			return
+		}
+	}
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	if u.HasPhoneNumberScope() {
+		// We can't tell which numbers a recording belongs to without
+		// fetching its call, so only show the recordings for a single call.
+		sid := query.Get("call-sid")
+		if sid == "" {
+			s.renderError(w, r, http.StatusForbidden, query, errRecordingScope)
+			return
+		}
+		if _, err := s.Client.GetCall(ctx, u, sid); err != nil {
+			s.renderError(w, r, http.StatusForbidden, query, errRecordingScope)
+			return
+		}
+	}
+	var page *views.RecordingPage
+	var cachedAt uint64
+	var err error
+	start := monotime.Now()
+	if next != "" {
+		page, cachedAt, err = s.Client.GetNextRecordingPageInRange(ctx, u, startTime, endTime, next)
+	} else {
+		page, cachedAt, err = s.Client.GetRecordingPageInRange(ctx, u, startTime, endTime, filters)
+	}
+	if err == twilio.NoMoreResults {
+		page = new(views.RecordingPage)
+		err = nil
+	}
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	// Fetch the next page into the cache
+	go func(u *config.User, n types.NullString, start, end time.Time) {
+		if n.Valid {
+			if _, _, err := s.Client.GetNextRecordingPageInRange(backgroundContext(r), u, start, end, n.String); err != nil {
+				s.Debug("Error fetching next page", "err", err)
+			}
+		}
+	}(u, page.NextPageURI(), startTime, endTime)
+	rld := &recordingListData{
+		Query:                 query,
+		Page:                  page,
+		Loc:                   loc,
+		EncryptedNextPage:     getEncryptedPage(page.NextPageURI(), s.secretKey),
+		EncryptedPreviousPage: getEncryptedPage(page.PreviousPageURI(), s.secretKey),
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, newListResponse(page, rld.EncryptedNextPage, rld)); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data:     rld,
+	}
+	if cachedAt > 0 {
+		data.CachedDuration = monotime.Since(cachedAt)
+		data.Stale = page.Stale()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+type recordingInstanceServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+}
+
+func newRecordingInstanceServer(l log.Logger, vc views.Client, lf services.LocationFinder) (*recordingInstanceServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+recordingInstanceTpl+sidTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingInstanceServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+		tpl:            tpl,
+	}, nil
+}
+
+type recordingInstanceData struct {
+	Recording             *views.Recording
+	Transcriptions        []*views.Transcription
+	TranscriptionsErr     error
+	CanViewTranscriptions bool
+	Loc                   *time.Location
+}
+
+// recordingInstanceResponse is the JSON representation of a recording
+// instance page. Transcriptions are omitted if the user can't view them, or
+// we couldn't retrieve them.
+type recordingInstanceResponse struct {
+	Recording      *views.Recording       `json:"recording"`
+	Transcriptions []*views.Transcription `json:"transcriptions,omitempty"`
+}
+
+func (d *recordingInstanceData) Title() string {
+	return "Recording Details"
+}
+
+func (s *recordingInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanPlayRecordings() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	sid := recordingInstanceRoute.FindStringSubmatch(r.URL.Path)[1]
+	start := monotime.Now()
+	recording, err := s.Client.GetRecording(ctx, u, sid)
+	switch err {
+	case nil:
+		break
+	case config.ErrOutOfScope:
+		rest.NotFound(w, r)
+		return
+	case config.PermissionDenied, config.ErrTooOld:
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return
+	default:
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.StatusCode {
+			case 404:
+				rest.NotFound(w, r)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	rid := &recordingInstanceData{
+		Recording:             recording,
+		CanViewTranscriptions: u.CanViewTranscriptions(),
+		Loc:                   s.LocationFinder.GetLocationReq(r),
+	}
+	if u.CanViewTranscriptions() {
+		var transcriptions map[string][]*views.Transcription
+		transcriptions, rid.TranscriptionsErr = s.Client.GetTranscriptionsForRecordings(ctx, u, []*views.Recording{recording})
+		rid.Transcriptions = transcriptions[sid]
+	}
+	if wantsJSON(r) {
+		resp := &recordingInstanceResponse{Recording: recording}
+		if rid.TranscriptionsErr == nil {
+			resp.Transcriptions = rid.Transcriptions
+		}
+		if err := renderJSON(w, http.StatusOK, resp); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data:     rid,
+	}
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/test/harness"
+)
+
+func TestUnauthorizedUserCantViewRecordingList(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newRecordingListServer(dlog, vc, nil, 50, config.DefaultMaxResourceAge, services.NewRandomKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/recordings", nil)
+	us := config.AllUserSettings()
+	us.CanPlayRecordings = false
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+func TestUnauthorizedUserCantViewRecording(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newRecordingInstanceServer(dlog, vc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/recordings/"+recording, nil)
+	us := config.AllUserSettings()
+	us.CanPlayRecordings = false
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+func TestRecordingListRejectsInvalidCallSid(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newRecordingListServer(dlog, vc, lf, 50, config.DefaultMaxResourceAge, services.NewRandomKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/recordings?call-sid=CA123", nil)
+	req = config.SetUser(req, config.NewUser(config.AllUserSettings()))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Errorf("expected to get 400, got %d", w.Code)
+	}
+}
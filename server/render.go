@@ -13,7 +13,10 @@ import (
 	"github.com/aristanetworks/goarista/monotime"
 	"github.com/kevinburke/handlers"
 	"github.com/saintpete/logrole/assets"
+	"github.com/saintpete/logrole/config"
 	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+	twilio "github.com/saintpete/twilio-go"
 )
 
 var base, phoneTpl, copyScript, sidTpl, messageInstanceTpl, messageListTpl,
@@ -21,7 +24,9 @@ var base, phoneTpl, copyScript, sidTpl, messageInstanceTpl, messageListTpl,
 	alertListTpl, alertInstanceTpl, numberListTpl, numberInstanceTpl,
 	indexTpl, loginTpl, recordingTpl, pagingTpl, openSearchTpl,
 	messageStatusTpl, messageSummaryTpl, callSummaryTpl, openSourceTpl,
-	errorTpl string
+	errorTpl, cacheTpl, auditTpl, tokensTpl, transcriptionInstanceTpl,
+	recordingListTpl, recordingInstanceTpl, usageTpl, conversationTpl,
+	alertSummaryTpl string
 
 func init() {
 	base = assets.MustAssetString("templates/base.html")
@@ -42,12 +47,21 @@ func init() {
 	numberInstanceTpl = assets.MustAssetString("templates/phone-numbers/instance.html")
 	alertListTpl = assets.MustAssetString("templates/alerts/list.html")
 	alertInstanceTpl = assets.MustAssetString("templates/alerts/instance.html")
+	alertSummaryTpl = assets.MustAssetString("templates/alerts/summary.html")
+	transcriptionInstanceTpl = assets.MustAssetString("templates/transcriptions/instance.html")
+	recordingListTpl = assets.MustAssetString("templates/recordings/list.html")
+	recordingInstanceTpl = assets.MustAssetString("templates/recordings/instance.html")
+	usageTpl = assets.MustAssetString("templates/usage.html")
+	conversationTpl = assets.MustAssetString("templates/conversation.html")
 	indexTpl = assets.MustAssetString("templates/index.html")
 	loginTpl = assets.MustAssetString("templates/login.html")
 	recordingTpl = assets.MustAssetString("templates/calls/recordings.html")
 	openSearchTpl = assets.MustAssetString("templates/opensearch.xml")
 	errorTpl = assets.MustAssetString("templates/errors.html")
 	openSourceTpl = assets.MustAssetString("templates/opensource.html")
+	cacheTpl = assets.MustAssetString("templates/cache.html")
+	auditTpl = assets.MustAssetString("templates/audit.html")
+	tokensTpl = assets.MustAssetString("templates/tokens.html")
 }
 
 // newTpl creates a new Template with the given base and common set of
@@ -58,6 +72,28 @@ func newTpl(mp template.FuncMap, tpls string) (*template.Template, error) {
 	return t.Parse(tpls)
 }
 
+// A phoneNumberCell is the data for the "phonenumber" snippet.
+type phoneNumberCell struct {
+	twilio.PhoneNumber
+	// True if the number is one of the account's, and the user can view
+	// resources to or from it.
+	Owned bool
+}
+
+// newNumberTpl is like newTpl, but adds a number_cell function that checks
+// phone numbers against vc. Templates pass it the user making the request,
+// so a user in a group that can only view some phone numbers only sees those
+// numbers highlighted.
+func newNumberTpl(vc views.Client, mp template.FuncMap, tpls string) (*template.Template, error) {
+	mp["number_cell"] = func(u *config.User, num twilio.PhoneNumber) *phoneNumberCell {
+		return &phoneNumberCell{
+			PhoneNumber: num,
+			Owned:       u != nil && vc.IsTwilioNumber(u, num),
+		}
+	}
+	return newTpl(mp, tpls)
+}
+
 // Shown in the copyright notice
 var year = time.Now().UTC().Year()
 
@@ -96,12 +132,21 @@ type baseData struct {
 	ReqDuration time.Duration
 	// Age of the cached response. Set to 0 to indicate request wasn't cached.
 	CachedDuration time.Duration
-	Start          uint64
-	Now            time.Time
-	Path           string
-	LoggedOut      bool
-	TZ             string
-	LF             services.LocationFinder
+	// True if the cached response expired, and is being refreshed.
+	Stale     bool
+	Start     uint64
+	Now       time.Time
+	Path      string
+	LoggedOut bool
+	TZ        string
+	LF        services.LocationFinder
+	// The Twilio account the page is for, and links to the same page in the
+	// other accounts the user can view.
+	Account  string
+	Accounts []*accountLink
+	// The logged in user, if there is one. Used to hide links to pages the
+	// user can't view.
+	User *config.User
 	// Whatever data gets sent to the child template. Should have a Title
 	// property or Title() function.
 	Data interface{}
@@ -111,6 +156,16 @@ func (bd *baseData) Version() string {
 	return Version
 }
 
+// CanPlayRecordings returns true if the user can view the recordings list.
+func (bd *baseData) CanPlayRecordings() bool {
+	return bd.User != nil && bd.User.CanPlayRecordings()
+}
+
+// CanViewUsage returns true if the user can view the usage page.
+func (bd *baseData) CanViewUsage() bool {
+	return bd.User != nil && bd.User.CanViewUsage()
+}
+
 func tzTime(now time.Time, lf services.LocationFinder, loc string) string {
 	l := lf.GetLocation(loc)
 	return services.FriendlyDate(now.In(l))
@@ -149,6 +204,13 @@ func render(w io.Writer, r *http.Request, tpl *template.Template, name string, d
 	if data.LF != nil {
 		data.TZ = data.LF.GetLocationReq(r).String()
 	}
+	if u, ok := config.GetUser(r); ok {
+		data.User = u
+	}
+	if ac, ok := getAccountChoice(r); ok {
+		data.Account = ac.Current
+		data.Accounts = ac.links(r.URL.Path)
+	}
 	b := templatePool.Get().(*bytes.Buffer)
 	defer func(buf *bytes.Buffer) {
 		buf.Reset()
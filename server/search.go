@@ -19,6 +19,8 @@ var callSid = regexp.MustCompile("^" + callPattern + "$")
 var conferenceSid = regexp.MustCompile("^" + conferencePattern + "$")
 var notificationSid = regexp.MustCompile("^" + alertPattern + "$")
 var numberSid = regexp.MustCompile("^" + numberSidPattern + "$")
+var transcriptionSid = regexp.MustCompile("^" + transcriptionPattern + "$")
+var recordingSid = regexp.MustCompile("^" + recordingPattern + "$")
 
 func (s *searchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
@@ -47,6 +49,14 @@ func (s *searchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/phone-numbers/"+q, http.StatusMovedPermanently)
 		return
 	}
+	if transcriptionSid.MatchString(q) {
+		http.Redirect(w, r, "/transcriptions/"+q, http.StatusMovedPermanently)
+		return
+	}
+	if recordingSid.MatchString(q) {
+		http.Redirect(w, r, "/recordings/"+q, http.StatusMovedPermanently)
+		return
+	}
 	num, err := twilio.NewPhoneNumber(q)
 	if err == nil && len(num) > 3 {
 		http.Redirect(w, r, "/phone-numbers/"+string(num), http.StatusFound)
@@ -10,6 +10,8 @@ const mms = "MM89a8c4a6891c53054e9cd604922bfb61"
 const call = "CA89a8c4a6891c53054e9cd604922bfb61"
 const conference = "CF89a8c4a6891c53054e9cd604922bfb61"
 const alert = "NO89a8c4a6891c53054e9cd604922bfb61"
+const transcription = "TR89a8c4a6891c53054e9cd604922bfb61"
+const recording = "RE89a8c4a6891c53054e9cd604922bfb61"
 
 var searchTests = []struct {
 	in       string
@@ -20,6 +22,8 @@ var searchTests = []struct {
 	{"/search?q=" + call, 301, "/calls/" + call},
 	{"/search?q=" + conference, 301, "/conferences/" + conference},
 	{"/search?q=" + alert, 301, "/alerts/" + alert},
+	{"/search?q=" + transcription, 301, "/transcriptions/" + transcription},
+	{"/search?q=" + recording, 301, "/recordings/" + recording},
 	{"/search?", 302, "/"},
 	{"/search?q=unknown", 302, "/"},
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/kevinburke/handlers"
 	"github.com/kevinburke/rest"
 	"github.com/saintpete/logrole/assets"
+	"github.com/saintpete/logrole/cache"
 	"github.com/saintpete/logrole/config"
 	"github.com/saintpete/logrole/services"
 	"github.com/saintpete/logrole/views"
@@ -132,7 +133,8 @@ func (i *indexData) Title() string {
 
 func (i *indexServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	data := &baseData{Data: &indexData{}}
+	u, _ := config.GetUser(r)
+	data := &baseData{Data: &indexData{baseData: baseData{User: u}}}
 	if err := render(w, r, i.tpl, "base", data); err != nil {
 		rest.ServerError(w, r, err)
 	}
@@ -170,12 +172,15 @@ func (o *openSourceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type Server struct {
 	http.Handler
 	vc       views.Client
+	indexer  *messageIndexer
 	DoneChan chan bool
 	PageSize uint
 }
 
+// Close stops any background work started by CacheCommonQueries or
+// IndexMessages.
 func (s *Server) Close() error {
-	s.DoneChan <- true
+	close(s.DoneChan)
 	return nil
 }
 
@@ -183,9 +188,19 @@ func (s *Server) CacheCommonQueries() {
 	go s.vc.CacheCommonQueries(s.PageSize, s.DoneChan)
 }
 
+// IndexMessages starts adding message bodies to the message index in the
+// background. It's a no-op if no index is configured.
+func (s *Server) IndexMessages() {
+	if s.indexer != nil {
+		go s.indexer.Run(s.DoneChan)
+	}
+}
+
 type loginData struct {
 	baseData
 	URL string
+	// The name of the service the user logs in with, for example "Google".
+	Provider string
 }
 
 func (l *loginData) Title() string {
@@ -206,7 +221,7 @@ func newLoginServer() (*loginServer, error) {
 	}, nil
 }
 
-func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string) {
+func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string, provider string) {
 	if r.URL.Path != "/login" {
 		http.Redirect(w, r, "/login?g="+r.URL.Path, 302)
 		return
@@ -215,7 +230,8 @@ func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string)
 		LoggedOut: true,
 	}
 	bd.Data = &loginData{
-		URL: URL,
+		URL:      URL,
+		Provider: provider,
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(401)
@@ -228,16 +244,19 @@ func (ls *loginServer) Serve(w http.ResponseWriter, r *http.Request, URL string)
 // authentication is successful, we set the User in the request context and
 // continue.
 func AddAuthenticator(h http.Handler, ls *loginServer, a config.Authenticator) http.Handler {
-	// TODO
-	o, ok := a.(*config.GoogleAuthenticator)
+	o, ok := a.(config.OAuthAuthenticator)
+	if t, isToken := a.(*config.TokenAuthenticator); isToken {
+		o, ok = t.Authenticator.(config.OAuthAuthenticator)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		u, err := a.Authenticate(w, r)
 		if err == config.MustLogin {
-			var url string
+			var url, provider string
 			if ok {
 				url = o.URL(w, r)
+				provider = o.Provider()
 			}
-			ls.Serve(w, r, url)
+			ls.Serve(w, r, url, provider)
 			return
 		}
 		if err != nil {
@@ -269,10 +288,41 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	if settings.Logger == nil {
 		return nil, errors.New("Please configure a non-nil Logger")
 	}
-	permission := config.NewPermission(settings.MaxResourceAge)
-	vc := views.NewClient(settings.Logger, settings.Client, settings.SecretKey, permission)
+	accounts := settings.Accounts
+	if len(accounts) == 0 {
+		accounts = []*config.Account{{Name: config.DefaultAccountName, Client: settings.Client}}
+	}
+	var c *cache.Cache
+	if settings.CacheStore == nil {
+		c = cache.NewCache(config.DefaultCacheSizeMB*1024*1024, settings.Logger)
+	} else {
+		c = cache.NewCacheFromStore(settings.CacheStore, settings.Logger)
+	}
+	c.StaleGracePeriod = settings.CacheStaleGracePeriod
+	// Each account gets its own Permission, since it stores the account's
+	// phone number Sids. They share a cache; the cache keys include the
+	// Account Sid.
+	names := make([]string, len(accounts))
+	vcs := make([]*views.Account, len(accounts))
+	for i, a := range accounts {
+		l := settings.Logger
+		if len(accounts) > 1 {
+			l = l.New("account", a.Name)
+		}
+		permission := config.NewPermission(settings.MaxResourceAge)
+		names[i] = a.Name
+		vcs[i] = &views.Account{
+			Name:   a.Name,
+			Client: views.NewClientWithCache(l, a.Client, settings.SecretKey, permission, c),
+		}
+		if a.Client != nil {
+			vcs[i].AccountSid = a.Client.AccountSid
+		}
+	}
+	vc := views.NewAccountClient(vcs)
 	mls, err := newMessageListServer(settings.Logger, vc, settings.LocationFinder,
-		settings.PageSize, settings.MaxResourceAge, settings.SecretKey)
+		settings.PageSize, settings.MaxResourceAge, settings.SecretKey,
+		settings.MessageIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -310,6 +360,33 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	asums, err := newAlertSummaryServer(settings.Logger, vc, settings.LocationFinder, settings.MaxResourceAge)
+	if err != nil {
+		return nil, err
+	}
+	tis, err := newTranscriptionInstanceServer(settings.Logger, vc, settings.LocationFinder)
+	if err != nil {
+		return nil, err
+	}
+	rls, err := newRecordingListServer(settings.Logger, vc,
+		settings.LocationFinder, settings.PageSize, settings.MaxResourceAge,
+		settings.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	ris, err := newRecordingInstanceServer(settings.Logger, vc, settings.LocationFinder)
+	if err != nil {
+		return nil, err
+	}
+	us, err := newUsageServer(settings.Logger, vc, settings.LocationFinder)
+	if err != nil {
+		return nil, err
+	}
+	convs, err := newConversationServer(settings.Logger, vc, settings.LocationFinder,
+		settings.PageSize, settings.ShowMediaByDefault, settings.SecretKey)
+	if err != nil {
+		return nil, err
+	}
 	ns, err := newNumberListServer(settings.Logger, vc, settings.LocationFinder,
 		settings.PageSize, settings.MaxResourceAge, settings.SecretKey)
 	if err != nil {
@@ -319,9 +396,30 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	mes := &messageExportServer{
+		Logger:         settings.Logger,
+		Client:         vc,
+		LocationFinder: settings.LocationFinder,
+		secretKey:      settings.SecretKey,
+	}
+	ces := &callExportServer{
+		Logger:         settings.Logger,
+		Client:         vc,
+		LocationFinder: settings.LocationFinder,
+		secretKey:      settings.SecretKey,
+	}
 	ss := &searchServer{
 		Logger: settings.Logger,
 	}
+	cs, err := newCacheServer(settings.Logger, c, vcs, settings.PageSize, settings.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	cps := &cachePurgeServer{
+		Logger:    settings.Logger,
+		Cache:     c,
+		secretKey: settings.SecretKey,
+	}
 	o, err := newOpenSearchServer(settings.PublicHost, settings.AllowUnencryptedTraffic)
 	if err != nil {
 		return nil, err
@@ -375,16 +473,48 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	authR.Handle(regexp.MustCompile(`^/search$`), []string{"GET"}, ss)
 	authR.Handle(regexp.MustCompile(`^/calls$`), []string{"GET"}, cls)
 	authR.Handle(regexp.MustCompile(`^/conferences$`), []string{"GET"}, confs)
+	authR.Handle(regexp.MustCompile(`^/recordings$`), []string{"GET"}, rls)
+	authR.Handle(regexp.MustCompile(`^/usage$`), []string{"GET"}, us)
+	authR.Handle(regexp.MustCompile(`^/conversations$`), []string{"GET"}, convs)
 	authR.Handle(regexp.MustCompile(`^/phone-numbers$`), []string{"GET"}, ns)
 	authR.Handle(regexp.MustCompile(`^/messages$`), []string{"GET"}, mls)
 	authR.Handle(regexp.MustCompile(`^/alerts$`), []string{"GET"}, als)
+	authR.Handle(alertSummaryRoute, []string{"GET"}, asums)
 	authR.Handle(regexp.MustCompile(`^/tz$`), []string{"POST"}, tz)
+	authR.Handle(messageExportRoute, []string{"GET"}, mes)
+	authR.Handle(cacheStatsRoute, []string{"GET"}, &cacheStatsServer{Cache: c})
+	authR.Handle(cacheRoute, []string{"GET"}, cs)
+	authR.Handle(cachePurgeRoute, []string{"POST"}, cps)
+	if settings.AuditLog != nil {
+		as, err := newAuditServer(settings.Logger, settings.AuditLog, settings.LocationFinder)
+		if err != nil {
+			return nil, err
+		}
+		authR.Handle(auditRoute, []string{"GET"}, as)
+	}
+	if settings.APITokens != nil {
+		ts, err := newTokenServer(settings.Logger, settings.APITokens, settings.LocationFinder, settings.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		authR.Handle(tokensRoute, []string{"GET", "POST"}, ts)
+		authR.Handle(tokenRevokeRoute, []string{"POST"}, &tokenRevokeServer{
+			Logger:    settings.Logger,
+			Store:     settings.APITokens,
+			secretKey: settings.SecretKey,
+		})
+	}
+	authR.Handle(callExportRoute, []string{"GET"}, ces)
 	authR.Handle(alertInstanceRoute, []string{"GET"}, ais)
 	authR.Handle(numberInstanceRoute, []string{"GET"}, nis)
 	authR.Handle(conferenceInstanceRoute, []string{"GET"}, confInstance)
 	authR.Handle(callInstanceRoute, []string{"GET"}, cis)
 	authR.Handle(messageInstanceRoute, []string{"GET"}, mis)
-	authH := AddAuthenticator(authR, ls, settings.Authenticator)
+	authR.Handle(transcriptionInstanceRoute, []string{"GET"}, tis)
+	authR.Handle(recordingInstanceRoute, []string{"GET"}, ris)
+	authH := recordAccess(authR, settings.Logger, settings.AuditLog, settings.SecretKey)
+	authH = chooseAccount(authH, names, settings.AllowUnencryptedTraffic)
+	authH = AddAuthenticator(authH, ls, settings.Authenticator)
 	authH = handlers.WithLogger(authH, settings.Logger)
 	if len(settings.IPSubnets) > 0 {
 		authH = whitelistIPs(authH, settings.Logger, settings.IPSubnets)
@@ -407,10 +537,14 @@ func NewServer(settings *config.Settings) (*Server, error) {
 	h = handlers.WithTimeout(h, 32*time.Second)
 	h = settings.Reporter.ReportPanics(h)
 	h = handlers.Duration(h)
-	return &Server{
+	srv := &Server{
 		Handler:  h,
 		PageSize: settings.PageSize,
 		vc:       vc,
 		DoneChan: make(chan bool, 1),
-	}, nil
+	}
+	if settings.MessageIndex != nil {
+		srv.indexer = newMessageIndexer(settings.Logger, vc, settings.MessageIndex, names)
+	}
+	return srv, nil
 }
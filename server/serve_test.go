@@ -1,14 +1,18 @@
 package server
 
 import (
+	"bytes"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	log "github.com/inconshreveable/log15"
+	twilio "github.com/saintpete/twilio-go"
 	"github.com/saintpete/logrole/config"
 	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
 )
 
 func TestRequestsUpgraded(t *testing.T) {
@@ -60,6 +64,50 @@ func TestIndex(t *testing.T) {
 	}
 }
 
+func TestIndexHidesUsageLink(t *testing.T) {
+	t.Parallel()
+	s, err := newIndexServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, canView := range []bool{true, false} {
+		us := config.AllUserSettings()
+		us.CanViewUsage = canView
+		req, _ := http.NewRequest("GET", "/", nil)
+		req = config.SetUser(req, config.NewUser(us))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("expected Code to be 200, got %d", w.Code)
+		}
+		if got := strings.Contains(w.Body.String(), `href="/usage"`); got != canView {
+			t.Errorf("CanViewUsage %t: expected usage link to be shown: %t, got %t", canView, canView, got)
+		}
+	}
+}
+
+func TestIndexHidesRecordingsLink(t *testing.T) {
+	t.Parallel()
+	s, err := newIndexServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, canPlay := range []bool{true, false} {
+		us := config.AllUserSettings()
+		us.CanPlayRecordings = canPlay
+		req, _ := http.NewRequest("GET", "/", nil)
+		req = config.SetUser(req, config.NewUser(us))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("expected Code to be 200, got %d", w.Code)
+		}
+		if got := strings.Contains(w.Body.String(), `href="/recordings"`); got != canPlay {
+			t.Errorf("CanPlayRecordings %t: expected recordings link to be shown: %t, got %t", canPlay, canPlay, got)
+		}
+	}
+}
+
 var NullLogger = log.New()
 
 func init() {
@@ -129,3 +177,60 @@ func TestStaticPagesAvailableNoAuth(t *testing.T) {
 		t.Errorf("expected Code to be 200, got %d", w.Code)
 	}
 }
+
+// ownedNumbersClient owns every number in numbers.
+type ownedNumbersClient struct {
+	views.Client
+	numbers map[twilio.PhoneNumber]bool
+}
+
+func (c *ownedNumbersClient) IsTwilioNumber(u *config.User, num twilio.PhoneNumber) bool {
+	return c.numbers[num] && (u == nil || u.CanViewPhoneNumber(num, ""))
+}
+
+func TestNumberCellRespectsScope(t *testing.T) {
+	t.Parallel()
+	vc := &ownedNumbersClient{numbers: map[twilio.PhoneNumber]bool{"+19253920364": true, "+14105551234": true}}
+	tpl, err := newNumberTpl(vc, template.FuncMap{}, phoneTpl+`{{ define "cell" }}{{ template "phonenumber" (number_cell .User .Num) }}{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &config.Policy{&config.Group{
+		Name:         "support",
+		Users:        []string{"test@example.com"},
+		Permissions:  config.AllUserSettings(),
+		PhoneNumbers: []string{"+19253920364"},
+	}}
+	scoped, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := config.NewUser(config.AllUserSettings())
+	tests := []struct {
+		user  *config.User
+		num   twilio.PhoneNumber
+		owned bool
+	}{
+		{all, "+14105551234", true},
+		{scoped, "+19253920364", true},
+		{scoped, "+14105551234", false},
+		{all, "+14105559876", false},
+	}
+	for _, tt := range tests {
+		b := new(bytes.Buffer)
+		data := struct {
+			User *config.User
+			Num  twilio.PhoneNumber
+		}{tt.user, tt.num}
+		if err := tpl.ExecuteTemplate(b, "cell", data); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(b.String(), "owned-number"); got != tt.owned {
+			t.Errorf("%s: expected owned to be %t, got %t", tt.num, tt.owned, got)
+		}
+		// html/template escapes the "+" in the link.
+		if !strings.Contains(b.String(), `href="/phone-numbers/&#43;`+string(tt.num[1:])) {
+			t.Errorf("%s: expected a link to the number, got %s", tt.num, b.String())
+		}
+	}
+}
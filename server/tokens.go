@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"regexp"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/apitoken"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+)
+
+var tokensRoute = regexp.MustCompile(`^/settings/tokens$`)
+var tokenRevokeRoute = regexp.MustCompile(`^/settings/tokens/revoke$`)
+
+// tokenUser returns the user who's managing their tokens, or writes an error
+// and returns false. Users need an identity to own a token, and a token can't
+// be used to create or revoke tokens, so a leaked token can't be used to keep
+// access after it's revoked.
+func tokenUser(w http.ResponseWriter, r *http.Request) (*config.User, bool) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return nil, false
+	}
+	if u.ID() == "" || u.FromAPIToken() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Log in to manage API tokens"})
+		return nil, false
+	}
+	return u, true
+}
+
+// tokenServer lists the user's API tokens, and creates new ones.
+type tokenServer struct {
+	log.Logger
+	Store          apitoken.Store
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+	secretKey      *[32]byte
+}
+
+func newTokenServer(l log.Logger, store apitoken.Store, lf services.LocationFinder, secretKey *[32]byte) (*tokenServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+tokensTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenServer{
+		Logger:         l,
+		Store:          store,
+		LocationFinder: lf,
+		tpl:            tpl,
+		secretKey:      secretKey,
+	}, nil
+}
+
+type tokensData struct {
+	Tokens []*apitoken.Token
+	Loc    *time.Location
+	// The token that was just created, and its secret. Empty unless the
+	// request created a token.
+	Created   *apitoken.Token
+	Secret    string
+	CSRFToken string
+	Err       string
+}
+
+func (t *tokensData) Title() string {
+	return "API Tokens"
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := tokenUser(w, r)
+	if !ok {
+		return
+	}
+	data := &tokensData{
+		Loc:       s.LocationFinder.GetLocationReq(r),
+		CSRFToken: newCSRFToken(u, s.secretKey),
+	}
+	code := http.StatusOK
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			rest.BadRequest(w, r, &rest.Error{Title: "Could not parse form"})
+			return
+		}
+		if err := checkCSRFToken(r, u, s.secretKey); err != nil {
+			rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+			return
+		}
+		tok, secret, err := s.Store.Create(u.ID(), r.PostForm.Get("name"))
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+		s.Info("Created API token", "user", u.ID(), "id", tok.ID)
+		data.Created = tok
+		data.Secret = secret
+		code = http.StatusCreated
+	}
+	tokens, err := s.Store.List(u.ID())
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	data.Tokens = tokens
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Don't let a proxy or the browser cache the page with the secret on it.
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", &baseData{LF: s.LocationFinder, Data: data}); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
+
+// tokenRevokeServer revokes one of the user's API tokens.
+type tokenRevokeServer struct {
+	log.Logger
+	Store     apitoken.Store
+	secretKey *[32]byte
+}
+
+func (s *tokenRevokeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := tokenUser(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		rest.BadRequest(w, r, &rest.Error{Title: "Could not parse form"})
+		return
+	}
+	if err := checkCSRFToken(r, u, s.secretKey); err != nil {
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return
+	}
+	id := r.PostForm.Get("id")
+	err := s.Store.Revoke(u.ID(), id)
+	if err == apitoken.ErrNotFound {
+		rest.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+	s.Info("Revoked API token", "user", u.ID(), "id", id)
+	http.Redirect(w, r, "/settings/tokens", 302)
+}
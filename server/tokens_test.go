@@ -0,0 +1,140 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saintpete/logrole/apitoken"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+)
+
+func TestCreateAndRevokeToken(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-apitoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := apitoken.NewFileStore(filepath.Join(dir, "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newTokenServer(dlog, store, lf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &config.Policy{&config.Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: config.AllUserSettings(),
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := url.Values{
+		"name": []string{"script"},
+		"csrf": []string{newCSRFToken(u, key)},
+	}.Encode()
+	req, _ := http.NewRequest("POST", "/settings/tokens", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = config.SetUser(req, u)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("expected Code to be 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), apitoken.Prefix) {
+		t.Error("expected response to show the new token")
+	}
+	tokens, _ := store.List("test@example.com")
+	if len(tokens) != 1 {
+		t.Fatalf("expected 1 token, got %d", len(tokens))
+	}
+
+	rs := &tokenRevokeServer{Logger: dlog, Store: store, secretKey: key}
+	body = url.Values{
+		"id":   []string{tokens[0].ID},
+		"csrf": []string{newCSRFToken(u, key)},
+	}.Encode()
+	req, _ = http.NewRequest("POST", "/settings/tokens/revoke", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = config.SetUser(req, u)
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, req)
+	if w.Code != 302 {
+		t.Errorf("expected Code to be 302, got %d", w.Code)
+	}
+	if tokens, _ = store.List("test@example.com"); len(tokens) != 0 {
+		t.Errorf("expected token to be revoked, got %d tokens", len(tokens))
+	}
+}
+
+func TestTokensRequireIdentity(t *testing.T) {
+	t.Parallel()
+	s, err := newTokenServer(dlog, nil, lf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/settings/tokens", nil)
+	req = config.SetUser(req, config.DefaultUser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected Code to be 403, got %d", w.Code)
+	}
+}
+
+func TestTokenFormsRequireCSRFToken(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "logrole-apitoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := apitoken.NewFileStore(filepath.Join(dir, "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newTokenServer(dlog, store, lf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &config.Policy{&config.Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: config.AllUserSettings(),
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _, err := store.Create("test@example.com", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &tokenRevokeServer{Logger: dlog, Store: store, secretKey: key}
+	for _, csrf := range []string{"", "bad", newCSRFToken(u, services.NewRandomKey())} {
+		body := url.Values{"name": []string{"script"}, "id": []string{tok.ID}, "csrf": []string{csrf}}.Encode()
+		for _, h := range []http.Handler{s, rs} {
+			req, _ := http.NewRequest("POST", "/settings/tokens", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = config.SetUser(req, u)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != 403 {
+				t.Errorf("token %q: expected Code to be 403, got %d", csrf, w.Code)
+			}
+		}
+	}
+	if tokens, _ := store.List("test@example.com"); len(tokens) != 1 {
+		t.Errorf("expected no tokens to be created or revoked, got %d tokens", len(tokens))
+	}
+}
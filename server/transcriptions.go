@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+)
+
+const transcriptionPattern = `(?P<sid>TR[a-f0-9]{32})`
+
+var transcriptionInstanceRoute = regexp.MustCompile("^/transcriptions/" + transcriptionPattern + "$")
+
+type transcriptionInstanceServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+}
+
+func newTranscriptionInstanceServer(l log.Logger, vc views.Client, lf services.LocationFinder) (*transcriptionInstanceServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+transcriptionInstanceTpl+sidTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &transcriptionInstanceServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+		tpl:            tpl,
+	}, nil
+}
+
+type transcriptionInstanceData struct {
+	Transcription *views.Transcription
+	Loc           *time.Location
+}
+
+// transcriptionInstanceResponse is the JSON representation of a
+// transcription instance page.
+type transcriptionInstanceResponse struct {
+	Transcription *views.Transcription `json:"transcription"`
+}
+
+func (t *transcriptionInstanceData) Title() string {
+	return "Transcription Details"
+}
+
+func (s *transcriptionInstanceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanPlayRecordings() || !u.CanViewTranscriptions() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	ctx, cancel := getContext(r.Context(), 3*time.Second)
+	defer cancel()
+	sid := transcriptionInstanceRoute.FindStringSubmatch(r.URL.Path)[1]
+	start := monotime.Now()
+	transcription, err := s.Client.GetTranscription(ctx, u, sid)
+	switch err {
+	case nil:
+		break
+	case config.ErrOutOfScope:
+		rest.NotFound(w, r)
+		return
+	case config.PermissionDenied, config.ErrTooOld:
+		rest.Forbidden(w, r, &rest.Error{Title: err.Error()})
+		return
+	default:
+		switch terr := err.(type) {
+		case *rest.Error:
+			switch terr.StatusCode {
+			case 404:
+				rest.NotFound(w, r)
+			default:
+				rest.ServerError(w, r, terr)
+			}
+		default:
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, &transcriptionInstanceResponse{Transcription: transcription}); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(start),
+		Data: &transcriptionInstanceData{
+			Transcription: transcription,
+			Loc:           s.LocationFinder.GetLocationReq(r),
+		},
+	}
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
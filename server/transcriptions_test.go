@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/test/harness"
+)
+
+func TestUnauthorizedUserCantViewTranscription(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newTranscriptionInstanceServer(dlog, vc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noTranscriptions := config.AllUserSettings()
+	noTranscriptions.CanViewTranscriptions = false
+	noRecordings := config.AllUserSettings()
+	noRecordings.CanPlayRecordings = false
+	for _, us := range []*config.UserSettings{noTranscriptions, noRecordings} {
+		req, _ := http.NewRequest("GET", "/transcriptions/"+transcription, nil)
+		req = config.SetUser(req, config.NewUser(us))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != 403 {
+			t.Errorf("expected to get 403, got %d", w.Code)
+		}
+	}
+}
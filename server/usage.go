@@ -0,0 +1,239 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aristanetworks/goarista/monotime"
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"github.com/saintpete/logrole/views"
+)
+
+// The most days of daily usage to show at once. The Usage Records API returns
+// at most 1000 records in a page.
+const maxUsageDays = 366
+
+// The most months of monthly usage to show at once.
+const maxUsageMonths = 60
+
+const usageChartWidth = 720
+const usageChartHeight = 120
+
+type usageServer struct {
+	log.Logger
+	Client         views.Client
+	LocationFinder services.LocationFinder
+	tpl            *template.Template
+}
+
+func newUsageServer(l log.Logger, vc views.Client, lf services.LocationFinder) (*usageServer, error) {
+	tpl, err := newTpl(template.FuncMap{}, base+usageTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &usageServer{
+		Logger:         l,
+		Client:         vc,
+		LocationFinder: lf,
+		tpl:            tpl,
+	}, nil
+}
+
+type usageData struct {
+	Err      string
+	Usage    *views.Usage
+	Period   string
+	Category string
+	// Dates in the search form, formatted as YYYY-MM-DD.
+	StartDate string
+	EndDate   string
+	Loc       *time.Location
+}
+
+func (d *usageData) Title() string {
+	return "Usage"
+}
+
+func (d *usageData) Path() string {
+	return "/usage"
+}
+
+func (d *usageData) Periods() []string {
+	return []string{views.UsageDaily, views.UsageMonthly}
+}
+
+func (d *usageData) Categories() []string {
+	return views.UsageCategories
+}
+
+// Today returns the current date in the user's timezone.
+func (d *usageData) Today() string {
+	return time.Now().In(d.Loc).Format(views.UsageDateFormat)
+}
+
+// usageDateLabel formats the start of a usage period for a chart label.
+func usageDateLabel(t time.Time, period string) string {
+	if period == views.UsageMonthly {
+		return t.Format("Jan 2006")
+	}
+	return t.Format("Mon Jan 2, 2006")
+}
+
+// Chart returns an SVG chart of the price of each record in category.
+func (d *usageData) Chart(category string) template.HTML {
+	records := d.Usage.Records(category)
+	bars := make([]chartBar, 0, len(records))
+	for _, r := range records {
+		start, err := r.StartDate()
+		if err != nil {
+			continue
+		}
+		price, _ := r.Price()
+		friendlyPrice, _ := r.FriendlyPrice()
+		count, _ := r.Count()
+		unit, _ := r.CountUnit()
+		bars = append(bars, chartBar{
+			Label: fmt.Sprintf("%s: %s (%.0f %s)", usageDateLabel(start, d.Period), friendlyPrice, count, unit),
+			Value: price,
+		})
+	}
+	return barChart(bars, usageChartWidth, usageChartHeight)
+}
+
+// usageDates returns the first and last day of usage to show. Dates default
+// to the last 30 days, or the last 12 months, in loc.
+func usageDates(query url.Values, period string, loc *time.Location) (time.Time, time.Time, error) {
+	now := time.Now().In(loc)
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if val := strings.TrimSpace(query.Get("end-date")); val != "" {
+		var err error
+		end, err = time.Parse(views.UsageDateFormat, val)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid end date: " + val)
+		}
+	}
+	var start time.Time
+	if period == views.UsageMonthly {
+		start = time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -11, 0)
+	} else {
+		start = end.AddDate(0, 0, -29)
+	}
+	if val := strings.TrimSpace(query.Get("start-date")); val != "" {
+		var err error
+		start, err = time.Parse(views.UsageDateFormat, val)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid start date: " + val)
+		}
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, errors.New("Start date must be on or before the end date")
+	}
+	if period == views.UsageMonthly {
+		if start.AddDate(0, maxUsageMonths, 0).Before(end) {
+			return time.Time{}, time.Time{}, fmt.Errorf("Can't show more than %d months of usage at once", maxUsageMonths)
+		}
+	} else {
+		if start.AddDate(0, 0, maxUsageDays).Before(end) {
+			return time.Time{}, time.Time{}, fmt.Errorf("Can't show more than %d days of usage at once", maxUsageDays)
+		}
+	}
+	return start, end, nil
+}
+
+func (s *usageServer) validParams() []string {
+	return []string{"period", "category", "start-date", "end-date"}
+}
+
+func (s *usageServer) renderError(w http.ResponseWriter, r *http.Request, code int, ud *usageData, err error) {
+	str := cleanError(err)
+	if wantsJSON(r) {
+		renderJSONError(w, code, str)
+		return
+	}
+	ud.Err = str
+	ud.Usage = nil
+	data := &baseData{
+		LF:   s.LocationFinder,
+		Data: ud,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+		return
+	}
+}
+
+func (s *usageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := config.GetUser(r)
+	if !ok {
+		rest.ServerError(w, r, errors.New("No user available"))
+		return
+	}
+	if !u.CanViewUsage() {
+		rest.Forbidden(w, r, &rest.Error{Title: "Access denied"})
+		return
+	}
+	query := r.URL.Query()
+	ud := &usageData{
+		Period:    views.UsageDaily,
+		Category:  query.Get("category"),
+		StartDate: query.Get("start-date"),
+		EndDate:   query.Get("end-date"),
+		Loc:       s.LocationFinder.GetLocationReq(r),
+	}
+	if err := validateParams(s.validParams(), query); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, ud, err)
+		return
+	}
+	if period := query.Get("period"); period != "" {
+		if period != views.UsageDaily && period != views.UsageMonthly {
+			s.renderError(w, r, http.StatusBadRequest, ud, errors.New("Unknown period: "+period))
+			return
+		}
+		ud.Period = period
+	}
+	if ud.Category != "" && !views.ValidUsageCategory(ud.Category) {
+		s.renderError(w, r, http.StatusBadRequest, ud, errors.New("Unknown category: "+ud.Category))
+		return
+	}
+	start, end, err := usageDates(query, ud.Period, ud.Loc)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, ud, err)
+		return
+	}
+	ud.StartDate = start.Format(views.UsageDateFormat)
+	ud.EndDate = end.Format(views.UsageDateFormat)
+	ctx, cancel := getContext(r.Context(), 5*time.Second)
+	defer cancel()
+	startTime := monotime.Now()
+	usage, err := s.Client.GetUsage(ctx, u, ud.Period, ud.Category, start, end)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, ud, err)
+		return
+	}
+	ud.Usage = usage
+	if wantsJSON(r) {
+		if err := renderJSON(w, http.StatusOK, usage); err != nil {
+			rest.ServerError(w, r, err)
+		}
+		return
+	}
+	data := &baseData{
+		LF:       s.LocationFinder,
+		Duration: monotime.Since(startTime),
+		Data:     ud,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := render(w, r, s.tpl, "base", data); err != nil {
+		rest.ServerError(w, r, err)
+	}
+}
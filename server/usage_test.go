@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/test/harness"
+	"github.com/saintpete/logrole/views"
+)
+
+func TestUnauthorizedUserCantViewUsage(t *testing.T) {
+	t.Parallel()
+	vc := harness.ViewsClient(harness.ViewHarness{})
+	s, err := newUsageServer(dlog, vc, lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "/usage", nil)
+	us := config.AllUserSettings()
+	us.CanViewUsage = false
+	req = config.SetUser(req, config.NewUser(us))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("expected to get 403, got %d", w.Code)
+	}
+}
+
+var usageDatesTests = []struct {
+	query  string
+	period string
+	start  string
+	end    string
+	err    bool
+}{
+	{"start-date=2016-11-01&end-date=2016-11-30", views.UsageDaily, "2016-11-01", "2016-11-30", false},
+	{"end-date=2016-11-30", views.UsageDaily, "2016-11-01", "2016-11-30", false},
+	{"end-date=2016-11-30", views.UsageMonthly, "2015-12-01", "2016-11-30", false},
+	{"start-date=2016-12-01&end-date=2016-11-30", views.UsageDaily, "", "", true},
+	{"start-date=2014-01-01&end-date=2016-11-30", views.UsageDaily, "", "", true},
+	{"start-date=2014-01-01&end-date=2016-11-30", views.UsageMonthly, "2014-01-01", "2016-11-30", false},
+	{"start-date=11/01/2016", views.UsageDaily, "", "", true},
+}
+
+func TestUsageDates(t *testing.T) {
+	t.Parallel()
+	for _, tt := range usageDatesTests {
+		query, _ := url.ParseQuery(tt.query)
+		start, end, err := usageDates(query, tt.period, time.UTC)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got nil", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if s := start.Format(views.UsageDateFormat); s != tt.start {
+			t.Errorf("%s: expected start %s, got %s", tt.query, tt.start, s)
+		}
+		if e := end.Format(views.UsageDateFormat); e != tt.end {
+			t.Errorf("%s: expected end %s, got %s", tt.query, tt.end, e)
+		}
+	}
+}
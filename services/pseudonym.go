@@ -0,0 +1,40 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// PseudonymPrefix starts every pseudonym, so we can tell them apart from
+// phone numbers.
+const PseudonymPrefix = "cust-"
+
+// The number of bytes of the hash in a pseudonym.
+const pseudonymBytes = 4
+
+// Pseudonym returns a stable identifier for s, like "cust-7f3a9c01". It's a
+// keyed hash, so only someone with secretKey can tell which value a
+// pseudonym stands for, and it's the same on every page and after a restart.
+func Pseudonym(s string, secretKey *[32]byte) string {
+	mac := hmac.New(sha256.New, secretKey[:])
+	// Don't reuse hashes of the same value for some other purpose.
+	io.WriteString(mac, "pseudonym:")
+	io.WriteString(mac, s)
+	return PseudonymPrefix + hex.EncodeToString(mac.Sum(nil)[:pseudonymBytes])
+}
+
+// IsPseudonym reports whether s looks like a value returned by Pseudonym.
+func IsPseudonym(s string) bool {
+	if !strings.HasPrefix(s, PseudonymPrefix) {
+		return false
+	}
+	h := s[len(PseudonymPrefix):]
+	if len(h) != 2*pseudonymBytes {
+		return false
+	}
+	_, err := hex.DecodeString(h)
+	return err == nil
+}
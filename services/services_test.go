@@ -35,3 +35,26 @@ func TestTruncateSid(t *testing.T) {
 		t.Errorf("wrong answer")
 	}
 }
+
+func TestPseudonym(t *testing.T) {
+	t.Parallel()
+	key := NewRandomKey()
+	p := Pseudonym("+14105551234", key)
+	if p != Pseudonym("+14105551234", key) {
+		t.Errorf("expected Pseudonym to be stable, got %s and %s", p, Pseudonym("+14105551234", key))
+	}
+	if p == Pseudonym("+14105551235", key) {
+		t.Errorf("expected different numbers to get different pseudonyms, got %s", p)
+	}
+	if p == Pseudonym("+14105551234", NewRandomKey()) {
+		t.Errorf("expected pseudonym to depend on the key, got %s", p)
+	}
+	if !IsPseudonym(p) {
+		t.Errorf("expected %s to be a pseudonym", p)
+	}
+	for _, s := range []string{"+14105551234", "cust-", "cust-7f3a9c0", "cust-7f3a9c0z", "cust-7f3a9c01aa"} {
+		if IsPseudonym(s) {
+			t.Errorf("expected %q not to be a pseudonym", s)
+		}
+	}
+}
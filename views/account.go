@@ -0,0 +1,215 @@
+package views
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"golang.org/x/net/context"
+)
+
+type accountCtxVar int
+
+var accountKey accountCtxVar = 0
+
+// NewAccountContext returns a copy of ctx that tells the Client returned by
+// NewAccountClient to fetch resources from the account with the given name.
+func NewAccountContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, accountKey, name)
+}
+
+// AccountFromContext returns the account name stored in ctx, if one exists.
+func AccountFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(accountKey).(string)
+	return name, ok
+}
+
+// An Account is a Client for one of several Twilio accounts.
+type Account struct {
+	Name       string
+	AccountSid string
+	Client     Client
+}
+
+type accountClient struct {
+	accounts []*Account
+	byName   map[string]*Account
+}
+
+// NewAccountClient returns a Client that fetches each resource from the
+// account named in the request context (see NewAccountContext), or the first
+// account if the context doesn't name one. accounts must not be empty.
+func NewAccountClient(accounts []*Account) Client {
+	byName := make(map[string]*Account, len(accounts))
+	for _, a := range accounts {
+		byName[a.Name] = a
+	}
+	return &accountClient{accounts: accounts, byName: byName}
+}
+
+func (ac *accountClient) get(ctx context.Context) Client {
+	if name, ok := AccountFromContext(ctx); ok {
+		if a, ok := ac.byName[name]; ok {
+			return a.Client
+		}
+	}
+	return ac.accounts[0].Client
+}
+
+var accountSidPath = regexp.MustCompile(`/Accounts/(AC[a-f0-9]{32})/`)
+
+// SetBasicAuth sets the credentials for the account in the request URL, for
+// example a recording URL, or for the account in the request context if the
+// URL doesn't name one.
+func (ac *accountClient) SetBasicAuth(r *http.Request) {
+	if match := accountSidPath.FindStringSubmatch(r.URL.Path); len(match) == 2 {
+		for _, a := range ac.accounts {
+			if a.AccountSid == match[1] {
+				a.Client.SetBasicAuth(r)
+				return
+			}
+		}
+	}
+	ac.get(r.Context()).SetBasicAuth(r)
+}
+
+func (ac *accountClient) GetMessage(ctx context.Context, u *config.User, sid string) (*Message, error) {
+	return ac.get(ctx).GetMessage(ctx, u, sid)
+}
+
+func (ac *accountClient) GetMessagesBySid(ctx context.Context, u *config.User, sids []string) (*MessagePage, error) {
+	return ac.get(ctx).GetMessagesBySid(ctx, u, sids)
+}
+
+func (ac *accountClient) GetCall(ctx context.Context, u *config.User, sid string) (*Call, error) {
+	return ac.get(ctx).GetCall(ctx, u, sid)
+}
+
+func (ac *accountClient) GetCallLegs(ctx context.Context, u *config.User, call *Call) ([]*CallLeg, error) {
+	return ac.get(ctx).GetCallLegs(ctx, u, call)
+}
+
+func (ac *accountClient) GetConference(ctx context.Context, u *config.User, sid string) (*Conference, error) {
+	return ac.get(ctx).GetConference(ctx, u, sid)
+}
+
+func (ac *accountClient) GetConferenceParticipants(ctx context.Context, u *config.User, sid string, live bool) ([]*Participant, error) {
+	return ac.get(ctx).GetConferenceParticipants(ctx, u, sid, live)
+}
+
+func (ac *accountClient) GetIncomingNumber(ctx context.Context, u *config.User, sid string) (*IncomingNumber, error) {
+	return ac.get(ctx).GetIncomingNumber(ctx, u, sid)
+}
+
+func (ac *accountClient) GetIncomingNumberByPN(ctx context.Context, u *config.User, pn string) (*IncomingNumber, error) {
+	return ac.get(ctx).GetIncomingNumberByPN(ctx, u, pn)
+}
+
+func (ac *accountClient) GetAlert(ctx context.Context, u *config.User, sid string) (*Alert, error) {
+	return ac.get(ctx).GetAlert(ctx, u, sid)
+}
+
+func (ac *accountClient) GetMediaURLs(ctx context.Context, u *config.User, sid string) ([]*url.URL, error) {
+	return ac.get(ctx).GetMediaURLs(ctx, u, sid)
+}
+
+func (ac *accountClient) GetMessagePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*MessagePage, uint64, error) {
+	return ac.get(ctx).GetMessagePageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountClient) GetCallPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*CallPage, uint64, error) {
+	return ac.get(ctx).GetCallPageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountClient) GetNumberPage(ctx context.Context, u *config.User, data url.Values) (*IncomingNumberPage, uint64, error) {
+	return ac.get(ctx).GetNumberPage(ctx, u, data)
+}
+
+func (ac *accountClient) GetConferencePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*ConferencePage, uint64, error) {
+	return ac.get(ctx).GetConferencePageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountClient) GetAlertPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*AlertPage, uint64, error) {
+	return ac.get(ctx).GetAlertPageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountClient) GetNextMessagePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*MessagePage, uint64, error) {
+	return ac.get(ctx).GetNextMessagePageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountClient) GetNextNumberPage(ctx context.Context, u *config.User, nextPage string) (*IncomingNumberPage, uint64, error) {
+	return ac.get(ctx).GetNextNumberPage(ctx, u, nextPage)
+}
+
+func (ac *accountClient) GetNextCallPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*CallPage, uint64, error) {
+	return ac.get(ctx).GetNextCallPageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountClient) GetNextConferencePageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*ConferencePage, uint64, error) {
+	return ac.get(ctx).GetNextConferencePageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountClient) GetNextAlertPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*AlertPage, uint64, error) {
+	return ac.get(ctx).GetNextAlertPageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountClient) GetRecording(ctx context.Context, u *config.User, sid string) (*Recording, error) {
+	return ac.get(ctx).GetRecording(ctx, u, sid)
+}
+
+func (ac *accountClient) GetRecordingPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, data url.Values) (*RecordingPage, uint64, error) {
+	return ac.get(ctx).GetRecordingPageInRange(ctx, u, start, end, data)
+}
+
+func (ac *accountClient) GetNextRecordingPageInRange(ctx context.Context, u *config.User, start time.Time, end time.Time, nextPage string) (*RecordingPage, uint64, error) {
+	return ac.get(ctx).GetNextRecordingPageInRange(ctx, u, start, end, nextPage)
+}
+
+func (ac *accountClient) GetNextRecordingPage(ctx context.Context, u *config.User, nextPage string) (*RecordingPage, error) {
+	return ac.get(ctx).GetNextRecordingPage(ctx, u, nextPage)
+}
+
+func (ac *accountClient) GetCallRecordings(ctx context.Context, u *config.User, callSid string, data url.Values) (*RecordingPage, error) {
+	return ac.get(ctx).GetCallRecordings(ctx, u, callSid, data)
+}
+
+func (ac *accountClient) GetTranscription(ctx context.Context, u *config.User, sid string) (*Transcription, error) {
+	return ac.get(ctx).GetTranscription(ctx, u, sid)
+}
+
+func (ac *accountClient) GetTranscriptionsForRecordings(ctx context.Context, u *config.User, recordings []*Recording) (map[string][]*Transcription, error) {
+	return ac.get(ctx).GetTranscriptionsForRecordings(ctx, u, recordings)
+}
+
+func (ac *accountClient) GetUsage(ctx context.Context, u *config.User, period string, category string, start, end time.Time) (*Usage, error) {
+	return ac.get(ctx).GetUsage(ctx, u, period, category, start, end)
+}
+
+func (ac *accountClient) GetCallAlerts(ctx context.Context, u *config.User, callSid string) (*AlertPage, error) {
+	return ac.get(ctx).GetCallAlerts(ctx, u, callSid)
+}
+
+// CacheCommonQueries keeps the front pages of every account warm.
+func (ac *accountClient) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
+	for _, a := range ac.accounts {
+		go a.Client.CacheCommonQueries(pageSize, doneCh)
+	}
+}
+
+// IsTwilioNumber returns true if num is one of the phone numbers in any of
+// the accounts.
+func (ac *accountClient) IsTwilioNumber(u *config.User, num twilio.PhoneNumber) bool {
+	for _, a := range ac.accounts {
+		if a.Client.IsTwilioNumber(u, num) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ac *accountClient) CanViewAnyPhoneNumber(ctx context.Context, u *config.User, pns ...twilio.PhoneNumber) bool {
+	return ac.get(ctx).CanViewAnyPhoneNumber(ctx, u, pns...)
+}
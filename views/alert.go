@@ -2,6 +2,7 @@ package views
 
 import (
 	"errors"
+	"net/url"
 	"strings"
 
 	types "github.com/kevinburke/go-types"
@@ -13,6 +14,9 @@ type AlertPage struct {
 	alerts          []*Alert
 	nextPageURI     types.NullString
 	previousPageURI types.NullString
+	// True if the page came from the cache after it expired, and is being
+	// refreshed.
+	stale bool
 }
 
 type Alert struct {
@@ -67,10 +71,49 @@ func (ap *AlertPage) NextPageURI() types.NullString {
 	return ap.nextPageURI
 }
 
+// Stale returns true if the page is an expired cache value. A fresh copy is
+// being fetched in the background.
+func (ap *AlertPage) Stale() bool {
+	return ap.stale
+}
+
 func (ap *AlertPage) PreviousPageURI() types.NullString {
 	return ap.previousPageURI
 }
 
+// Filter returns a copy of ap with only the alerts for which keep returns
+// true. The paging URIs are the same as ap's, so the next page continues
+// where ap left off, even if the filtered page is empty.
+func (ap *AlertPage) Filter(keep func(*Alert) bool) *AlertPage {
+	alerts := make([]*Alert, 0)
+	for _, alert := range ap.alerts {
+		if keep(alert) {
+			alerts = append(alerts, alert)
+		}
+	}
+	return &AlertPage{
+		alerts:          alerts,
+		nextPageURI:     ap.nextPageURI,
+		previousPageURI: ap.previousPageURI,
+		stale:           ap.stale,
+	}
+}
+
+// Append returns a page with the alerts in ap followed by the alerts in next,
+// which should be the page after ap. The next page URI is next's, so paging
+// continues after next.
+func (ap *AlertPage) Append(next *AlertPage) *AlertPage {
+	alerts := make([]*Alert, 0, len(ap.alerts)+len(next.alerts))
+	alerts = append(alerts, ap.alerts...)
+	alerts = append(alerts, next.alerts...)
+	return &AlertPage{
+		alerts:          alerts,
+		nextPageURI:     next.nextPageURI,
+		previousPageURI: ap.previousPageURI,
+		stale:           ap.stale || next.stale,
+	}
+}
+
 func (ap *AlertPage) ShowHeader(fieldName string) bool {
 	if ap == nil {
 		return showAllColumnsOnEmptyPage
@@ -116,7 +159,10 @@ func (a *Alert) CanViewDescription() bool {
 
 func (a *Alert) Description() (string, error) {
 	if a.CanViewDescription() {
-		return a.alert.Description(), nil
+		// The description comes from the alert text, which can include the
+		// request variables.
+		description, _ := a.user.Redact(a.alert.Description())
+		return description, nil
 	} else {
 		return "", config.PermissionDenied
 	}
@@ -201,9 +247,12 @@ func (a *Alert) RequestMethod() (string, error) {
 	}
 }
 
+// RequestVariables returns the variables we sent to the callback URL, with
+// the user's redaction rules applied to each value.
 func (a *Alert) RequestVariables() (twilio.Values, error) {
 	if a.CanViewProperty("RequestVariables") {
-		return a.alert.RequestVariables, nil
+		vals, _ := a.redactValues(a.alert.RequestVariables)
+		return vals, nil
 	} else {
 		return twilio.Values{}, config.PermissionDenied
 	}
@@ -219,7 +268,8 @@ func (a *Alert) ResponseHeaders() (twilio.Values, error) {
 
 func (a *Alert) RequestURL() (string, error) {
 	if a.CanViewProperty("RequestURL") {
-		return a.alert.RequestURL, nil
+		u, _ := a.user.Redact(a.alert.RequestURL)
+		return u, nil
 	} else {
 		return "", config.PermissionDenied
 	}
@@ -251,8 +301,41 @@ func (a *Alert) DateUpdated() (twilio.TwilioTime, error) {
 
 func (a *Alert) ResponseBody() (string, error) {
 	if a.CanViewProperty("ResponseBody") {
-		return a.alert.ResponseBody, nil
+		body, _ := a.user.Redact(a.alert.ResponseBody)
+		return body, nil
 	} else {
 		return "", config.PermissionDenied
 	}
 }
+
+// redactValues returns a copy of vals with the user's redaction rules applied
+// to each value. The boolean is true if any value changed.
+func (a *Alert) redactValues(vals twilio.Values) (twilio.Values, bool) {
+	if vals.Values == nil {
+		return vals, false
+	}
+	redacted := false
+	cp := twilio.Values{Values: make(url.Values, len(vals.Values))}
+	for k, vs := range vals.Values {
+		cp.Values[k] = make([]string, len(vs))
+		for i, v := range vs {
+			var changed bool
+			cp.Values[k][i], changed = a.user.Redact(v)
+			redacted = redacted || changed
+		}
+	}
+	return cp, redacted
+}
+
+// Redacted returns true if a redaction rule hid part of the request URL,
+// request variables, response body or description.
+func (a *Alert) Redacted() bool {
+	if !a.user.CanViewCallbackURLs() {
+		return false
+	}
+	_, urlRedacted := a.user.Redact(a.alert.RequestURL)
+	_, varsRedacted := a.redactValues(a.alert.RequestVariables)
+	_, bodyRedacted := a.user.Redact(a.alert.ResponseBody)
+	_, descriptionRedacted := a.user.Redact(a.alert.Description())
+	return urlRedacted || varsRedacted || bodyRedacted || descriptionRedacted
+}
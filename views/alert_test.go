@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	types "github.com/kevinburke/go-types"
 	twilio "github.com/saintpete/twilio-go"
 	"github.com/saintpete/logrole/config"
 )
@@ -34,3 +35,37 @@ func TestViewResourceSid(t *testing.T) {
 		t.Errorf("wrong Sid")
 	}
 }
+
+func TestFilterAlertPage(t *testing.T) {
+	permission := config.NewPermission(config.DefaultMaxResourceAge)
+	u := config.NewUser(config.AllUserSettings())
+	now := twilio.TwilioTime{Valid: true, Time: time.Now()}
+	tpage := &twilio.AlertPage{
+		Meta: twilio.Meta{NextPageURL: types.NullString{Valid: true, String: "/next"}},
+		Alerts: []*twilio.Alert{
+			{Sid: "NO123", ErrorCode: 11200, DateCreated: now},
+			{Sid: "NO456", ErrorCode: 13227, DateCreated: now},
+		},
+	}
+	page, err := NewAlertPage(tpage, permission, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered := page.Filter(func(a *Alert) bool {
+		code, _ := a.ErrorCode()
+		return code == 13227
+	})
+	if len(filtered.Alerts()) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(filtered.Alerts()))
+	}
+	if sid, _ := filtered.Alerts()[0].Sid(); sid != "NO456" {
+		t.Errorf("expected NO456, got %s", sid)
+	}
+	empty := page.Filter(func(a *Alert) bool { return false })
+	if len(empty.Alerts()) != 0 {
+		t.Errorf("expected no alerts, got %d", len(empty.Alerts()))
+	}
+	if next := empty.NextPageURI(); !next.Valid || next.String != "/next" {
+		t.Errorf("expected the next page to be kept, got %v", next)
+	}
+}
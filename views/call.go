@@ -12,14 +12,20 @@ type CallPage struct {
 	calls           []*Call
 	previousPageURI types.NullString
 	nextPageURI     types.NullString
+	// True if the page came from the cache after it expired, and is being
+	// refreshed.
+	stale bool
 }
 
 type Call struct {
 	user *config.User
 	call *twilio.Call
+	// Used to encrypt phone numbers in the links from masked numbers, and
+	// to derive pseudonyms.
+	secretKey *[32]byte
 }
 
-func NewCall(call *twilio.Call, p *config.Permission, u *config.User) (*Call, error) {
+func NewCall(call *twilio.Call, p *config.Permission, u *config.User, key *[32]byte) (*Call, error) {
 	if u.CanViewCalls() == false {
 		return nil, config.PermissionDenied
 	}
@@ -29,7 +35,10 @@ func NewCall(call *twilio.Call, p *config.Permission, u *config.User) (*Call, er
 	if !u.CanViewResource(call.DateCreated.Time, p.MaxResourceAge()) {
 		return nil, config.ErrTooOld
 	}
-	return &Call{user: u, call: call}, nil
+	if !u.CanViewAnyPhoneNumber(p, call.From, call.To) {
+		return nil, config.ErrOutOfScope
+	}
+	return &Call{user: u, call: call, secretKey: key}, nil
 }
 
 func (c *Call) CanViewProperty(property string) bool {
@@ -38,7 +47,7 @@ func (c *Call) CanViewProperty(property string) bool {
 	}
 	switch property {
 	case "Sid", "Direction", "Status", "DateCreated", "DateUpdated",
-		"Duration", "StartTime", "EndTime":
+		"Duration", "StartTime", "EndTime", "ParentCallSid":
 		return c.user.CanViewCalls()
 	case "Price", "PriceUnit":
 		return c.user.CanViewCallPrice()
@@ -46,6 +55,14 @@ func (c *Call) CanViewProperty(property string) bool {
 		return c.user.CanViewCallFrom()
 	case "To":
 		return c.user.CanViewCallTo()
+	case "MaskedFrom":
+		return c.user.CanViewMaskedCallFrom()
+	case "MaskedTo":
+		return c.user.CanViewMaskedCallTo()
+	case "PseudonymousFrom":
+		return c.user.CanViewPseudonymousCallFrom()
+	case "PseudonymousTo":
+		return c.user.CanViewPseudonymousCallTo()
 	default:
 		panic("unknown property " + property)
 	}
@@ -59,6 +76,16 @@ func (c *Call) Sid() (string, error) {
 	}
 }
 
+// ParentCallSid returns the sid of the call that dialed this call, if one
+// exists.
+func (c *Call) ParentCallSid() (types.NullString, error) {
+	if c.CanViewProperty("ParentCallSid") {
+		return c.call.ParentCallSid, nil
+	} else {
+		return types.NullString{}, config.PermissionDenied
+	}
+}
+
 func (c *Call) DateCreated() (twilio.TwilioTime, error) {
 	if c.CanViewProperty("DateCreated") {
 		return c.call.DateCreated, nil
@@ -99,6 +126,46 @@ func (c *Call) To() (twilio.PhoneNumber, error) {
 	}
 }
 
+// MaskedFrom returns a masked copy of the caller's number, for users who can't
+// view the full number.
+func (c *Call) MaskedFrom() (*MaskedNumber, error) {
+	if c.CanViewProperty("MaskedFrom") {
+		return newMaskedNumber(c.call.From, c.user.MaskedDigits(), c.secretKey, "/calls", "masked-from"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
+// MaskedTo returns a masked copy of the recipient's number, for users who
+// can't view the full number.
+func (c *Call) MaskedTo() (*MaskedNumber, error) {
+	if c.CanViewProperty("MaskedTo") {
+		return newMaskedNumber(c.call.To, c.user.MaskedDigits(), c.secretKey, "/calls", "masked-to"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
+// PseudonymousFrom returns a pseudonym for the caller, for users who can't
+// view their number.
+func (c *Call) PseudonymousFrom() (*Pseudonym, error) {
+	if c.CanViewProperty("PseudonymousFrom") {
+		return newPseudonym(c.call.From, c.secretKey, "/calls", "pseudonym-from"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
+// PseudonymousTo returns a pseudonym for the recipient, for users who can't view
+// their number.
+func (c *Call) PseudonymousTo() (*Pseudonym, error) {
+	if c.CanViewProperty("PseudonymousTo") {
+		return newPseudonym(c.call.To, c.secretKey, "/calls", "pseudonym-to"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
 func (c *Call) Duration() (twilio.TwilioDuration, error) {
 	if c.CanViewProperty("Duration") {
 		return c.call.Duration, nil
@@ -139,14 +206,19 @@ func (c *Call) Failed() (bool, error) {
 	}
 }
 
-func NewCallPage(cp *twilio.CallPage, p *config.Permission, u *config.User) (*CallPage, error) {
+func NewCallPage(cp *twilio.CallPage, p *config.Permission, u *config.User, key *[32]byte) (*CallPage, error) {
 	if u.CanViewCalls() == false {
 		return nil, config.PermissionDenied
 	}
 	calls := make([]*Call, 0)
+	tooOld := false
 	for _, call := range cp.Calls {
-		cl, err := NewCall(call, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		cl, err := NewCall(call, p, u, key)
+		if err == config.ErrTooOld {
+			tooOld = true
+			continue
+		}
+		if err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -154,8 +226,10 @@ func NewCallPage(cp *twilio.CallPage, p *config.Permission, u *config.User) (*Ca
 		}
 		calls = append(calls, cl)
 	}
+	// If every call on the page is too old, so is every call on the next
+	// page. Out of scope calls don't tell us anything about the next page.
 	var npuri types.NullString
-	if len(calls) > 0 {
+	if len(calls) > 0 || !tooOld {
 		npuri = cp.NextPageURI
 	}
 	return &CallPage{
@@ -173,6 +247,12 @@ func (cp *CallPage) NextPageURI() types.NullString {
 	return cp.nextPageURI
 }
 
+// Stale returns true if the page is an expired cache value. A fresh copy is
+// being fetched in the background.
+func (cp *CallPage) Stale() bool {
+	return cp.stale
+}
+
 func (cp *CallPage) PreviousPageURI() types.NullString {
 	return cp.previousPageURI
 }
@@ -0,0 +1,142 @@
+package views
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/kevinburke/rest"
+	"github.com/saintpete/logrole/config"
+	"golang.org/x/net/context"
+)
+
+// Don't follow parent or child calls more than this many levels away from the
+// call being viewed.
+const maxLegDepth = 3
+
+// A CallLeg is one call in a tree of calls connected by <Dial>. The call that
+// dialed out is the parent, and each call it dialed is a child.
+type CallLeg struct {
+	call    *Call
+	depth   int
+	current bool
+}
+
+// Call returns the call for this leg.
+func (l *CallLeg) Call() *Call {
+	return l.call
+}
+
+// Depth returns the number of parents between this leg and the top of the
+// tree, which has depth 0.
+func (l *CallLeg) Depth() int {
+	return l.depth
+}
+
+// Current returns true if this leg is the call the legs were fetched for.
+func (l *CallLeg) Current() bool {
+	return l.current
+}
+
+// callsByDateCreated sorts calls oldest first, so children appear in the
+// order they were dialed.
+type callsByDateCreated []*Call
+
+func (c callsByDateCreated) Len() int      { return len(c) }
+func (c callsByDateCreated) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c callsByDateCreated) Less(i, j int) bool {
+	return c[i].call.DateCreated.Time.Before(c[j].call.DateCreated.Time)
+}
+
+// hiddenCall returns true if err means a related call doesn't exist or can't
+// be shown to the user, so it should be left out instead of failing the
+// request.
+func hiddenCall(err error) bool {
+	if terr, ok := err.(*rest.Error); ok && terr.StatusCode == 404 {
+		return true
+	}
+	return err == config.ErrTooOld || err == config.PermissionDenied || err == config.ErrOutOfScope
+}
+
+// getChildCalls fetches the calls dialed by the call with the given sid.
+func (vc *client) getChildCalls(ctx context.Context, u *config.User, sid string) ([]*Call, error) {
+	data := url.Values{}
+	data.Set("ParentCallSid", sid)
+	data.Set("PageSize", "50")
+	page, err := vc.client.Calls.GetPage(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]*Call, 0, len(page.Calls))
+	for _, call := range page.Calls {
+		c, err := NewCall(call, vc.permission, u, vc.secretKey)
+		if err != nil {
+			if hiddenCall(err) {
+				continue
+			}
+			return nil, err
+		}
+		calls = append(calls, c)
+	}
+	sort.Sort(callsByDateCreated(calls))
+	return calls, nil
+}
+
+// getLegs returns call and the calls it dialed, depth first. Child calls are
+// fetched in parallel.
+func (vc *client) getLegs(ctx context.Context, u *config.User, call *Call, depth int) ([]*CallLeg, error) {
+	legs := []*CallLeg{{call: call, depth: depth}}
+	if depth >= maxLegDepth {
+		return legs, nil
+	}
+	children, err := vc.getChildCalls(ctx, u, call.call.Sid)
+	if err != nil {
+		return nil, err
+	}
+	childLegs := make([][]*CallLeg, len(children))
+	errs := make([]error, len(children))
+	var wg sync.WaitGroup
+	for i, child := range children {
+		wg.Add(1)
+		go func(i int, child *Call) {
+			defer wg.Done()
+			childLegs[i], errs[i] = vc.getLegs(ctx, u, child, depth+1)
+		}(i, child)
+	}
+	wg.Wait()
+	for i := range children {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		legs = append(legs, childLegs[i]...)
+	}
+	return legs, nil
+}
+
+// GetCallLegs returns the tree of calls that call belongs to, starting with
+// the call at the top of the tree and followed by its children, depth first.
+// Parents and children the user can't view are left out. If call has no
+// parent or children, the result contains only call.
+func (vc *client) GetCallLegs(ctx context.Context, u *config.User, call *Call) ([]*CallLeg, error) {
+	root := call
+	for i := 0; i < maxLegDepth && root.call.ParentCallSid.Valid; i++ {
+		parent, err := vc.GetCall(ctx, u, root.call.ParentCallSid.String)
+		if err != nil {
+			if hiddenCall(err) {
+				break
+			}
+			return nil, err
+		}
+		root = parent
+	}
+	legs, err := vc.getLegs(ctx, u, root, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, leg := range legs {
+		if leg.call.call.Sid == call.call.Sid {
+			leg.current = true
+		}
+	}
+	return legs, nil
+}
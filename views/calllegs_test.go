@@ -0,0 +1,91 @@
+package views
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"golang.org/x/net/context"
+)
+
+func legJSON(sid, parent string, created time.Time) string {
+	p := "null"
+	if parent != "" {
+		p = fmt.Sprintf("%q", parent)
+	}
+	return fmt.Sprintf(`{"sid": %q, "parent_call_sid": %s, "from": "+14105551234", "to": "+19253920364", "status": "completed", "date_created": %q}`,
+		sid, p, created.UTC().Format(time.RFC1123Z))
+}
+
+func TestGetCallLegs(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if strings.HasSuffix(r.URL.Path, "/Calls/CA1.json") {
+			w.Write([]byte(legJSON("CA1", "", now.Add(-3*time.Minute))))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/Calls.json") {
+			calls := []string{}
+			if r.URL.Query().Get("ParentCallSid") == "CA1" {
+				// Twilio lists the newest calls first.
+				calls = append(calls, legJSON("CA3", "CA1", now.Add(-time.Minute)), legJSON("CA2", "CA1", now.Add(-2*time.Minute)))
+			}
+			fmt.Fprintf(w, `{"calls": [%s]}`, strings.Join(calls, ", "))
+			return
+		}
+		w.WriteHeader(404)
+	}))
+	defer s.Close()
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = s.URL
+	l := log.New()
+	l.SetHandler(log.DiscardHandler())
+	p := config.NewPermission(config.DefaultMaxResourceAge)
+	vc := NewClient(l, c, services.NewRandomKey(), p)
+	u := config.NewUser(config.AllUserSettings())
+	tc := new(twilio.Call)
+	if err := json.Unmarshal([]byte(legJSON("CA2", "CA1", now.Add(-2*time.Minute))), tc); err != nil {
+		t.Fatal(err)
+	}
+	call, err := NewCall(tc, p, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legs, err := vc.GetCallLegs(context.Background(), u, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		sid     string
+		depth   int
+		current bool
+	}{
+		{"CA1", 0, false},
+		{"CA2", 1, true},
+		{"CA3", 1, false},
+	}
+	if len(legs) != len(want) {
+		t.Fatalf("expected %d legs, got %d", len(want), len(legs))
+	}
+	for i, w := range want {
+		if sid, _ := legs[i].Call().Sid(); sid != w.sid {
+			t.Errorf("leg %d: expected %s, got %s", i, w.sid, sid)
+		}
+		if legs[i].Depth() != w.depth {
+			t.Errorf("leg %d: expected depth %d, got %d", i, w.depth, legs[i].Depth())
+		}
+		if legs[i].Current() != w.current {
+			t.Errorf("leg %d: expected current to be %t", i, w.current)
+		}
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/golang/groupcache/singleflight"
 	log "github.com/inconshreveable/log15"
+	types "github.com/kevinburke/go-types"
 	"github.com/kevinburke/rest"
 	"github.com/saintpete/logrole/cache"
 	"github.com/saintpete/logrole/config"
@@ -37,8 +38,11 @@ var nextPageTimeout = 5 * time.Minute
 type Client interface {
 	SetBasicAuth(r *http.Request)
 	GetMessage(context.Context, *config.User, string) (*Message, error)
+	GetMessagesBySid(context.Context, *config.User, []string) (*MessagePage, error)
 	GetCall(context.Context, *config.User, string) (*Call, error)
+	GetCallLegs(context.Context, *config.User, *Call) ([]*CallLeg, error)
 	GetConference(context.Context, *config.User, string) (*Conference, error)
+	GetConferenceParticipants(ctx context.Context, u *config.User, sid string, live bool) ([]*Participant, error)
 	GetIncomingNumber(ctx context.Context, u *config.User, sid string) (*IncomingNumber, error)
 	GetIncomingNumberByPN(ctx context.Context, u *config.User, pn string) (*IncomingNumber, error)
 	GetAlert(context.Context, *config.User, string) (*Alert, error)
@@ -53,16 +57,29 @@ type Client interface {
 	GetNextCallPageInRange(context.Context, *config.User, time.Time, time.Time, string) (*CallPage, uint64, error)
 	GetNextConferencePageInRange(context.Context, *config.User, time.Time, time.Time, string) (*ConferencePage, uint64, error)
 	GetNextAlertPageInRange(context.Context, *config.User, time.Time, time.Time, string) (*AlertPage, uint64, error)
+	GetRecording(context.Context, *config.User, string) (*Recording, error)
+	GetRecordingPageInRange(context.Context, *config.User, time.Time, time.Time, url.Values) (*RecordingPage, uint64, error)
+	GetNextRecordingPageInRange(context.Context, *config.User, time.Time, time.Time, string) (*RecordingPage, uint64, error)
 	GetNextRecordingPage(context.Context, *config.User, string) (*RecordingPage, error)
 	GetCallRecordings(context.Context, *config.User, string, url.Values) (*RecordingPage, error)
+	GetTranscription(ctx context.Context, u *config.User, sid string) (*Transcription, error)
+	GetTranscriptionsForRecordings(ctx context.Context, u *config.User, recordings []*Recording) (map[string][]*Transcription, error)
+	GetUsage(ctx context.Context, u *config.User, period string, category string, start, end time.Time) (*Usage, error)
 	GetCallAlerts(context.Context, *config.User, string) (*AlertPage, error)
 	CacheCommonQueries(uint, <-chan bool)
-	IsTwilioNumber(num twilio.PhoneNumber) bool
+	// IsTwilioNumber returns true if num is one of the account's phone
+	// numbers, and u can view it. If u is nil, any of the account's numbers
+	// match.
+	IsTwilioNumber(u *config.User, num twilio.PhoneNumber) bool
+	// CanViewAnyPhoneNumber returns true if u's group can view resources to or
+	// from at least one of pns, without fetching a resource.
+	CanViewAnyPhoneNumber(ctx context.Context, u *config.User, pns ...twilio.PhoneNumber) bool
 }
 
 type client struct {
 	log.Logger
 	group      singleflight.Group
+	refreshes  singleflight.Group // background refreshes of stale values
 	cache      *cache.Cache
 	client     *twilio.Client
 	secretKey  *[32]byte
@@ -71,16 +88,19 @@ type client struct {
 	numbersMu  sync.RWMutex
 }
 
-// this allows about 8k entries in the cache
-const cacheSizeMB = 25
-const averageCacheEntryBytes = 3000
-
-// NewClient creates a new Client encapsulating the provided values.
+// NewClient creates a new Client encapsulating the provided values. Twilio
+// responses are cached in memory.
 func NewClient(l log.Logger, c *twilio.Client, secretKey *[32]byte, p *config.Permission) Client {
+	return NewClientWithCache(l, c, secretKey, p, cache.NewCache(config.DefaultCacheSizeMB*1024*1024, l))
+}
+
+// NewClientWithCache is like NewClient, but caches Twilio responses in the
+// given Cache.
+func NewClientWithCache(l log.Logger, c *twilio.Client, secretKey *[32]byte, p *config.Permission, ch *cache.Cache) Client {
 	return &client{
 		Logger:     l,
 		group:      singleflight.Group{},
-		cache:      cache.NewCache(cacheSizeMB*1024*1024/averageCacheEntryBytes, l),
+		cache:      ch,
 		client:     c,
 		secretKey:  secretKey,
 		permission: p,
@@ -91,6 +111,7 @@ func (vc *client) getNumbers() {
 	iter := vc.client.IncomingNumbers.GetPageIterator(nil)
 	size, count := 0, 0
 	mp := make(map[twilio.PhoneNumber]bool)
+	sids := make(map[twilio.PhoneNumber]string)
 	for count < 200 {
 		page, err := iter.Next(context.Background())
 		if err == twilio.NoMoreResults {
@@ -101,6 +122,7 @@ func (vc *client) getNumbers() {
 		}
 		for _, pn := range page.IncomingPhoneNumbers {
 			mp[pn.PhoneNumber] = true
+			sids[pn.PhoneNumber] = pn.Sid
 			size++
 		}
 		count++
@@ -108,6 +130,7 @@ func (vc *client) getNumbers() {
 	vc.numbersMu.Lock()
 	vc.numbers = mp
 	vc.numbersMu.Unlock()
+	vc.permission.SetPhoneNumberSids(sids)
 	vc.Debug("Updated phone number map", "size", size)
 }
 
@@ -123,7 +146,48 @@ func (vc *client) GetMessage(ctx context.Context, user *config.User, sid string)
 	if err != nil {
 		return nil, err
 	}
-	return NewMessage(message, vc.permission, user)
+	return NewMessage(message, vc.permission, user, vc.secretKey)
+}
+
+// GetMessagesBySid fetches the messages with the given sids in parallel, and
+// returns them in the same order. Messages that the user can't view, or that
+// no longer exist, are left out. The page has no next page URI.
+func (vc *client) GetMessagesBySid(ctx context.Context, user *config.User, sids []string) (*MessagePage, error) {
+	if user.CanViewMessages() == false {
+		return nil, config.PermissionDenied
+	}
+	type result struct {
+		message *Message
+		err     error
+	}
+	results := make([]result, len(sids))
+	var wg sync.WaitGroup
+	for i, sid := range sids {
+		wg.Add(1)
+		go func(i int, sid string) {
+			defer wg.Done()
+			message, err := vc.GetMessage(ctx, user, sid)
+			results[i] = result{message: message, err: err}
+		}(i, sid)
+	}
+	wg.Wait()
+	messages := make([]*Message, 0, len(sids))
+	for _, r := range results {
+		switch terr := r.err.(type) {
+		case nil:
+			messages = append(messages, r.message)
+			continue
+		case *rest.Error:
+			if terr.StatusCode == 404 {
+				continue
+			}
+		}
+		if r.err == config.ErrTooOld || r.err == config.PermissionDenied || r.err == config.ErrOutOfScope {
+			continue
+		}
+		return nil, r.err
+	}
+	return &MessagePage{messages: messages}, nil
 }
 
 // GetCall fetches a single Call from the Twilio API, and returns any
@@ -133,17 +197,41 @@ func (vc *client) GetCall(ctx context.Context, user *config.User, sid string) (*
 	if err != nil {
 		return nil, err
 	}
-	return NewCall(call, vc.permission, user)
+	return NewCall(call, vc.permission, user, vc.secretKey)
 }
 
 // GetAlert fetches a single Alert from the Twilio API, and returns any
-// network or permission errors that occur.
+// network or permission errors that occur. If the user's group is limited to
+// some phone numbers, the alert must be for a message or call to or from one
+// of them.
 func (vc *client) GetAlert(ctx context.Context, user *config.User, sid string) (*Alert, error) {
-	call, err := vc.client.Monitor.Alerts.Get(ctx, sid)
+	alert, err := vc.client.Monitor.Alerts.Get(ctx, sid)
 	if err != nil {
 		return nil, err
 	}
-	return NewAlert(call, vc.permission, user)
+	if err := vc.checkAlertResource(ctx, user, alert); err != nil {
+		return nil, err
+	}
+	return NewAlert(alert, vc.permission, user)
+}
+
+// checkAlertResource returns ErrOutOfScope if the user's group is limited to
+// some phone numbers, and the alert isn't for a message or call to or from
+// one of them.
+func (vc *client) checkAlertResource(ctx context.Context, user *config.User, alert *twilio.Alert) error {
+	if !user.HasPhoneNumberScope() {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(alert.ResourceSid, "CA"):
+		_, err := vc.GetCall(ctx, user, alert.ResourceSid)
+		return err
+	case strings.HasPrefix(alert.ResourceSid, "SM"), strings.HasPrefix(alert.ResourceSid, "MM"):
+		_, err := vc.GetMessage(ctx, user, alert.ResourceSid)
+		return err
+	default:
+		return config.ErrOutOfScope
+	}
 }
 
 // GetIncomingNumber fetches a single IncomingNumber from the Twilio API, and
@@ -210,8 +298,10 @@ func (vc *client) GetMediaURLs(ctx context.Context, u *config.User, sid string)
 	return opaqueImages, nil
 }
 
-func hash(typ, val string, a, b time.Time) string {
-	return strings.Join([]string{typ, val, a.Format(time.RFC3339Nano), b.Format(time.RFC3339Nano)}, "|")
+// hash returns the cache key for a page of resources. Keys start with the
+// resource type, so admins can purge every page of one type.
+func hash(typ, accountSid, val string, a, b time.Time) string {
+	return strings.Join([]string{typ, accountSid, val, a.Format(time.RFC3339Nano), b.Format(time.RFC3339Nano)}, "|")
 }
 
 func (vc *client) getAndCacheMessage(ctx context.Context, start, end time.Time, data url.Values) (*CacheResult, error) {
@@ -219,8 +309,8 @@ func (vc *client) getAndCacheMessage(ctx context.Context, start, end time.Time,
 	if err != nil {
 		return nil, err
 	}
-	key := hash("messages", data.Encode(), start, end)
-	vc.cache.Set(key, page, frontPageTimeout)
+	key := hash("messages", vc.client.AccountSid, data.Encode(), start, end)
+	vc.setCache(ctx, key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
 
@@ -229,8 +319,18 @@ func (vc *client) getAndCacheConference(ctx context.Context, start, end time.Tim
 	if err != nil {
 		return nil, err
 	}
-	key := hash("conferences", data.Encode(), start, end)
-	vc.cache.Set(key, page, frontPageTimeout)
+	key := hash("conferences", vc.client.AccountSid, data.Encode(), start, end)
+	vc.setCache(ctx, key, page, frontPageTimeout)
+	return &CacheResult{Value: page}, nil
+}
+
+func (vc *client) getAndCacheRecording(ctx context.Context, start, end time.Time, data url.Values) (*CacheResult, error) {
+	page, err := vc.getRecordingsInRange(ctx, start, end, recordingDateFilters(start, end, data), "")
+	if err != nil {
+		return nil, err
+	}
+	key := hash("recordings", vc.client.AccountSid, data.Encode(), start, end)
+	vc.setCache(ctx, key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
 
@@ -239,8 +339,8 @@ func (vc *client) getAndCacheAlert(ctx context.Context, start, end time.Time, da
 	if err != nil {
 		return nil, err
 	}
-	key := hash("alerts", data.Encode(), start, end)
-	vc.cache.Set(key, page, frontPageTimeout)
+	key := hash("alerts", vc.client.AccountSid, data.Encode(), start, end)
+	vc.setCache(ctx, key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
 
@@ -249,8 +349,8 @@ func (vc *client) getAndCacheCall(ctx context.Context, start, end time.Time, dat
 	if err != nil {
 		return nil, err
 	}
-	key := hash("calls", data.Encode(), start, end)
-	vc.cache.Set(key, page, frontPageTimeout)
+	key := hash("calls", vc.client.AccountSid, data.Encode(), start, end)
+	vc.setCache(ctx, key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
 
@@ -259,14 +359,79 @@ func (vc *client) getAndCacheNumber(ctx context.Context, data url.Values) (*Cach
 	if err != nil {
 		return nil, err
 	}
-	key := hash("incoming-numbers", data.Encode(), twilio.Epoch, twilio.HeatDeath)
-	vc.cache.Set(key, page, frontPageTimeout)
+	key := hash("incoming-numbers", vc.client.AccountSid, data.Encode(), twilio.Epoch, twilio.HeatDeath)
+	vc.setCache(ctx, key, page, frontPageTimeout)
 	return &CacheResult{Value: page}, nil
 }
 
 type CacheResult struct {
 	Time  uint64
 	Value interface{}
+	// True if Value expired, and is being refreshed in the background.
+	Stale bool
+}
+
+// fetchFunc retrieves a page from the Twilio API and stores it in the cache.
+type fetchFunc func(context.Context) (*CacheResult, error)
+
+type uncachedCtxVar int
+
+var uncachedKey uncachedCtxVar = 0
+
+// NewUncachedContext returns a copy of ctx that tells the Client to fetch
+// pages from Twilio without reading them from or storing them in the cache.
+// Use it for large pages that nobody will view, so they don't evict the pages
+// people do view.
+func NewUncachedContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedKey, true)
+}
+
+func isUncached(ctx context.Context) bool {
+	uncached, _ := ctx.Value(uncachedKey).(bool)
+	return uncached
+}
+
+// setCache stores page at key, unless ctx came from NewUncachedContext.
+func (vc *client) setCache(ctx context.Context, key string, page interface{}, timeout time.Duration) {
+	if isUncached(ctx) {
+		return
+	}
+	vc.cache.Set(key, page, timeout)
+}
+
+// getCached decodes the value at key into page, or calls fetch to retrieve it.
+// If the value has expired but is still within the cache's grace period, the
+// stale value is returned right away, and fetch is called in the background.
+func (vc *client) getCached(ctx context.Context, key string, page interface{}, fetch fetchFunc) (interface{}, error) {
+	if isUncached(ctx) {
+		return fetch(ctx)
+	}
+	return vc.group.Do(key, func() (interface{}, error) {
+		t, stale, err := vc.cache.GetStale(key, page)
+		if err != nil {
+			return fetch(ctx)
+		}
+		if stale {
+			vc.refresh(key, fetch)
+		}
+		return &CacheResult{Time: t, Value: page, Stale: stale}, nil
+	})
+}
+
+// refresh calls fetch in the background. Only one refresh runs for a key at a
+// time. If the refresh fails, the stale value stays in the cache, and we keep
+// serving it until the grace period elapses.
+func (vc *client) refresh(key string, fetch fetchFunc) {
+	go func() {
+		_, err := vc.refreshes.Do(key, func() (interface{}, error) {
+			// The request that found the stale value may finish before we
+			// do, so don't use its context.
+			return fetch(context.Background())
+		})
+		if err != nil {
+			vc.Warn("Could not refresh stale value in cache", "key", key, "err", err)
+		}
+	}()
 }
 
 func (vc *client) cacheToMsg(user *config.User, val interface{}) (*MessagePage, uint64, error) {
@@ -278,18 +443,17 @@ func (vc *client) cacheToMsg(user *config.User, val interface{}) (*MessagePage,
 	if !ok {
 		return nil, 0, errors.New("Could not cast fetch result to a MessagePage")
 	}
-	mp, err := NewMessagePage(page, vc.permission, user)
-	return mp, result.Time, err
+	mp, err := NewMessagePage(page, vc.permission, user, vc.secretKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	mp.stale = result.Stale
+	return mp, result.Time, nil
 }
 
 func (vc *client) GetMessagePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*MessagePage, uint64, error) {
-	key := hash("messages", data.Encode(), start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.MessagePage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
+	key := hash("messages", vc.client.AccountSid, data.Encode(), start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.MessagePage), func(ctx context.Context) (*CacheResult, error) {
 		return vc.getAndCacheMessage(ctx, start, end, data)
 	})
 	if err != nil {
@@ -299,18 +463,13 @@ func (vc *client) GetMessagePageInRange(ctx context.Context, user *config.User,
 }
 
 func (vc *client) GetNextMessagePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*MessagePage, uint64, error) {
-	key := hash("messages", nextPage, start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.MessagePage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
-		page, err = vc.client.Messages.GetNextMessagesInRange(start, end, nextPage).Next(ctx)
+	key := hash("messages", vc.client.AccountSid, nextPage, start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.MessagePage), func(ctx context.Context) (*CacheResult, error) {
+		page, err := vc.client.Messages.GetNextMessagesInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
 			return nil, err
 		}
-		vc.cache.Set(key, page, nextPageTimeout)
+		vc.setCache(ctx, key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
 	if err != nil {
@@ -328,18 +487,17 @@ func (vc *client) cacheToCall(user *config.User, val interface{}) (*CallPage, ui
 	if !ok {
 		return nil, 0, errors.New("Could not cast fetch result to a CallPage")
 	}
-	cp, err := NewCallPage(page, vc.permission, user)
-	return cp, result.Time, err
+	cp, err := NewCallPage(page, vc.permission, user, vc.secretKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	cp.stale = result.Stale
+	return cp, result.Time, nil
 }
 
 func (vc *client) GetCallPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*CallPage, uint64, error) {
-	key := hash("calls", data.Encode(), start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.CallPage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
+	key := hash("calls", vc.client.AccountSid, data.Encode(), start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.CallPage), func(ctx context.Context) (*CacheResult, error) {
 		return vc.getAndCacheCall(ctx, start, end, data)
 	})
 	if err != nil {
@@ -349,18 +507,13 @@ func (vc *client) GetCallPageInRange(ctx context.Context, user *config.User, sta
 }
 
 func (vc *client) GetNextCallPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*CallPage, uint64, error) {
-	key := hash("calls", nextPage, start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.CallPage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{Time: t, Value: page}, nil
-		}
-		page, err = vc.client.Calls.GetNextCallsInRange(start, end, nextPage).Next(ctx)
+	key := hash("calls", vc.client.AccountSid, nextPage, start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.CallPage), func(ctx context.Context) (*CacheResult, error) {
+		page, err := vc.client.Calls.GetNextCallsInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
 			return nil, err
 		}
-		vc.cache.Set(key, page, nextPageTimeout)
+		vc.setCache(ctx, key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
 	if err != nil {
@@ -379,17 +532,16 @@ func (vc *client) cacheToNumber(user *config.User, val interface{}) (*IncomingNu
 		return nil, 0, errors.New("Could not cast fetch result to a CallPage")
 	}
 	np, err := NewIncomingNumberPage(page, vc.permission, user)
-	return np, result.Time, err
+	if err != nil {
+		return nil, 0, err
+	}
+	np.stale = result.Stale
+	return np, result.Time, nil
 }
 
 func (vc *client) GetNumberPage(ctx context.Context, user *config.User, data url.Values) (*IncomingNumberPage, uint64, error) {
-	key := hash("incoming-numbers", data.Encode(), twilio.Epoch, twilio.HeatDeath)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.IncomingPhoneNumberPage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
+	key := hash("incoming-numbers", vc.client.AccountSid, data.Encode(), twilio.Epoch, twilio.HeatDeath)
+	val, err := vc.getCached(ctx, key, new(twilio.IncomingPhoneNumberPage), func(ctx context.Context) (*CacheResult, error) {
 		return vc.getAndCacheNumber(ctx, data)
 	})
 	if err != nil {
@@ -399,17 +551,13 @@ func (vc *client) GetNumberPage(ctx context.Context, user *config.User, data url
 }
 
 func (vc *client) GetNextNumberPage(ctx context.Context, user *config.User, nextPage string) (*IncomingNumberPage, uint64, error) {
-	key := hash("incoming-numbers", nextPage, twilio.Epoch, twilio.HeatDeath)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
+	key := hash("incoming-numbers", vc.client.AccountSid, nextPage, twilio.Epoch, twilio.HeatDeath)
+	val, err := vc.getCached(ctx, key, new(twilio.IncomingPhoneNumberPage), func(ctx context.Context) (*CacheResult, error) {
 		page := new(twilio.IncomingPhoneNumberPage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{Time: t, Value: page}, nil
-		}
-		if err = vc.client.GetNextPage(ctx, nextPage, page); err != nil {
+		if err := vc.client.GetNextPage(ctx, nextPage, page); err != nil {
 			return nil, err
 		}
-		vc.cache.Set(key, page, nextPageTimeout)
+		vc.setCache(ctx, key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
 	if err != nil {
@@ -428,22 +576,21 @@ func (vc *client) cacheToConference(user *config.User, val interface{}) (*Confer
 		return nil, 0, errors.New("Could not cast fetch result to a ConferencePage")
 	}
 	cp, err := NewConferencePage(page, vc.permission, user)
-	return cp, result.Time, err
+	if err != nil {
+		return nil, 0, err
+	}
+	cp.stale = result.Stale
+	return cp, result.Time, nil
 }
 
 func (vc *client) GetConferencePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*ConferencePage, uint64, error) {
-	key := hash("conferences", data.Encode(), start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.ConferencePage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
-		page, err = vc.client.Conferences.GetConferencesInRange(start, end, data).Next(ctx)
+	key := hash("conferences", vc.client.AccountSid, data.Encode(), start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.ConferencePage), func(ctx context.Context) (*CacheResult, error) {
+		page, err := vc.client.Conferences.GetConferencesInRange(start, end, data).Next(ctx)
 		if err != nil {
 			return nil, err
 		}
-		vc.cache.Set(key, page, nextPageTimeout)
+		vc.setCache(ctx, key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
 	if err != nil {
@@ -453,18 +600,13 @@ func (vc *client) GetConferencePageInRange(ctx context.Context, user *config.Use
 }
 
 func (vc *client) GetNextConferencePageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*ConferencePage, uint64, error) {
-	key := hash("conferences", nextPage, start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.ConferencePage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
-		page, err = vc.client.Conferences.GetNextConferencesInRange(start, end, nextPage).Next(ctx)
+	key := hash("conferences", vc.client.AccountSid, nextPage, start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.ConferencePage), func(ctx context.Context) (*CacheResult, error) {
+		page, err := vc.client.Conferences.GetNextConferencesInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
 			return nil, err
 		}
-		vc.cache.Set(key, page, nextPageTimeout)
+		vc.setCache(ctx, key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
 	if err != nil {
@@ -483,17 +625,16 @@ func (vc *client) cacheToAlert(user *config.User, val interface{}) (*AlertPage,
 		return nil, 0, errors.New("Could not cast fetch result to a AlertPage")
 	}
 	ap, err := NewAlertPage(page, vc.permission, user)
-	return ap, result.Time, err
+	if err != nil {
+		return nil, 0, err
+	}
+	ap.stale = result.Stale
+	return ap, result.Time, nil
 }
 
 func (vc *client) GetAlertPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*AlertPage, uint64, error) {
-	key := hash("alerts", data.Encode(), start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.AlertPage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
+	key := hash("alerts", vc.client.AccountSid, data.Encode(), start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.AlertPage), func(ctx context.Context) (*CacheResult, error) {
 		return vc.getAndCacheAlert(ctx, start, end, data)
 	})
 	if err != nil {
@@ -503,18 +644,13 @@ func (vc *client) GetAlertPageInRange(ctx context.Context, user *config.User, st
 }
 
 func (vc *client) GetNextAlertPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*AlertPage, uint64, error) {
-	key := hash("alerts", nextPage, start, end)
-	val, err := vc.group.Do(key, func() (interface{}, error) {
-		page := new(twilio.AlertPage)
-		t, err := vc.cache.Get(key, page)
-		if err == nil {
-			return &CacheResult{t, page}, nil
-		}
-		page, err = vc.client.Monitor.Alerts.GetNextAlertsInRange(start, end, nextPage).Next(ctx)
+	key := hash("alerts", vc.client.AccountSid, nextPage, start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.AlertPage), func(ctx context.Context) (*CacheResult, error) {
+		page, err := vc.client.Monitor.Alerts.GetNextAlertsInRange(start, end, nextPage).Next(ctx)
 		if err != nil {
 			return nil, err
 		}
-		vc.cache.Set(key, page, nextPageTimeout)
+		vc.setCache(ctx, key, page, nextPageTimeout)
 		return &CacheResult{Value: page}, nil
 	})
 	if err != nil {
@@ -523,6 +659,146 @@ func (vc *client) GetNextAlertPageInRange(ctx context.Context, user *config.User
 	return vc.cacheToAlert(user, val)
 }
 
+// recordingDateFilters returns a copy of data that asks the Twilio API for
+// recordings created on the days between start and end.
+func recordingDateFilters(start, end time.Time, data url.Values) url.Values {
+	filters := url.Values{}
+	for k, v := range data {
+		filters[k] = v
+	}
+	if !start.Equal(twilio.Epoch) {
+		filters.Set("DateCreated>=", start.UTC().Format("2006-01-02"))
+	}
+	if !end.Equal(twilio.HeatDeath) {
+		filters.Set("DateCreated<=", end.UTC().Format("2006-01-02"))
+	}
+	return filters
+}
+
+// filterRecordings removes the recordings in page that weren't created between
+// start and end. The Recordings resource can only filter by day, so the first
+// and last pages may have recordings outside of the range. filterRecordings
+// removes the next page if the page reaches past start, and returns true if
+// every recording on the page was created after end.
+func filterRecordings(page *twilio.RecordingPage, start, end time.Time) bool {
+	if len(page.Recordings) == 0 {
+		return false
+	}
+	recordings := make([]*twilio.Recording, 0, len(page.Recordings))
+	for _, r := range page.Recordings {
+		if r.DateCreated.Time.Before(start) || !r.DateCreated.Time.Before(end) {
+			continue
+		}
+		recordings = append(recordings, r)
+	}
+	// Recordings are sorted newest first.
+	last := page.Recordings[len(page.Recordings)-1]
+	if last.DateCreated.Time.Before(start) {
+		page.NextPageURI = types.NullString{}
+	}
+	allNewer := !last.DateCreated.Time.Before(end)
+	page.Recordings = recordings
+	return allNewer
+}
+
+// getRecordingsInRange retrieves the first page of recordings matching data,
+// or the page at nextPage, with only the recordings created between start and
+// end. Pages with only recordings newer than end are skipped.
+func (vc *client) getRecordingsInRange(ctx context.Context, start, end time.Time, data url.Values, nextPage string) (*twilio.RecordingPage, error) {
+	for {
+		page := new(twilio.RecordingPage)
+		if nextPage == "" {
+			var err error
+			page, err = vc.client.Recordings.GetPage(ctx, data)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if err := vc.client.GetNextPage(ctx, nextPage, page); err != nil {
+				return nil, err
+			}
+		}
+		if allNewer := filterRecordings(page, start, end); !allNewer || !page.NextPageURI.Valid {
+			return page, nil
+		}
+		nextPage = page.NextPageURI.String
+	}
+}
+
+func (vc *client) cacheToRecording(user *config.User, val interface{}) (*RecordingPage, uint64, error) {
+	result, ok := val.(*CacheResult)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a CacheResult")
+	}
+	page, ok := result.Value.(*twilio.RecordingPage)
+	if !ok {
+		return nil, 0, errors.New("Could not cast fetch result to a RecordingPage")
+	}
+	rp, err := NewRecordingPage(page, vc.permission, user, vc.secretKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	rp.stale = result.Stale
+	return rp, result.Time, nil
+}
+
+// GetRecordingPageInRange retrieves a page of recordings created between start
+// and end. data can filter by CallSid or ConferenceSid.
+func (vc *client) GetRecordingPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, data url.Values) (*RecordingPage, uint64, error) {
+	key := hash("recordings", vc.client.AccountSid, data.Encode(), start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.RecordingPage), func(ctx context.Context) (*CacheResult, error) {
+		return vc.getAndCacheRecording(ctx, start, end, data)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToRecording(user, val)
+}
+
+func (vc *client) GetNextRecordingPageInRange(ctx context.Context, user *config.User, start time.Time, end time.Time, nextPage string) (*RecordingPage, uint64, error) {
+	key := hash("recordings", vc.client.AccountSid, nextPage, start, end)
+	val, err := vc.getCached(ctx, key, new(twilio.RecordingPage), func(ctx context.Context) (*CacheResult, error) {
+		page, err := vc.getRecordingsInRange(ctx, start, end, nil, nextPage)
+		if err != nil {
+			return nil, err
+		}
+		vc.setCache(ctx, key, page, nextPageTimeout)
+		return &CacheResult{Value: page}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return vc.cacheToRecording(user, val)
+}
+
+// GetRecording fetches a single Recording from the Twilio API. If the user's
+// group is limited to some phone numbers, the recorded call must be to or
+// from one of them.
+func (vc *client) GetRecording(ctx context.Context, user *config.User, sid string) (*Recording, error) {
+	recording, err := vc.client.Recordings.Get(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	if err := vc.checkRecordedCall(ctx, user, recording); err != nil {
+		return nil, err
+	}
+	return NewRecording(recording, vc.permission, user, vc.secretKey)
+}
+
+// checkRecordedCall returns ErrOutOfScope if the user's group is limited to
+// some phone numbers, and the recording isn't of a call to or from one of
+// them.
+func (vc *client) checkRecordedCall(ctx context.Context, user *config.User, recording *twilio.Recording) error {
+	if !user.HasPhoneNumberScope() {
+		return nil
+	}
+	if recording.CallSid == "" {
+		return config.ErrOutOfScope
+	}
+	_, err := vc.GetCall(ctx, user, recording.CallSid)
+	return err
+}
+
 func (vc *client) GetNextRecordingPage(ctx context.Context, user *config.User, nextPage string) (*RecordingPage, error) {
 	page := new(twilio.RecordingPage)
 	err := vc.client.GetNextPage(ctx, nextPage, page)
@@ -551,10 +827,27 @@ func (vc *client) GetCallAlerts(ctx context.Context, user *config.User, callSid
 	return NewAlertPage(page, vc.permission, user)
 }
 
+// frontPageData returns the query CacheCommonQueries uses to fetch the first
+// page of each resource.
+func frontPageData(pageSize uint) url.Values {
+	ps := strconv.FormatUint(uint64(pageSize), 10)
+	return url.Values{"PageSize": []string{ps}}
+}
+
+// FrontPageCacheKeys returns the cache key for each of the pages that
+// CacheCommonQueries keeps warm for the given account, by resource name.
+func FrontPageCacheKeys(accountSid string, pageSize uint) map[string]string {
+	query := frontPageData(pageSize).Encode()
+	keys := make(map[string]string)
+	for _, typ := range []string{"messages", "calls", "conferences", "alerts", "recordings"} {
+		keys[typ] = hash(typ, accountSid, query, twilio.Epoch, twilio.HeatDeath)
+	}
+	return keys
+}
+
 func (vc *client) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
 	timeout := time.After(1 * time.Millisecond)
-	ps := strconv.FormatUint(uint64(pageSize), 10)
-	data := url.Values{"PageSize": []string{ps}}
+	data := frontPageData(pageSize)
 	// we could add timeouts here but not much value; these all happen in the
 	// background and the twilio client sets a 31 second timeout on all
 	// requests.
@@ -566,6 +859,7 @@ func (vc *client) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
 			go vc.getAndCacheCall(ctx, twilio.Epoch, twilio.HeatDeath, data)
 			go vc.getAndCacheConference(ctx, twilio.Epoch, twilio.HeatDeath, data)
 			go vc.getAndCacheAlert(ctx, twilio.Epoch, twilio.HeatDeath, data)
+			go vc.getAndCacheRecording(ctx, twilio.Epoch, twilio.HeatDeath, data)
 			go vc.getNumbers()
 		case <-doneCh:
 			return
@@ -574,9 +868,16 @@ func (vc *client) CacheCommonQueries(pageSize uint, doneCh <-chan bool) {
 	}
 }
 
-func (vc *client) IsTwilioNumber(num twilio.PhoneNumber) bool {
+func (vc *client) IsTwilioNumber(u *config.User, num twilio.PhoneNumber) bool {
 	vc.numbersMu.RLock()
 	_, ok := vc.numbers[num]
 	vc.numbersMu.RUnlock()
-	return ok
+	if !ok || u == nil {
+		return ok
+	}
+	return u.CanViewPhoneNumber(num, vc.permission.PhoneNumberSid(num))
+}
+
+func (vc *client) CanViewAnyPhoneNumber(ctx context.Context, u *config.User, pns ...twilio.PhoneNumber) bool {
+	return u.CanViewAnyPhoneNumber(vc.permission, pns...)
 }
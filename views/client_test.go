@@ -0,0 +1,46 @@
+package views
+
+import (
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/cache"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"golang.org/x/net/context"
+)
+
+func TestUncachedContext(t *testing.T) {
+	t.Parallel()
+	l := log.New()
+	l.SetHandler(log.DiscardHandler())
+	c := cache.NewCache(1024*1024, l)
+	vc := NewClientWithCache(l, twilio.NewClient("AC123", "123", nil), services.NewRandomKey(), config.NewPermission(config.DefaultMaxResourceAge), c).(*client)
+	fetches := 0
+	fetch := func(ctx context.Context) (*CacheResult, error) {
+		fetches++
+		page := &twilio.MessagePage{Messages: []*twilio.Message{{Sid: "SM123"}}}
+		vc.setCache(ctx, "key", page, nextPageTimeout)
+		return &CacheResult{Value: page}, nil
+	}
+	ctx := NewUncachedContext(context.Background())
+	if _, err := vc.getCached(ctx, "key", new(twilio.MessagePage), fetch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("key", new(twilio.MessagePage)); err == nil {
+		t.Error("expected uncached fetch not to store the page")
+	}
+	if _, err := vc.getCached(context.Background(), "key", new(twilio.MessagePage), fetch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vc.getCached(ctx, "key", new(twilio.MessagePage), fetch); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 3 {
+		t.Errorf("expected uncached requests to skip the cache, got %d fetches", fetches)
+	}
+	if _, err := c.Get("key", new(twilio.MessagePage)); err != nil {
+		t.Errorf("expected cached fetch to store the page, got %v", err)
+	}
+}
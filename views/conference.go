@@ -17,6 +17,9 @@ type ConferencePage struct {
 	conferences     []*Conference
 	previousPageURI types.NullString
 	nextPageURI     types.NullString
+	// True if the page came from the cache after it expired, and is being
+	// refreshed.
+	stale bool
 }
 
 func (c *ConferencePage) Conferences() []*Conference {
@@ -27,6 +30,12 @@ func (cp *ConferencePage) NextPageURI() types.NullString {
 	return cp.nextPageURI
 }
 
+// Stale returns true if the page is an expired cache value. A fresh copy is
+// being fetched in the background.
+func (cp *ConferencePage) Stale() bool {
+	return cp.stale
+}
+
 func (cp *ConferencePage) PreviousPageURI() types.NullString {
 	return cp.previousPageURI
 }
@@ -0,0 +1,193 @@
+package views
+
+import (
+	"strconv"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+)
+
+type exportColumn struct {
+	header   string
+	property string
+}
+
+var messageExportColumns = []exportColumn{
+	{"sid", "Sid"},
+	{"date_created", "DateCreated"},
+	{"direction", "Direction"},
+	{"status", "Status"},
+	{"from", "From"},
+	{"from_masked", "MaskedFrom"},
+	{"from_pseudonym", "PseudonymousFrom"},
+	{"to", "To"},
+	{"to_masked", "MaskedTo"},
+	{"to_pseudonym", "PseudonymousTo"},
+	{"body", "Body"},
+	{"num_segments", "NumSegments"},
+	{"num_media", "NumMedia"},
+	{"price", "Price"},
+	{"price_unit", "PriceUnit"},
+	{"error_code", "ErrorCode"},
+	{"error_message", "ErrorMessage"},
+}
+
+var callExportColumns = []exportColumn{
+	{"sid", "Sid"},
+	{"date_created", "DateCreated"},
+	{"start_time", "StartTime"},
+	{"direction", "Direction"},
+	{"status", "Status"},
+	{"from", "From"},
+	{"from_masked", "MaskedFrom"},
+	{"from_pseudonym", "PseudonymousFrom"},
+	{"to", "To"},
+	{"to_masked", "MaskedTo"},
+	{"to_pseudonym", "PseudonymousTo"},
+	{"duration", "Duration"},
+	{"price", "Price"},
+}
+
+func exportTime(t twilio.TwilioTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
+
+// MessageExportHeader returns the column names for an export of messages,
+// leaving out any column the user does not have permission to view.
+func MessageExportHeader(u *config.User) []string {
+	m := &Message{user: u}
+	header := make([]string, 0, len(messageExportColumns))
+	for _, col := range messageExportColumns {
+		if m.CanViewProperty(col.property) {
+			header = append(header, col.header)
+		}
+	}
+	return header
+}
+
+// ExportRecord returns the message's values for each column in
+// MessageExportHeader, in the same order.
+func (m *Message) ExportRecord() []string {
+	record := make([]string, 0, len(messageExportColumns))
+	for _, col := range messageExportColumns {
+		if !m.CanViewProperty(col.property) {
+			continue
+		}
+		var val string
+		switch col.property {
+		case "Sid":
+			val = m.message.Sid
+		case "DateCreated":
+			val = exportTime(m.message.DateCreated)
+		case "Direction":
+			val = string(m.message.Direction)
+		case "Status":
+			val = string(m.message.Status)
+		case "From":
+			val = string(m.message.From)
+		case "MaskedFrom":
+			if masked, err := m.MaskedFrom(); err == nil {
+				val = masked.Display
+			}
+		case "PseudonymousFrom":
+			if p, err := m.PseudonymousFrom(); err == nil {
+				val = p.ID
+			}
+		case "To":
+			val = string(m.message.To)
+		case "MaskedTo":
+			if masked, err := m.MaskedTo(); err == nil {
+				val = masked.Display
+			}
+		case "PseudonymousTo":
+			if p, err := m.PseudonymousTo(); err == nil {
+				val = p.ID
+			}
+		case "Body":
+			val, _ = m.user.Redact(m.message.Body)
+		case "NumSegments":
+			val = strconv.Itoa(int(m.message.NumSegments))
+		case "NumMedia":
+			val = strconv.Itoa(int(m.message.NumMedia))
+		case "Price":
+			val = m.message.Price
+		case "PriceUnit":
+			val = m.message.PriceUnit
+		case "ErrorCode":
+			if m.message.ErrorCode != 0 {
+				val = strconv.Itoa(int(m.message.ErrorCode))
+			}
+		case "ErrorMessage":
+			val = m.message.ErrorMessage
+		}
+		record = append(record, val)
+	}
+	return record
+}
+
+// CallExportHeader returns the column names for an export of calls, leaving
+// out any column the user does not have permission to view.
+func CallExportHeader(u *config.User) []string {
+	c := &Call{user: u}
+	header := make([]string, 0, len(callExportColumns))
+	for _, col := range callExportColumns {
+		if c.CanViewProperty(col.property) {
+			header = append(header, col.header)
+		}
+	}
+	return header
+}
+
+// ExportRecord returns the call's values for each column in
+// CallExportHeader, in the same order.
+func (c *Call) ExportRecord() []string {
+	record := make([]string, 0, len(callExportColumns))
+	for _, col := range callExportColumns {
+		if !c.CanViewProperty(col.property) {
+			continue
+		}
+		var val string
+		switch col.property {
+		case "Sid":
+			val = c.call.Sid
+		case "DateCreated":
+			val = exportTime(c.call.DateCreated)
+		case "StartTime":
+			val = exportTime(c.call.StartTime)
+		case "Direction":
+			val = string(c.call.Direction)
+		case "Status":
+			val = string(c.call.Status)
+		case "From":
+			val = string(c.call.From)
+		case "MaskedFrom":
+			if masked, err := c.MaskedFrom(); err == nil {
+				val = masked.Display
+			}
+		case "PseudonymousFrom":
+			if p, err := c.PseudonymousFrom(); err == nil {
+				val = p.ID
+			}
+		case "To":
+			val = string(c.call.To)
+		case "MaskedTo":
+			if masked, err := c.MaskedTo(); err == nil {
+				val = masked.Display
+			}
+		case "PseudonymousTo":
+			if p, err := c.PseudonymousTo(); err == nil {
+				val = p.ID
+			}
+		case "Duration":
+			val = strconv.FormatInt(durationSeconds(c.call.Duration), 10)
+		case "Price":
+			val = c.call.FriendlyPrice()
+		}
+		record = append(record, val)
+	}
+	return record
+}
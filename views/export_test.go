@@ -0,0 +1,93 @@
+package views
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+)
+
+func TestMessageExportOmitsHiddenColumns(t *testing.T) {
+	s := config.AllUserSettings()
+	s.CanViewMessageBody = false
+	s.CanViewMessageFrom = false
+	u := config.NewUser(s)
+	header := MessageExportHeader(u)
+	for _, col := range header {
+		if col == "body" || col == "num_segments" || col == "from" {
+			t.Errorf("expected %q column to be omitted, got %v", col, header)
+		}
+	}
+	tmsg := &twilio.Message{
+		Sid:         "SM123",
+		Body:        "secret",
+		From:        twilio.PhoneNumber("+14105551234"),
+		To:          twilio.PhoneNumber("+19253921234"),
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	msg, err := NewMessage(tmsg, config.NewPermission(0), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := msg.ExportRecord()
+	if len(record) != len(header) {
+		t.Fatalf("expected record to have %d columns, got %d", len(header), len(record))
+	}
+	if record[0] != "SM123" || record[1] != "2016-10-01T12:00:00Z" {
+		t.Errorf("wrong record: %v", record)
+	}
+	for _, val := range record {
+		if val == "secret" || val == "+14105551234" {
+			t.Errorf("expected hidden value to be omitted, got %v", record)
+		}
+	}
+}
+
+func TestMessageExportMasked(t *testing.T) {
+	s := config.AllUserSettings()
+	s.CanViewMessageFrom = false
+	s.CanViewMaskedMessageFrom = true
+	u := config.NewUser(s)
+	tmsg := &twilio.Message{
+		Sid:         "SM123",
+		From:        twilio.PhoneNumber("+14105551234"),
+		To:          twilio.PhoneNumber("+19253921234"),
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	msg, err := NewMessage(tmsg, config.NewPermission(0), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := MessageExportHeader(u)
+	record := msg.ExportRecord()
+	found := false
+	for i, col := range header {
+		if col == "from" {
+			t.Errorf("expected from column to be omitted, got %v", header)
+		}
+		if col == "from_masked" {
+			found = true
+			if want := MaskPhoneNumber("+14105551234", u.MaskedDigits()); record[i] != want {
+				t.Errorf("expected masked sender %q, got %q", want, record[i])
+			}
+		}
+		if col == "to_masked" {
+			t.Errorf("expected to_masked column to be omitted for a visible recipient, got %v", header)
+		}
+	}
+	if !found {
+		t.Errorf("expected from_masked column, got %v", header)
+	}
+}
+
+func TestCallExportHeader(t *testing.T) {
+	s := config.AllUserSettings()
+	s.CanViewCallPrice = false
+	header := CallExportHeader(config.NewUser(s))
+	want := []string{"sid", "date_created", "start_time", "direction", "status", "from", "to", "duration"}
+	if !reflect.DeepEqual(header, want) {
+		t.Errorf("CallExportHeader: got %v, want %v", header, want)
+	}
+}
@@ -0,0 +1,292 @@
+package views
+
+import (
+	"encoding/json"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+)
+
+// jsonObject holds the fields of a resource that a user is allowed to see.
+// Fields the user can't view are left out entirely, instead of being
+// serialized as empty values.
+type jsonObject map[string]interface{}
+
+func (o jsonObject) set(show bool, key string, val interface{}) {
+	if show {
+		o[key] = val
+	}
+}
+
+// jsonTime returns nil for an invalid time, or the time in UTC.
+func jsonTime(t twilio.TwilioTime) interface{} {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time.UTC()
+}
+
+// redact applies the user's redaction rules to s.
+func redact(u *config.User, s string) string {
+	redacted, _ := u.Redact(s)
+	return redacted
+}
+
+// durationSeconds returns the duration in whole seconds.
+func durationSeconds(d twilio.TwilioDuration) int64 {
+	return int64(time.Duration(d) / time.Second)
+}
+
+// MarshalJSON serializes the Message, omitting any fields the Message's user
+// does not have permission to view.
+func (m *Message) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(m.CanViewProperty("Sid"), "sid", m.message.Sid)
+	o.set(m.CanViewProperty("DateCreated"), "date_created", jsonTime(m.message.DateCreated))
+	o.set(m.CanViewProperty("MessagingServiceSid"), "messaging_service_sid", m.message.MessagingServiceSid)
+	o.set(m.CanViewProperty("Status"), "status", m.message.Status)
+	o.set(m.CanViewProperty("Direction"), "direction", m.message.Direction)
+	o.set(m.CanViewProperty("ErrorCode"), "error_code", m.message.ErrorCode)
+	o.set(m.CanViewProperty("ErrorMessage"), "error_message", m.message.ErrorMessage)
+	o.set(m.CanViewProperty("Price"), "price", m.message.Price)
+	o.set(m.CanViewProperty("PriceUnit"), "price_unit", m.message.PriceUnit)
+	o.set(m.CanViewProperty("NumMedia"), "num_media", m.message.NumMedia)
+	o.set(m.CanViewProperty("From"), "from", m.message.From)
+	o.set(m.CanViewProperty("To"), "to", m.message.To)
+	if from, err := m.MaskedFrom(); err == nil {
+		o["from_masked"] = from.Display
+	}
+	if to, err := m.MaskedTo(); err == nil {
+		o["to_masked"] = to.Display
+	}
+	if from, err := m.PseudonymousFrom(); err == nil {
+		o["from_pseudonym"] = from.ID
+	}
+	if to, err := m.PseudonymousTo(); err == nil {
+		o["to_pseudonym"] = to.ID
+	}
+	o.set(m.CanViewProperty("Body"), "body", redact(m.user, m.message.Body))
+	o.set(m.CanViewProperty("NumSegments"), "num_segments", m.message.NumSegments)
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the messages in the page as a JSON array.
+func (mp *MessagePage) MarshalJSON() ([]byte, error) {
+	if mp.messages == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(mp.messages)
+}
+
+// MarshalJSON serializes the Call, omitting any fields the Call's user does
+// not have permission to view.
+func (c *Call) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(c.CanViewProperty("Sid"), "sid", c.call.Sid)
+	o.set(c.CanViewProperty("DateCreated"), "date_created", jsonTime(c.call.DateCreated))
+	o.set(c.CanViewProperty("StartTime"), "start_time", jsonTime(c.call.StartTime))
+	o.set(c.CanViewProperty("Duration"), "duration", durationSeconds(c.call.Duration))
+	o.set(c.CanViewProperty("Direction"), "direction", c.call.Direction)
+	o.set(c.CanViewProperty("Status"), "status", c.call.Status)
+	o.set(c.CanViewProperty("ParentCallSid") && c.call.ParentCallSid.Valid, "parent_call_sid", c.call.ParentCallSid.String)
+	o.set(c.CanViewProperty("From"), "from", c.call.From)
+	o.set(c.CanViewProperty("To"), "to", c.call.To)
+	if from, err := c.MaskedFrom(); err == nil {
+		o["from_masked"] = from.Display
+	}
+	if to, err := c.MaskedTo(); err == nil {
+		o["to_masked"] = to.Display
+	}
+	if from, err := c.PseudonymousFrom(); err == nil {
+		o["from_pseudonym"] = from.ID
+	}
+	if to, err := c.PseudonymousTo(); err == nil {
+		o["to_pseudonym"] = to.ID
+	}
+	o.set(c.CanViewProperty("Price") && c.CanViewProperty("PriceUnit"), "price", c.call.FriendlyPrice())
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the calls in the page as a JSON array.
+func (cp *CallPage) MarshalJSON() ([]byte, error) {
+	if cp.calls == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(cp.calls)
+}
+
+// MarshalJSON serializes the Conference, omitting any fields the
+// Conference's user does not have permission to view.
+func (c *Conference) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(c.CanViewProperty("Sid"), "sid", c.conference.Sid)
+	o.set(c.CanViewProperty("DateCreated"), "date_created", jsonTime(c.conference.DateCreated))
+	o.set(c.CanViewProperty("FriendlyName"), "friendly_name", c.conference.FriendlyName)
+	o.set(c.CanViewProperty("Region"), "region", c.conference.Region)
+	o.set(c.CanViewProperty("Status"), "status", c.conference.Status)
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the leg's call, with its depth in the tree of
+// calls.
+func (l *CallLeg) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o["call"] = l.call
+	o["depth"] = l.depth
+	o["current"] = l.current
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the Participant and its call. Muted and hold are
+// only included if the conference is in progress.
+func (p *Participant) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o["call"] = p.call
+	o["join_time"] = jsonTime(p.joinTime)
+	o["leave_time"] = jsonTime(p.leaveTime)
+	o.set(p.live, "muted", p.muted)
+	o.set(p.live, "hold", p.hold)
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the conferences in the page as a JSON array.
+func (cp *ConferencePage) MarshalJSON() ([]byte, error) {
+	if cp.conferences == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(cp.conferences)
+}
+
+// MarshalJSON serializes the Alert, omitting any fields the Alert's user does
+// not have permission to view.
+func (a *Alert) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(a.CanViewProperty("Sid"), "sid", a.alert.Sid)
+	o.set(a.CanViewProperty("DateCreated"), "date_created", jsonTime(a.alert.DateCreated))
+	o.set(a.CanViewProperty("DateUpdated"), "date_updated", jsonTime(a.alert.DateUpdated))
+	o.set(a.CanViewProperty("ErrorCode"), "error_code", a.alert.ErrorCode)
+	o.set(a.CanViewProperty("LogLevel"), "log_level", a.alert.LogLevel)
+	o.set(a.CanViewProperty("MoreInfo"), "more_info", a.alert.MoreInfo)
+	o.set(a.CanViewProperty("ServiceSid"), "service_sid", a.alert.ServiceSid)
+	if sid, err := a.ResourceSid(); err == nil {
+		o["resource_sid"] = sid
+	}
+	o.set(a.CanViewDescription(), "description", redact(a.user, a.alert.Description()))
+	o.set(a.CanViewStatusCode(), "status_code", a.alert.StatusCode())
+	o.set(a.CanViewProperty("RequestURL"), "request_url", redact(a.user, a.alert.RequestURL))
+	o.set(a.CanViewProperty("RequestMethod"), "request_method", a.alert.RequestMethod)
+	if a.CanViewProperty("RequestVariables") {
+		vals, _ := a.redactValues(a.alert.RequestVariables)
+		o["request_variables"] = vals.Values
+	}
+	o.set(a.CanViewProperty("ResponseHeaders"), "response_headers", a.alert.ResponseHeaders.Values)
+	o.set(a.CanViewProperty("ResponseBody"), "response_body", redact(a.user, a.alert.ResponseBody))
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the alerts in the page as a JSON array.
+func (ap *AlertPage) MarshalJSON() ([]byte, error) {
+	if ap.alerts == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(ap.alerts)
+}
+
+// MarshalJSON serializes the IncomingNumber, omitting any fields the user
+// does not have permission to view.
+func (n *IncomingNumber) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(n.CanViewProperty("Sid"), "sid", n.number.Sid)
+	o.set(n.CanViewProperty("DateCreated"), "date_created", jsonTime(n.number.DateCreated))
+	o.set(n.CanViewProperty("PhoneNumber"), "phone_number", n.number.PhoneNumber)
+	o.set(n.CanViewProperty("FriendlyName"), "friendly_name", n.number.FriendlyName)
+	o.set(n.CanViewProperty("Beta"), "beta", n.number.Beta)
+	o.set(n.CanViewProperty("Capabilities"), "capabilities", n.number.Capabilities)
+	o.set(n.CanViewProperty("EmergencyStatus"), "emergency_status", n.number.EmergencyStatus)
+	o.set(n.CanViewProperty("TrunkSid"), "trunk_sid", n.number.TrunkSid)
+	o.set(n.CanViewProperty("VoiceURL"), "voice_url", redact(n.user, n.number.VoiceURL))
+	o.set(n.CanViewProperty("VoiceMethod"), "voice_method", n.number.VoiceMethod)
+	o.set(n.CanViewProperty("VoiceFallbackURL"), "voice_fallback_url", redact(n.user, n.number.VoiceFallbackURL))
+	o.set(n.CanViewProperty("VoiceFallbackMethod"), "voice_fallback_method", n.number.VoiceFallbackMethod)
+	o.set(n.CanViewProperty("VoiceApplicationSid"), "voice_application_sid", n.number.VoiceApplicationSid)
+	o.set(n.CanViewProperty("SMSURL"), "sms_url", redact(n.user, n.number.SMSURL))
+	o.set(n.CanViewProperty("SMSMethod"), "sms_method", n.number.SMSMethod)
+	o.set(n.CanViewProperty("SMSFallbackURL"), "sms_fallback_url", redact(n.user, n.number.SMSFallbackURL))
+	o.set(n.CanViewProperty("SMSFallbackMethod"), "sms_fallback_method", n.number.SMSFallbackMethod)
+	o.set(n.CanViewProperty("SMSApplicationSid"), "sms_application_sid", n.number.SMSApplicationSid)
+	o.set(n.CanViewProperty("StatusCallback"), "status_callback", redact(n.user, n.number.StatusCallback))
+	o.set(n.CanViewProperty("StatusCallbackMethod"), "status_callback_method", n.number.StatusCallbackMethod)
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the numbers in the page as a JSON array.
+func (p *IncomingNumberPage) MarshalJSON() ([]byte, error) {
+	if p.numbers == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(p.numbers)
+}
+
+// MarshalJSON serializes the Recording, omitting any fields the Recording's
+// user does not have permission to view. The url is the encrypted path to the
+// audio proxy.
+func (r *Recording) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(r.CanViewProperty("Sid"), "sid", r.recording.Sid)
+	o.set(r.CanViewProperty("DateCreated"), "date_created", jsonTime(r.recording.DateCreated))
+	o.set(r.CanViewProperty("Duration"), "duration", durationSeconds(r.recording.Duration))
+	o.set(r.CanViewProperty("CallSid") && r.recording.CallSid != "", "call_sid", r.recording.CallSid)
+	o.set(r.CanViewProperty("Price") && r.CanViewProperty("PriceUnit"), "price", r.recording.FriendlyPrice())
+	o.set(r.CanPlay(), "url", r.url)
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the recordings in the page as a JSON array.
+func (rp *RecordingPage) MarshalJSON() ([]byte, error) {
+	if rp.recordings == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(rp.recordings)
+}
+
+// MarshalJSON serializes the Transcription. The text has the user's redaction
+// rules applied.
+func (t *Transcription) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(t.CanViewProperty("Sid"), "sid", t.transcription.Sid)
+	o.set(t.CanViewProperty("DateCreated"), "date_created", jsonTime(t.transcription.DateCreated))
+	o.set(t.CanViewProperty("Status"), "status", t.transcription.Status)
+	o.set(t.CanViewProperty("Duration"), "duration", durationSeconds(t.transcription.Duration))
+	o.set(t.CanViewProperty("RecordingSid"), "recording_sid", t.transcription.RecordingSid)
+	o.set(t.CanViewProperty("CallSid") && t.callSid != "", "call_sid", t.callSid)
+	o.set(t.CanViewProperty("Text"), "text", redact(t.user, t.transcription.Text))
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the UsageRecord. Dates are formatted as YYYY-MM-DD.
+func (r *UsageRecord) MarshalJSON() ([]byte, error) {
+	o := make(jsonObject)
+	o.set(r.CanViewProperty("Category"), "category", r.record.Category)
+	o.set(r.CanViewProperty("Description"), "description", r.record.Description)
+	o.set(r.CanViewProperty("StartDate"), "start_date", r.record.StartDate)
+	o.set(r.CanViewProperty("StartDate"), "end_date", r.record.EndDate)
+	o.set(r.CanViewProperty("Count"), "count", float64(r.record.Count))
+	o.set(r.CanViewProperty("CountUnit"), "count_unit", r.record.CountUnit)
+	o.set(r.CanViewProperty("Usage"), "usage", float64(r.record.Usage))
+	o.set(r.CanViewProperty("UsageUnit"), "usage_unit", r.record.UsageUnit)
+	o.set(r.CanViewProperty("Price"), "price", float64(r.record.Price))
+	o.set(r.CanViewProperty("PriceUnit"), "price_unit", r.record.PriceUnit)
+	return json.Marshal(o)
+}
+
+// MarshalJSON serializes the Usage as an object with the records for each
+// category, oldest first.
+func (u *Usage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"period":     u.period,
+		"start_date": u.start.Format(UsageDateFormat),
+		"end_date":   u.end.Format(UsageDateFormat),
+		"categories": u.records,
+	})
+}
@@ -0,0 +1,95 @@
+package views
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+)
+
+func TestMessageJSONOmitsHiddenFields(t *testing.T) {
+	s := config.AllUserSettings()
+	s.CanViewMessageBody = false
+	s.CanViewMessagePrice = false
+	tmsg := &twilio.Message{
+		Sid:         "SM123",
+		Body:        "secret",
+		From:        twilio.PhoneNumber("+14105551234"),
+		Price:       "-0.0075",
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}
+	msg, err := NewMessage(tmsg, config.NewPermission(time.Hour), config.NewUser(s), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"body", "num_segments", "price", "price_unit"} {
+		if _, ok := m[key]; ok {
+			t.Errorf("expected %q to be omitted, got %s", key, b)
+		}
+	}
+	if m["sid"] != "SM123" {
+		t.Errorf("expected sid to be SM123, got %v", m["sid"])
+	}
+	if m["from"] != "+14105551234" {
+		t.Errorf("expected from to be +14105551234, got %v", m["from"])
+	}
+}
+
+func TestEmptyPageJSON(t *testing.T) {
+	b, err := json.Marshal(new(MessagePage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "[]" {
+		t.Errorf("expected empty page to serialize to [], got %s", b)
+	}
+}
+
+func TestMessageJSONRedactsBody(t *testing.T) {
+	p := &config.Policy{&config.Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: config.AllUserSettings(),
+		Redactions:  []*config.Redaction{{Name: "codes", Pattern: `\d{6}`}},
+	}}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmsg := &twilio.Message{
+		Sid:         "SM123",
+		Body:        "Your code is 123456",
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}
+	msg, err := NewMessage(tmsg, config.NewPermission(time.Hour), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := msg.Body(); body != "Your code is [redacted]" {
+		t.Errorf("expected body to be redacted, got %q", body)
+	}
+	if !msg.Redacted() {
+		t.Error("expected Redacted to be true")
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["body"] != "Your code is [redacted]" {
+		t.Errorf("expected JSON body to be redacted, got %v", m["body"])
+	}
+}
@@ -0,0 +1,99 @@
+package views
+
+import (
+	"net/url"
+	"strings"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/services"
+)
+
+// The character we show in place of each hidden digit.
+const maskChar = "•"
+
+// A MaskedNumber is a phone number the user can only see part of.
+type MaskedNumber struct {
+	// The country code and the last few digits of the number, for example
+	// "+1 •••••••4412".
+	Display string
+	// A link to a search for the number. The full number is encrypted in the
+	// link, so the user can't see it.
+	URL string
+}
+
+func (m *MaskedNumber) String() string {
+	return m.Display
+}
+
+// newMaskedNumber masks pn for u, and links to a search for it at path, with
+// the encrypted number in the given query parameter. If key is nil, the
+// MaskedNumber has no URL.
+func newMaskedNumber(pn twilio.PhoneNumber, digits int, key *[32]byte, path string, param string) *MaskedNumber {
+	m := &MaskedNumber{Display: MaskPhoneNumber(pn, digits)}
+	if key != nil && pn != "" {
+		m.URL = path + "?" + param + "=" + url.QueryEscape(services.Opaque(string(pn), key))
+	}
+	return m
+}
+
+// MaskPhoneNumber returns the country code and the last digits of pn, with the
+// rest replaced by dots. Numbers that aren't in E.164 format, like short
+// codes or client identifiers, only show the last digits.
+func MaskPhoneNumber(pn twilio.PhoneNumber, digits int) string {
+	s := string(pn)
+	var prefix string
+	if strings.HasPrefix(s, "+") && isDigits(s[1:]) {
+		cc := countryCode(s[1:])
+		prefix = "+" + cc + " "
+		s = s[1+len(cc):]
+	}
+	if digits > len(s) {
+		digits = len(s)
+	}
+	// Don't reveal the whole number if it's very short.
+	if digits == len(s) && digits > 0 {
+		digits = len(s) / 2
+	}
+	return prefix + strings.Repeat(maskChar, len(s)-digits) + s[len(s)-digits:]
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Country calling codes are prefix-free: 1 and 7 are the only one-digit codes,
+// these are the two-digit codes, and every other code has three digits.
+// https://en.wikipedia.org/wiki/List_of_country_calling_codes
+var twoDigitCountryCodes = map[string]bool{
+	"20": true, "27": true, "30": true, "31": true, "32": true, "33": true,
+	"34": true, "36": true, "39": true, "40": true, "41": true, "43": true,
+	"44": true, "45": true, "46": true, "47": true, "48": true, "49": true,
+	"51": true, "52": true, "53": true, "54": true, "55": true, "56": true,
+	"57": true, "58": true, "60": true, "61": true, "62": true, "63": true,
+	"64": true, "65": true, "66": true, "81": true, "82": true, "84": true,
+	"86": true, "90": true, "91": true, "92": true, "93": true, "94": true,
+	"95": true, "98": true,
+}
+
+// countryCode returns the country calling code at the start of digits, a
+// phone number in E.164 format without the leading "+".
+func countryCode(digits string) string {
+	switch {
+	case digits[0] == '1' || digits[0] == '7':
+		return digits[:1]
+	case len(digits) >= 2 && twoDigitCountryCodes[digits[:2]]:
+		return digits[:2]
+	case len(digits) >= 3:
+		return digits[:3]
+	default:
+		return digits
+	}
+}
@@ -0,0 +1,67 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+)
+
+var maskTests = []struct {
+	in     twilio.PhoneNumber
+	digits int
+	out    string
+}{
+	{"+14105554412", 4, "+1 ••••••4412"},
+	{"+447700900123", 3, "+44 •••••••123"},
+	{"+353861234567", 4, "+353 •••••4567"},
+	{"+14105554412", 0, "+1 ••••••••••"},
+	{"+14105554412", 20, "+1 •••••54412"},
+	{"86753", 2, "•••53"},
+	{"client:alice", 4, "••••••••lice"},
+}
+
+func TestMaskPhoneNumber(t *testing.T) {
+	t.Parallel()
+	for _, tt := range maskTests {
+		if out := MaskPhoneNumber(tt.in, tt.digits); out != tt.out {
+			t.Errorf("MaskPhoneNumber(%q, %d): got %q, want %q", tt.in, tt.digits, out, tt.out)
+		}
+	}
+}
+
+func TestMaskedFrom(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.CanViewMessageFrom = false
+	us.CanViewMaskedMessageFrom = true
+	u := config.NewUser(us)
+	tmsg := &twilio.Message{
+		Sid:         "SM123",
+		From:        twilio.PhoneNumber("+14105554412"),
+		To:          twilio.PhoneNumber("+19253920364"),
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}
+	msg, err := NewMessage(tmsg, config.NewPermission(time.Hour), u, services.NewRandomKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := msg.From(); err != config.PermissionDenied {
+		t.Errorf("expected PermissionDenied viewing the sender, got %v", err)
+	}
+	m, err := msg.MaskedFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Display != "+1 ••••••4412" {
+		t.Errorf("expected masked sender, got %q", m.Display)
+	}
+	if m.URL == "" {
+		t.Fatal("expected masked sender to link to a search, got empty URL")
+	}
+	if _, err := msg.MaskedTo(); err != config.PermissionDenied {
+		t.Errorf("expected PermissionDenied for a masked recipient the user can see in full, got %v", err)
+	}
+}
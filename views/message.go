@@ -11,12 +11,18 @@ import (
 type Message struct {
 	user    *config.User
 	message *twilio.Message
+	// Used to encrypt phone numbers in the links from masked numbers, and
+	// to derive pseudonyms.
+	secretKey *[32]byte
 }
 
 type MessagePage struct {
 	messages        []*Message
 	previousPageURI types.NullString
 	nextPageURI     types.NullString
+	// True if the page came from the cache after it expired, and is being
+	// refreshed.
+	stale bool
 }
 
 func (mp *MessagePage) Messages() []*Message {
@@ -27,6 +33,12 @@ func (mp *MessagePage) NextPageURI() types.NullString {
 	return mp.nextPageURI
 }
 
+// Stale returns true if the page is an expired cache value. A fresh copy is
+// being fetched in the background.
+func (mp *MessagePage) Stale() bool {
+	return mp.stale
+}
+
 func (mp *MessagePage) PreviousPageURI() types.NullString {
 	return mp.previousPageURI
 }
@@ -52,14 +64,19 @@ func (mp *MessagePage) ShowHeader(fieldName string) bool {
 	return false
 }
 
-func NewMessagePage(mp *twilio.MessagePage, p *config.Permission, u *config.User) (*MessagePage, error) {
+func NewMessagePage(mp *twilio.MessagePage, p *config.Permission, u *config.User, key *[32]byte) (*MessagePage, error) {
 	if u.CanViewMessages() == false {
 		return nil, config.PermissionDenied
 	}
 	messages := make([]*Message, 0)
+	tooOld := false
 	for _, message := range mp.Messages {
-		msg, err := NewMessage(message, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		msg, err := NewMessage(message, p, u, key)
+		if err == config.ErrTooOld {
+			tooOld = true
+			continue
+		}
+		if err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -67,8 +84,10 @@ func NewMessagePage(mp *twilio.MessagePage, p *config.Permission, u *config.User
 		}
 		messages = append(messages, msg)
 	}
+	// If every message on the page is too old, so is every message on the next
+	// page. Out of scope messages don't tell us anything about the next page.
 	var npuri types.NullString
-	if len(messages) > 0 {
+	if len(messages) > 0 || !tooOld {
 		npuri = mp.NextPageURI
 	}
 	return &MessagePage{
@@ -98,6 +117,14 @@ func (m *Message) CanViewProperty(property string) bool {
 		return m.user.CanViewMessageFrom()
 	case "To":
 		return m.user.CanViewMessageTo()
+	case "MaskedFrom":
+		return m.user.CanViewMaskedMessageFrom()
+	case "MaskedTo":
+		return m.user.CanViewMaskedMessageTo()
+	case "PseudonymousFrom":
+		return m.user.CanViewPseudonymousMessageFrom()
+	case "PseudonymousTo":
+		return m.user.CanViewPseudonymousMessageTo()
 	case "Body", "NumSegments":
 		return m.user.CanViewMessageBody()
 	default:
@@ -145,6 +172,46 @@ func (m *Message) To() (twilio.PhoneNumber, error) {
 	}
 }
 
+// MaskedFrom returns a masked copy of the sender's number, for users who can't
+// view the full number.
+func (m *Message) MaskedFrom() (*MaskedNumber, error) {
+	if m.CanViewProperty("MaskedFrom") {
+		return newMaskedNumber(m.message.From, m.user.MaskedDigits(), m.secretKey, "/messages", "masked-from"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
+// MaskedTo returns a masked copy of the recipient's number, for users who
+// can't view the full number.
+func (m *Message) MaskedTo() (*MaskedNumber, error) {
+	if m.CanViewProperty("MaskedTo") {
+		return newMaskedNumber(m.message.To, m.user.MaskedDigits(), m.secretKey, "/messages", "masked-to"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
+// PseudonymousFrom returns a pseudonym for the sender, for users who can't
+// view their number.
+func (m *Message) PseudonymousFrom() (*Pseudonym, error) {
+	if m.CanViewProperty("PseudonymousFrom") {
+		return newPseudonym(m.message.From, m.secretKey, "/messages", "pseudonym-from"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
+// PseudonymousTo returns a pseudonym for the recipient, for users who can't view
+// their number.
+func (m *Message) PseudonymousTo() (*Pseudonym, error) {
+	if m.CanViewProperty("PseudonymousTo") {
+		return newPseudonym(m.message.To, m.secretKey, "/messages", "pseudonym-to"), nil
+	} else {
+		return nil, config.PermissionDenied
+	}
+}
+
 func (m *Message) MessagingServiceSid() (types.NullString, error) {
 	if m.CanViewProperty("MessagingServiceSid") {
 		return m.message.MessagingServiceSid, nil
@@ -193,14 +260,25 @@ func (m *Message) FriendlyPrice() (string, error) {
 	}
 }
 
+// Body returns the message body, with the user's redaction rules applied.
 func (m *Message) Body() (string, error) {
 	if m.CanViewProperty("Body") {
-		return m.message.Body, nil
+		body, _ := m.user.Redact(m.message.Body)
+		return body, nil
 	} else {
 		return "", config.PermissionDenied
 	}
 }
 
+// Redacted returns true if a redaction rule hid part of the message body.
+func (m *Message) Redacted() bool {
+	if !m.CanViewProperty("Body") {
+		return false
+	}
+	_, redacted := m.user.Redact(m.message.Body)
+	return redacted
+}
+
 func (m *Message) NumSegments() (twilio.Segments, error) {
 	if m.CanViewProperty("NumSegments") {
 		return m.message.NumSegments, nil
@@ -232,7 +310,7 @@ func (m *Message) CanViewMedia() bool {
 
 // NewMessage creates a new Message, setting fields to be hidden or shown as
 // appropriate for the given Permission and User.
-func NewMessage(msg *twilio.Message, p *config.Permission, u *config.User) (*Message, error) {
+func NewMessage(msg *twilio.Message, p *config.Permission, u *config.User, key *[32]byte) (*Message, error) {
 	if u.CanViewMessages() == false {
 		return nil, config.PermissionDenied
 	}
@@ -242,5 +320,8 @@ func NewMessage(msg *twilio.Message, p *config.Permission, u *config.User) (*Mes
 	if !u.CanViewResource(msg.DateCreated.Time, p.MaxResourceAge()) {
 		return nil, config.ErrTooOld
 	}
-	return &Message{user: u, message: msg}, nil
+	if !u.CanViewAnyPhoneNumber(p, msg.From, msg.To) {
+		return nil, config.ErrOutOfScope
+	}
+	return &Message{user: u, message: msg, secretKey: key}, nil
 }
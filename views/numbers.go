@@ -12,6 +12,9 @@ type IncomingNumberPage struct {
 	numbers         []*IncomingNumber
 	nextPageURI     types.NullString
 	previousPageURI types.NullString
+	// True if the page came from the cache after it expired, and is being
+	// refreshed.
+	stale bool
 }
 
 func (p *IncomingNumberPage) Numbers() []*IncomingNumber {
@@ -22,6 +25,12 @@ func (p *IncomingNumberPage) NextPageURI() types.NullString {
 	return p.nextPageURI
 }
 
+// Stale returns true if the page is an expired cache value. A fresh copy is
+// being fetched in the background.
+func (p *IncomingNumberPage) Stale() bool {
+	return p.stale
+}
+
 func (p *IncomingNumberPage) PreviousPageURI() types.NullString {
 	return p.previousPageURI
 }
@@ -37,6 +46,9 @@ func NewIncomingNumber(pn *twilio.IncomingPhoneNumber, p *config.Permission, u *
 	}
 	// NB: Phone numbers are *exempt* from max resource age rules, they don't
 	// really make sense.
+	if !u.CanViewPhoneNumber(pn.PhoneNumber, pn.Sid) {
+		return nil, config.ErrOutOfScope
+	}
 	return &IncomingNumber{user: u, number: pn}, nil
 }
 
@@ -44,7 +56,7 @@ func NewIncomingNumberPage(pn *twilio.IncomingPhoneNumberPage, p *config.Permiss
 	numbers := make([]*IncomingNumber, 0)
 	for _, number := range pn.IncomingPhoneNumbers {
 		num, err := NewIncomingNumber(number, p, u)
-		if err == config.ErrTooOld || err == config.PermissionDenied {
+		if err == config.ErrTooOld || err == config.PermissionDenied || err == config.ErrOutOfScope {
 			continue
 		}
 		if err != nil {
@@ -52,8 +64,9 @@ func NewIncomingNumberPage(pn *twilio.IncomingPhoneNumberPage, p *config.Permiss
 		}
 		numbers = append(numbers, num)
 	}
+	// Out of scope numbers don't tell us anything about the next page.
 	var npuri types.NullString
-	if len(numbers) > 0 {
+	if len(numbers) > 0 || u.HasPhoneNumberScope() {
 		npuri = pn.NextPageURI
 	}
 	return &IncomingNumberPage{
@@ -102,6 +115,26 @@ func (n *IncomingNumber) CanViewProperty(property string) bool {
 	}
 }
 
+// callbackURLs returns every URL Twilio calls for the number.
+func (n *IncomingNumber) callbackURLs() []string {
+	return []string{n.number.VoiceURL, n.number.VoiceFallbackURL,
+		n.number.SMSURL, n.number.SMSFallbackURL, n.number.StatusCallback}
+}
+
+// Redacted returns true if a redaction rule hid part of any of the number's
+// callback URLs.
+func (n *IncomingNumber) Redacted() bool {
+	if !n.CanViewProperty("VoiceURL") {
+		return false
+	}
+	for _, u := range n.callbackURLs() {
+		if _, redacted := n.user.Redact(u); redacted {
+			return true
+		}
+	}
+	return false
+}
+
 func (n *IncomingNumber) Sid() (string, error) {
 	if n.CanViewProperty("Sid") {
 		return n.number.Sid, nil
@@ -144,7 +177,8 @@ func (n *IncomingNumber) FriendlyName() (string, error) {
 
 func (n *IncomingNumber) VoiceURL() (string, error) {
 	if n.CanViewProperty("VoiceURL") {
-		return n.number.VoiceURL, nil
+		u, _ := n.user.Redact(n.number.VoiceURL)
+		return u, nil
 	} else {
 		return "", config.PermissionDenied
 	}
@@ -160,7 +194,8 @@ func (n *IncomingNumber) VoiceMethod() (string, error) {
 
 func (n *IncomingNumber) SMSURL() (string, error) {
 	if n.CanViewProperty("SMSURL") {
-		return n.number.SMSURL, nil
+		u, _ := n.user.Redact(n.number.SMSURL)
+		return u, nil
 	} else {
 		return "", config.PermissionDenied
 	}
@@ -184,7 +219,8 @@ func (n *IncomingNumber) SMSMethod() (string, error) {
 
 func (n *IncomingNumber) StatusCallback() (string, error) {
 	if n.CanViewProperty("StatusCallback") {
-		return n.number.StatusCallback, nil
+		u, _ := n.user.Redact(n.number.StatusCallback)
+		return u, nil
 	} else {
 		return "", config.PermissionDenied
 	}
@@ -208,7 +244,8 @@ func (n *IncomingNumber) VoiceFallbackMethod() (string, error) {
 
 func (n *IncomingNumber) VoiceFallbackURL() (string, error) {
 	if n.CanViewProperty("VoiceFallbackURL") {
-		return n.number.VoiceFallbackURL, nil
+		u, _ := n.user.Redact(n.number.VoiceFallbackURL)
+		return u, nil
 	} else {
 		return "", config.PermissionDenied
 	}
@@ -224,7 +261,8 @@ func (n *IncomingNumber) SMSFallbackMethod() (string, error) {
 
 func (n *IncomingNumber) SMSFallbackURL() (string, error) {
 	if n.CanViewProperty("SMSFallbackURL") {
-		return n.number.SMSFallbackURL, nil
+		u, _ := n.user.Redact(n.number.SMSFallbackURL)
+		return u, nil
 	} else {
 		return "", config.PermissionDenied
 	}
@@ -0,0 +1,191 @@
+package views
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kevinburke/rest"
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"golang.org/x/net/context"
+)
+
+// The Participants resource only lists the participants in a conference
+// that's in progress. Twilio's Voice Insights API lists the participants in
+// a completed conference.
+var insightsBaseURL = "https://insights.twilio.com/v1"
+
+// Don't fetch more calls than this for a single conference.
+const maxParticipants = 100
+
+// twilio-go doesn't have a Participants resource, so we decode them
+// ourselves.
+type twilioParticipant struct {
+	CallSid     string            `json:"call_sid"`
+	DateCreated twilio.TwilioTime `json:"date_created"`
+	Muted       bool              `json:"muted"`
+	Hold        bool              `json:"hold"`
+}
+
+type twilioParticipantPage struct {
+	Participants []*twilioParticipant `json:"participants"`
+}
+
+type insightsParticipant struct {
+	CallSid   string    `json:"call_sid"`
+	JoinTime  time.Time `json:"join_time"`
+	LeaveTime time.Time `json:"leave_time"`
+}
+
+type insightsParticipantPage struct {
+	Participants []*insightsParticipant `json:"participants"`
+}
+
+// A Participant is a call that joined a conference.
+type Participant struct {
+	callSid   string
+	call      *Call
+	joinTime  twilio.TwilioTime
+	leaveTime twilio.TwilioTime
+	// Only known for conferences that are in progress.
+	live  bool
+	muted bool
+	hold  bool
+}
+
+// Call returns the participant's call. Use it to show the participant's
+// phone numbers and link to the call.
+func (p *Participant) Call() *Call {
+	return p.call
+}
+
+// JoinTime returns the time the participant joined the conference.
+func (p *Participant) JoinTime() twilio.TwilioTime {
+	return p.joinTime
+}
+
+// LeaveTime returns the time the participant left the conference. It's
+// invalid if the participant is still in the conference.
+func (p *Participant) LeaveTime() twilio.TwilioTime {
+	return p.leaveTime
+}
+
+// Live returns true if the participant is in a conference that's in
+// progress, so Muted and Hold are known.
+func (p *Participant) Live() bool {
+	return p.live
+}
+
+// Muted returns true if the participant is muted.
+func (p *Participant) Muted() bool {
+	return p.muted
+}
+
+// Hold returns true if the participant is on hold.
+func (p *Participant) Hold() bool {
+	return p.hold
+}
+
+type participantsByJoinTime []*Participant
+
+func (p participantsByJoinTime) Len() int      { return len(p) }
+func (p participantsByJoinTime) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p participantsByJoinTime) Less(i, j int) bool {
+	return p[i].joinTime.Time.Before(p[j].joinTime.Time)
+}
+
+func validTime(t time.Time) twilio.TwilioTime {
+	return twilio.TwilioTime{Time: t, Valid: !t.IsZero()}
+}
+
+// getLiveParticipants fetches the participants in a conference that's in
+// progress.
+func (vc *client) getLiveParticipants(ctx context.Context, sid string) ([]*Participant, error) {
+	page := new(twilioParticipantPage)
+	data := url.Values{"PageSize": []string{"100"}}
+	if err := vc.client.ListResource(ctx, "Conferences/"+sid+"/Participants", data, page); err != nil {
+		return nil, err
+	}
+	participants := make([]*Participant, len(page.Participants))
+	for i, tp := range page.Participants {
+		participants[i] = &Participant{
+			callSid:  tp.CallSid,
+			joinTime: tp.DateCreated,
+			live:     true,
+			muted:    tp.Muted,
+			hold:     tp.Hold,
+		}
+	}
+	return participants, nil
+}
+
+// getCompletedParticipants fetches the participants in a completed conference
+// from the Voice Insights API.
+func (vc *client) getCompletedParticipants(ctx context.Context, sid string) ([]*Participant, error) {
+	c := rest.NewClient(vc.client.AccountSid, vc.client.AuthToken, insightsBaseURL)
+	req, err := c.NewRequest("GET", "/Conferences/"+sid+"/Participants?PageSize=100", nil)
+	if err != nil {
+		return nil, err
+	}
+	page := new(insightsParticipantPage)
+	if err := c.Do(req.WithContext(ctx), page); err != nil {
+		return nil, err
+	}
+	participants := make([]*Participant, len(page.Participants))
+	for i, ip := range page.Participants {
+		participants[i] = &Participant{
+			callSid:   ip.CallSid,
+			joinTime:  validTime(ip.JoinTime),
+			leaveTime: validTime(ip.LeaveTime),
+		}
+	}
+	return participants, nil
+}
+
+// GetConferenceParticipants fetches the participants in a conference, and the
+// call for each participant, sorted by the time they joined. live should be
+// true if the conference is in progress. Participants whose calls the user
+// can't view are left out.
+func (vc *client) GetConferenceParticipants(ctx context.Context, u *config.User, sid string, live bool) ([]*Participant, error) {
+	if !u.CanViewCalls() {
+		return nil, config.PermissionDenied
+	}
+	var participants []*Participant
+	var err error
+	if live {
+		participants, err = vc.getLiveParticipants(ctx, sid)
+	} else {
+		participants, err = vc.getCompletedParticipants(ctx, sid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(participants) > maxParticipants {
+		participants = participants[:maxParticipants]
+	}
+	errs := make([]error, len(participants))
+	var wg sync.WaitGroup
+	for i, p := range participants {
+		wg.Add(1)
+		go func(i int, p *Participant) {
+			defer wg.Done()
+			p.call, errs[i] = vc.GetCall(ctx, u, p.callSid)
+		}(i, p)
+	}
+	wg.Wait()
+	visible := make([]*Participant, 0, len(participants))
+	for i, p := range participants {
+		if errs[i] == nil {
+			visible = append(visible, p)
+			continue
+		}
+		if hiddenCall(errs[i]) {
+			continue
+		}
+		return nil, errs[i]
+	}
+	sort.Sort(participantsByJoinTime(visible))
+	return visible, nil
+}
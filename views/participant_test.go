@@ -0,0 +1,75 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"golang.org/x/net/context"
+)
+
+const participantsBody = `{"participants": [
+	{"call_sid": "CA2", "join_time": "2016-10-27T19:25:00Z", "leave_time": "2016-10-27T19:35:00Z"},
+	{"call_sid": "CA1", "join_time": "2016-10-27T19:20:00Z", "leave_time": "2016-10-27T19:30:00Z"},
+	{"call_sid": "CA404", "join_time": "2016-10-27T19:21:00Z", "leave_time": "2016-10-27T19:22:00Z"}
+]}`
+
+func TestGetCompletedConferenceParticipants(t *testing.T) {
+	created := time.Now().UTC().Format(time.RFC1123Z)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.URL.Path == "/Conferences/CF123/Participants" {
+			w.Write([]byte(participantsBody))
+			return
+		}
+		for _, sid := range []string{"CA1", "CA2"} {
+			if strings.HasSuffix(r.URL.Path, "/Calls/"+sid+".json") {
+				fmt.Fprintf(w, `{"sid": %q, "from": "+14105551234", "to": "+19253920364", "status": "completed", "date_created": %q}`, sid, created)
+				return
+			}
+		}
+		w.WriteHeader(404)
+		w.Write([]byte(`{"code": 20404, "message": "The requested resource was not found", "status": 404}`))
+	}))
+	defer s.Close()
+	oldBase := insightsBaseURL
+	insightsBaseURL = s.URL
+	defer func() { insightsBaseURL = oldBase }()
+
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = s.URL
+	l := log.New()
+	l.SetHandler(log.DiscardHandler())
+	vc := NewClient(l, c, services.NewRandomKey(), config.NewPermission(config.DefaultMaxResourceAge))
+	u := config.NewUser(config.AllUserSettings())
+	participants, err := vc.GetConferenceParticipants(context.Background(), u, "CF123", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(participants) != 2 {
+		t.Fatalf("expected the call that 404s to be dropped, got %d participants", len(participants))
+	}
+	for i, want := range []string{"CA1", "CA2"} {
+		if sid, _ := participants[i].Call().Sid(); sid != want {
+			t.Errorf("participant %d: expected call %s, got %s", i, want, sid)
+		}
+		if participants[i].Live() {
+			t.Errorf("participant %d: expected participant in a completed conference to not be live", i)
+		}
+	}
+	if !participants[0].LeaveTime().Valid {
+		t.Error("expected leave time to be valid")
+	}
+
+	u = config.NewUser(&config.UserSettings{CanViewConferences: true})
+	if _, err := vc.GetConferenceParticipants(context.Background(), u, "CF123", false); err != config.PermissionDenied {
+		t.Errorf("expected PermissionDenied for a user who can't view calls, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package views
+
+import (
+	"net/url"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/services"
+)
+
+// A Pseudonym stands in for a phone number the user can't see. It's the same
+// on every page, so users can tell customers apart.
+type Pseudonym struct {
+	// For example "cust-7f3a9c01".
+	ID string
+	// A link to a search for the number. The number is encrypted in the
+	// link, so the user can't see it.
+	URL string
+}
+
+func (p *Pseudonym) String() string {
+	return p.ID
+}
+
+// newPseudonym returns the pseudonym for pn, with a link to a search for it
+// at path, with the encrypted number in the given query parameter.
+func newPseudonym(pn twilio.PhoneNumber, key *[32]byte, path string, param string) *Pseudonym {
+	return &Pseudonym{
+		ID:  services.Pseudonym(string(pn), key),
+		URL: path + "?" + param + "=" + url.QueryEscape(services.Opaque(string(pn), key)),
+	}
+}
@@ -0,0 +1,49 @@
+package views
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+)
+
+func TestPseudonymousFrom(t *testing.T) {
+	t.Parallel()
+	us := config.AllUserSettings()
+	us.CanViewCallFrom = false
+	us.PseudonymousNumbers = true
+	key := services.NewRandomKey()
+	tcall := &twilio.Call{
+		Sid:         "CA123",
+		From:        twilio.PhoneNumber("+14105559876"),
+		To:          twilio.PhoneNumber("+19253920364"),
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}
+	call, err := NewCall(tcall, config.NewPermission(time.Hour), config.NewUser(us), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := call.PseudonymousFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != services.Pseudonym("+14105559876", key) {
+		t.Errorf("expected pseudonym for the caller, got %s", p.ID)
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/calls" {
+		t.Errorf("expected pseudonym to link to a search, got %s", p.URL)
+	}
+	if pn, err := services.Unopaque(u.Query().Get("pseudonym-from"), key); err != nil || pn != "+14105559876" {
+		t.Errorf("expected link to hold the encrypted caller, got %q (err %v)", pn, err)
+	}
+	if _, err := call.PseudonymousTo(); err != config.PermissionDenied {
+		t.Errorf("expected PermissionDenied for a recipient the user can see, got %v", err)
+	}
+}
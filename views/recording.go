@@ -10,8 +10,12 @@ import (
 )
 
 type RecordingPage struct {
-	recordings  []*Recording
-	nextPageURI types.NullString
+	recordings      []*Recording
+	nextPageURI     types.NullString
+	previousPageURI types.NullString
+	// True if the page came from the cache after it expired, and is being
+	// refreshed.
+	stale bool
 }
 
 func (r *RecordingPage) Recordings() []*Recording {
@@ -22,6 +26,16 @@ func (r *RecordingPage) NextPageURI() types.NullString {
 	return r.nextPageURI
 }
 
+func (r *RecordingPage) PreviousPageURI() types.NullString {
+	return r.previousPageURI
+}
+
+// Stale returns true if the page is an expired cache value. A fresh copy is
+// being fetched in the background.
+func (r *RecordingPage) Stale() bool {
+	return r.stale
+}
+
 type Recording struct {
 	user      *config.User
 	recording *twilio.Recording
@@ -32,7 +46,7 @@ type Recording struct {
 
 func (r *Recording) CanViewProperty(property string) bool {
 	switch property {
-	case "Sid", "DateCreated", "DateUpdated", "Duration":
+	case "Sid", "DateCreated", "DateUpdated", "Duration", "CallSid":
 		return r.user.CanPlayRecordings()
 	case "Price", "PriceUnit":
 		return r.user.CanViewRecordingPrice()
@@ -65,6 +79,16 @@ func (r *Recording) DateCreated() (twilio.TwilioTime, error) {
 	}
 }
 
+// CallSid returns the sid of the call that was recorded, or the empty string
+// if the recording doesn't belong to a call.
+func (r *Recording) CallSid() (string, error) {
+	if r.CanViewProperty("CallSid") {
+		return r.recording.CallSid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
 func (r *Recording) Price() (string, error) {
 	if r.CanViewProperty("Price") {
 		return r.recording.Price, nil
@@ -136,5 +160,9 @@ func NewRecordingPage(rp *twilio.RecordingPage, p *config.Permission, u *config.
 		}
 		recordings = append(recordings, recording)
 	}
-	return &RecordingPage{recordings: recordings, nextPageURI: rp.NextPageURI}, nil
+	return &RecordingPage{
+		recordings:      recordings,
+		nextPageURI:     rp.NextPageURI,
+		previousPageURI: rp.PreviousPageURI,
+	}, nil
 }
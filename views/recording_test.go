@@ -0,0 +1,64 @@
+package views
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	types "github.com/kevinburke/go-types"
+	twilio "github.com/saintpete/twilio-go"
+)
+
+func recordingAt(sid string, t time.Time) *twilio.Recording {
+	return &twilio.Recording{Sid: sid, DateCreated: twilio.TwilioTime{Time: t, Valid: true}}
+}
+
+func TestFilterRecordings(t *testing.T) {
+	t.Parallel()
+	end := time.Date(2016, 11, 10, 12, 0, 0, 0, time.UTC)
+	start := end.Add(-2 * time.Hour)
+	page := &twilio.RecordingPage{
+		Recordings: []*twilio.Recording{
+			recordingAt("RE1", end.Add(time.Minute)),
+			recordingAt("RE2", end.Add(-time.Hour)),
+			recordingAt("RE3", start.Add(-time.Minute)),
+		},
+	}
+	page.NextPageURI = types.NullString{Valid: true, String: "/2010-04-01/Accounts/AC123/Recordings.json?Page=1"}
+	if allNewer := filterRecordings(page, start, end); allNewer {
+		t.Errorf("expected allNewer to be false")
+	}
+	if len(page.Recordings) != 1 || page.Recordings[0].Sid != "RE2" {
+		t.Errorf("expected only RE2 to be in range, got %d recordings", len(page.Recordings))
+	}
+	if page.NextPageURI.Valid {
+		t.Errorf("expected next page to be cleared, got %s", page.NextPageURI.String)
+	}
+
+	page = &twilio.RecordingPage{
+		Recordings: []*twilio.Recording{recordingAt("RE1", end.Add(time.Hour))},
+	}
+	if allNewer := filterRecordings(page, start, end); !allNewer {
+		t.Errorf("expected allNewer to be true")
+	}
+}
+
+func TestRecordingDateFilters(t *testing.T) {
+	t.Parallel()
+	data := url.Values{"CallSid": []string{"CA123"}}
+	end := time.Date(2016, 11, 10, 12, 0, 0, 0, time.UTC)
+	filters := recordingDateFilters(end.Add(-48*time.Hour), end, data)
+	if v := filters.Get("DateCreated>="); v != "2016-11-08" {
+		t.Errorf("expected DateCreated>= to be 2016-11-08, got %q", v)
+	}
+	if v := filters.Get("DateCreated<="); v != "2016-11-10" {
+		t.Errorf("expected DateCreated<= to be 2016-11-10, got %q", v)
+	}
+	if _, ok := data["DateCreated>="]; ok {
+		t.Errorf("recordingDateFilters should not modify data")
+	}
+	filters = recordingDateFilters(twilio.Epoch, twilio.HeatDeath, data)
+	if len(filters) != 1 {
+		t.Errorf("expected only the CallSid filter, got %v", filters)
+	}
+}
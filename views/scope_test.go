@@ -0,0 +1,79 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	types "github.com/kevinburke/go-types"
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"golang.org/x/net/context"
+)
+
+func TestMessagePageDropsOutOfScope(t *testing.T) {
+	t.Parallel()
+	policy := &config.Policy{&config.Group{
+		Name:         "support",
+		Users:        []string{"test@example.com"},
+		Permissions:  config.AllUserSettings(),
+		PhoneNumbers: []string{"+19253920364"},
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := twilio.TwilioTime{Valid: true, Time: time.Now()}
+	other := &twilio.Message{Sid: "SM123", From: "+14105551234", To: "+14105559876", DateCreated: now}
+	p := config.NewPermission(time.Hour)
+	if _, err := NewMessage(other, p, u, nil); err != config.ErrOutOfScope {
+		t.Errorf("expected ErrOutOfScope, got %v", err)
+	}
+	mp := &twilio.MessagePage{
+		Messages: []*twilio.Message{
+			other,
+			{Sid: "SM456", From: "+14105551234", To: "+19253920364", DateCreated: now},
+		},
+		Page: twilio.Page{NextPageURI: types.NullString{Valid: true, String: "/next"}},
+	}
+	page, err := NewMessagePage(mp, p, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := page.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected only the message to the group's number, got %d messages", len(msgs))
+	}
+	if sid, _ := msgs[0].Sid(); sid != "SM456" {
+		t.Errorf("expected message SM456, got %s", sid)
+	}
+	mp.Messages = mp.Messages[:1]
+	page, err = NewMessagePage(mp, p, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.NextPageURI().Valid {
+		t.Error("expected a page with no messages in scope to keep the next page")
+	}
+}
+
+func TestAlertOutOfScope(t *testing.T) {
+	t.Parallel()
+	policy := &config.Policy{&config.Group{
+		Name:         "support",
+		Users:        []string{"test@example.com"},
+		Permissions:  config.AllUserSettings(),
+		PhoneNumbers: []string{"+19253920364"},
+	}}
+	u, _, err := policy.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc := new(client)
+	alert := &twilio.Alert{Sid: "NO123", ResourceSid: "PNca86cf94c7d4f89e0bd45bfa7d9b9e7d"}
+	if err := vc.checkAlertResource(context.Background(), u, alert); err != config.ErrOutOfScope {
+		t.Errorf("expected ErrOutOfScope for an alert that isn't for a message or call, got %v", err)
+	}
+	if err := vc.checkAlertResource(context.Background(), config.DefaultUser, alert); err != nil {
+		t.Errorf("expected users without a scope to see every alert, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package views
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"golang.org/x/net/context"
+)
+
+// twilio-go doesn't have a Transcriptions resource, so we decode them
+// ourselves.
+type twilioTranscription struct {
+	Sid          string                `json:"sid"`
+	DateCreated  twilio.TwilioTime     `json:"date_created"`
+	Status       string                `json:"status"`
+	RecordingSid string                `json:"recording_sid"`
+	Duration     twilio.TwilioDuration `json:"duration"`
+	Text         string                `json:"transcription_text"`
+}
+
+type twilioTranscriptionPage struct {
+	Transcriptions []*twilioTranscription `json:"transcriptions"`
+}
+
+// A Transcription is the text of a recording.
+type Transcription struct {
+	user          *config.User
+	transcription *twilioTranscription
+	// The call that was recorded. Only set for transcriptions retrieved with
+	// GetTranscription.
+	callSid string
+}
+
+func newTranscription(t *twilioTranscription, p *config.Permission, u *config.User) (*Transcription, error) {
+	if !u.CanPlayRecordings() || !u.CanViewTranscriptions() {
+		return nil, config.PermissionDenied
+	}
+	if t.DateCreated.Valid == false {
+		return nil, errors.New("Invalid DateCreated for transcription")
+	}
+	if !u.CanViewResource(t.DateCreated.Time, p.MaxResourceAge()) {
+		return nil, config.ErrTooOld
+	}
+	return &Transcription{user: u, transcription: t}, nil
+}
+
+func (t *Transcription) CanViewProperty(property string) bool {
+	switch property {
+	case "Sid", "DateCreated", "Status", "Duration", "RecordingSid", "CallSid", "Text":
+		return t.user.CanViewTranscriptions()
+	default:
+		panic("Unknown property " + property)
+	}
+}
+
+func (t *Transcription) Sid() (string, error) {
+	if t.CanViewProperty("Sid") {
+		return t.transcription.Sid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (t *Transcription) DateCreated() (twilio.TwilioTime, error) {
+	if t.CanViewProperty("DateCreated") {
+		return t.transcription.DateCreated, nil
+	} else {
+		return twilio.TwilioTime{}, config.PermissionDenied
+	}
+}
+
+// Status returns "in-progress", "completed" or "failed".
+func (t *Transcription) Status() (string, error) {
+	if t.CanViewProperty("Status") {
+		return t.transcription.Status, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (t *Transcription) Duration() (twilio.TwilioDuration, error) {
+	if t.CanViewProperty("Duration") {
+		return t.transcription.Duration, nil
+	} else {
+		return twilio.TwilioDuration(0), config.PermissionDenied
+	}
+}
+
+func (t *Transcription) RecordingSid() (string, error) {
+	if t.CanViewProperty("RecordingSid") {
+		return t.transcription.RecordingSid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// CallSid returns the sid of the call that was recorded, or the empty string
+// if it's unknown.
+func (t *Transcription) CallSid() (string, error) {
+	if t.CanViewProperty("CallSid") {
+		return t.callSid, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// Text returns the transcription text, with the user's redaction rules
+// applied.
+func (t *Transcription) Text() (string, error) {
+	if t.CanViewProperty("Text") {
+		text, _ := t.user.Redact(t.transcription.Text)
+		return text, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// Redacted returns true if a redaction rule hid part of the transcription
+// text.
+func (t *Transcription) Redacted() bool {
+	if !t.CanViewProperty("Text") {
+		return false
+	}
+	_, redacted := t.user.Redact(t.transcription.Text)
+	return redacted
+}
+
+// getRecordingTranscriptions fetches the transcriptions of the recording with
+// the given sid.
+func (vc *client) getRecordingTranscriptions(ctx context.Context, u *config.User, recordingSid string) ([]*Transcription, error) {
+	if !u.CanPlayRecordings() || !u.CanViewTranscriptions() {
+		return nil, config.PermissionDenied
+	}
+	page := new(twilioTranscriptionPage)
+	data := url.Values{"PageSize": []string{"50"}}
+	if err := vc.client.ListResource(ctx, "Recordings/"+recordingSid+"/Transcriptions", data, page); err != nil {
+		return nil, err
+	}
+	transcriptions := make([]*Transcription, 0, len(page.Transcriptions))
+	for _, tt := range page.Transcriptions {
+		t, err := newTranscription(tt, vc.permission, u)
+		if err == config.ErrTooOld {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		transcriptions = append(transcriptions, t)
+	}
+	return transcriptions, nil
+}
+
+// GetTranscriptionsForRecordings fetches the transcriptions of each recording
+// in parallel, keyed by recording sid.
+func (vc *client) GetTranscriptionsForRecordings(ctx context.Context, u *config.User, recordings []*Recording) (map[string][]*Transcription, error) {
+	if !u.CanPlayRecordings() || !u.CanViewTranscriptions() {
+		return nil, config.PermissionDenied
+	}
+	results := make([][]*Transcription, len(recordings))
+	errs := make([]error, len(recordings))
+	var wg sync.WaitGroup
+	for i, r := range recordings {
+		wg.Add(1)
+		go func(i int, sid string) {
+			defer wg.Done()
+			results[i], errs[i] = vc.getRecordingTranscriptions(ctx, u, sid)
+		}(i, r.recording.Sid)
+	}
+	wg.Wait()
+	m := make(map[string][]*Transcription, len(recordings))
+	for i, r := range recordings {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		m[r.recording.Sid] = results[i]
+	}
+	return m, nil
+}
+
+// GetTranscription fetches a single Transcription from the Twilio API, and
+// the recording it belongs to. If the user's group is limited to some phone
+// numbers, the recorded call must be to or from one of them.
+func (vc *client) GetTranscription(ctx context.Context, u *config.User, sid string) (*Transcription, error) {
+	if !u.CanPlayRecordings() || !u.CanViewTranscriptions() {
+		return nil, config.PermissionDenied
+	}
+	tt := new(twilioTranscription)
+	if err := vc.client.GetResource(ctx, "Transcriptions", sid, tt); err != nil {
+		return nil, err
+	}
+	t, err := newTranscription(tt, vc.permission, u)
+	if err != nil {
+		return nil, err
+	}
+	recording, err := vc.client.Recordings.Get(ctx, tt.RecordingSid)
+	if err != nil {
+		return nil, err
+	}
+	if err := vc.checkRecordedCall(ctx, u, recording); err != nil {
+		return nil, err
+	}
+	t.callSid = recording.CallSid
+	return t, nil
+}
@@ -0,0 +1,69 @@
+package views
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+)
+
+func TestTranscriptionRedactsText(t *testing.T) {
+	t.Parallel()
+	p := &config.Policy{&config.Group{
+		Name:        "support",
+		Users:       []string{"test@example.com"},
+		Permissions: config.AllUserSettings(),
+		Redactions:  []*config.Redaction{{Name: "codes", Pattern: `\d{6}`}},
+	}}
+	u, _, err := p.Lookup("test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := &twilioTranscription{
+		Sid:         "TR123",
+		Status:      "completed",
+		Text:        "Hi, my code is 123456",
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}
+	tr, err := newTranscription(tt, config.NewPermission(time.Hour), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := tr.Text(); text != "Hi, my code is [redacted]" {
+		t.Errorf("expected text to be redacted, got %q", text)
+	}
+	if !tr.Redacted() {
+		t.Error("expected Redacted to be true")
+	}
+	b, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["text"] != "Hi, my code is [redacted]" {
+		t.Errorf("expected JSON text to be redacted, got %v", m["text"])
+	}
+}
+
+func TestTranscriptionPermission(t *testing.T) {
+	t.Parallel()
+	tt := &twilioTranscription{
+		Sid:         "TR123",
+		DateCreated: twilio.TwilioTime{Valid: true, Time: time.Now()},
+	}
+	noTranscriptions := config.AllUserSettings()
+	noTranscriptions.CanViewTranscriptions = false
+	// The transcription is the content of the recording.
+	noRecordings := config.AllUserSettings()
+	noRecordings.CanPlayRecordings = false
+	for _, us := range []*config.UserSettings{noTranscriptions, noRecordings} {
+		if _, err := newTranscription(tt, config.NewPermission(time.Hour), config.NewUser(us)); err != config.PermissionDenied {
+			t.Errorf("expected PermissionDenied, got %v", err)
+		}
+	}
+}
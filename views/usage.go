@@ -0,0 +1,354 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saintpete/logrole/config"
+	"golang.org/x/net/context"
+)
+
+// Usage periods accepted by GetUsage.
+const (
+	UsageDaily   = "daily"
+	UsageMonthly = "monthly"
+)
+
+// UsageDateFormat is the format of the dates the Usage Records API accepts
+// and returns.
+const UsageDateFormat = "2006-01-02"
+
+// UsageCategories are the categories shown on the usage page. Twilio has
+// hundreds of usage categories, and most of them are subsets of others, so we
+// only show a few of the broadest ones. "totalprice" is the sum of every
+// category.
+var UsageCategories = []string{"totalprice", "calls", "sms", "mms", "recordings", "transcriptions", "phonenumbers"}
+
+// ValidUsageCategory returns true if category is one of UsageCategories.
+func ValidUsageCategory(category string) bool {
+	for _, c := range UsageCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// The Usage Records API returns counts and prices as strings, but sometimes
+// as numbers, so accept both.
+type usageNumber float64
+
+func (n *usageNumber) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*n = usageNumber(f)
+	return nil
+}
+
+// twilio-go doesn't have a Usage Records resource, so we decode them
+// ourselves.
+type twilioUsageRecord struct {
+	Category    string      `json:"category"`
+	Description string      `json:"description"`
+	StartDate   string      `json:"start_date"`
+	EndDate     string      `json:"end_date"`
+	Count       usageNumber `json:"count"`
+	CountUnit   string      `json:"count_unit"`
+	Usage       usageNumber `json:"usage"`
+	UsageUnit   string      `json:"usage_unit"`
+	Price       usageNumber `json:"price"`
+	PriceUnit   string      `json:"price_unit"`
+}
+
+type twilioUsageRecordPage struct {
+	UsageRecords []*twilioUsageRecord `json:"usage_records"`
+}
+
+// A UsageRecord is the usage of one category over one day or month.
+type UsageRecord struct {
+	user      *config.User
+	record    *twilioUsageRecord
+	startDate time.Time
+}
+
+func newUsageRecord(r *twilioUsageRecord, u *config.User) (*UsageRecord, error) {
+	if !u.CanViewUsage() {
+		return nil, config.PermissionDenied
+	}
+	start, err := time.Parse(UsageDateFormat, r.StartDate)
+	if err != nil {
+		return nil, errors.New("Invalid start date for usage record: " + r.StartDate)
+	}
+	return &UsageRecord{user: u, record: r, startDate: start}, nil
+}
+
+func (r *UsageRecord) CanViewProperty(property string) bool {
+	switch property {
+	case "Category", "Description", "StartDate", "Count", "CountUnit",
+		"Usage", "UsageUnit", "Price", "PriceUnit":
+		return r.user.CanViewUsage()
+	default:
+		panic("Unknown property " + property)
+	}
+}
+
+func (r *UsageRecord) Category() (string, error) {
+	if r.CanViewProperty("Category") {
+		return r.record.Category, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (r *UsageRecord) Description() (string, error) {
+	if r.CanViewProperty("Description") {
+		return r.record.Description, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// StartDate returns the first day of the period, at midnight UTC.
+func (r *UsageRecord) StartDate() (time.Time, error) {
+	if r.CanViewProperty("StartDate") {
+		return r.startDate, nil
+	} else {
+		return time.Time{}, config.PermissionDenied
+	}
+}
+
+func (r *UsageRecord) Count() (float64, error) {
+	if r.CanViewProperty("Count") {
+		return float64(r.record.Count), nil
+	} else {
+		return 0, config.PermissionDenied
+	}
+}
+
+func (r *UsageRecord) CountUnit() (string, error) {
+	if r.CanViewProperty("CountUnit") {
+		return r.record.CountUnit, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (r *UsageRecord) Usage() (float64, error) {
+	if r.CanViewProperty("Usage") {
+		return float64(r.record.Usage), nil
+	} else {
+		return 0, config.PermissionDenied
+	}
+}
+
+func (r *UsageRecord) UsageUnit() (string, error) {
+	if r.CanViewProperty("UsageUnit") {
+		return r.record.UsageUnit, nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+func (r *UsageRecord) Price() (float64, error) {
+	if r.CanViewProperty("Price") {
+		return float64(r.record.Price), nil
+	} else {
+		return 0, config.PermissionDenied
+	}
+}
+
+func (r *UsageRecord) FriendlyPrice() (string, error) {
+	if r.CanViewProperty("Price") && r.CanViewProperty("PriceUnit") {
+		return FriendlyUsagePrice(float64(r.record.Price), r.record.PriceUnit), nil
+	} else {
+		return "", config.PermissionDenied
+	}
+}
+
+// FriendlyUsagePrice formats price for display, e.g. "$12.34" for a price
+// in USD.
+func FriendlyUsagePrice(price float64, unit string) string {
+	if strings.ToLower(unit) == "usd" || unit == "" {
+		return fmt.Sprintf("$%.2f", price)
+	}
+	return fmt.Sprintf("%.2f %s", price, strings.ToUpper(unit))
+}
+
+// Usage is the usage of each category between two dates, one record for each
+// day or month.
+type Usage struct {
+	period     string
+	start      time.Time
+	end        time.Time
+	categories []string
+	// Records for each category, oldest first.
+	records map[string][]*UsageRecord
+}
+
+func (u *Usage) Period() string {
+	return u.period
+}
+
+func (u *Usage) Start() time.Time {
+	return u.start
+}
+
+func (u *Usage) End() time.Time {
+	return u.end
+}
+
+// Categories returns the categories that were fetched, in the order of
+// UsageCategories.
+func (u *Usage) Categories() []string {
+	return u.categories
+}
+
+// Records returns the records for category, oldest first.
+func (u *Usage) Records(category string) []*UsageRecord {
+	return u.records[category]
+}
+
+// Description returns Twilio's description of category, or the category if
+// there are no records for it.
+func (u *Usage) Description(category string) string {
+	for _, r := range u.records[category] {
+		if r.record.Description != "" {
+			return r.record.Description
+		}
+	}
+	return category
+}
+
+// TotalCount returns the sum of the counts of every record in category.
+func (u *Usage) TotalCount(category string) float64 {
+	var count float64
+	for _, r := range u.records[category] {
+		count += float64(r.record.Count)
+	}
+	return count
+}
+
+// TotalPrice returns the sum of the prices of every record in category.
+func (u *Usage) TotalPrice(category string) float64 {
+	var price float64
+	for _, r := range u.records[category] {
+		price += float64(r.record.Price)
+	}
+	return price
+}
+
+// CountUnit returns the unit of the counts in category, e.g. "messages", or
+// the empty string if there are no records for it.
+func (u *Usage) CountUnit(category string) string {
+	if records := u.records[category]; len(records) > 0 {
+		return records[0].record.CountUnit
+	}
+	return ""
+}
+
+// FriendlyTotalPrice returns the sum of the prices of every record in
+// category, formatted for display.
+func (u *Usage) FriendlyTotalPrice(category string) string {
+	unit := ""
+	if records := u.records[category]; len(records) > 0 {
+		unit = records[0].record.PriceUnit
+	}
+	return FriendlyUsagePrice(u.TotalPrice(category), unit)
+}
+
+// usagePath returns the Usage Records subresource for period.
+func usagePath(period string) (string, error) {
+	switch period {
+	case UsageDaily:
+		return "Usage/Records/Daily", nil
+	case UsageMonthly:
+		return "Usage/Records/Monthly", nil
+	default:
+		return "", errors.New("Unknown usage period: " + period)
+	}
+}
+
+// The most records the Usage Records API returns in a page.
+const maxUsagePageSize = 1000
+
+// getUsageRecords fetches the records for one category, oldest first.
+func (vc *client) getUsageRecords(ctx context.Context, u *config.User, path string, category string, start, end time.Time) ([]*UsageRecord, error) {
+	data := url.Values{}
+	data.Set("Category", category)
+	data.Set("StartDate", start.Format(UsageDateFormat))
+	data.Set("EndDate", end.Format(UsageDateFormat))
+	data.Set("PageSize", strconv.Itoa(maxUsagePageSize))
+	page := new(twilioUsageRecordPage)
+	if err := vc.client.ListResource(ctx, path, data, page); err != nil {
+		return nil, err
+	}
+	records := make([]*UsageRecord, len(page.UsageRecords))
+	// Twilio returns the newest records first.
+	for i, tr := range page.UsageRecords {
+		r, err := newUsageRecord(tr, u)
+		if err != nil {
+			return nil, err
+		}
+		records[len(records)-1-i] = r
+	}
+	return records, nil
+}
+
+// GetUsage fetches the daily or monthly usage records between start and end
+// (inclusive) for category, or for every category in UsageCategories if
+// category is empty. Only the year, month and day of start and end are used.
+// Categories are fetched in parallel. A page holds at most 1000 records, so
+// callers should limit the number of days or months requested.
+func (vc *client) GetUsage(ctx context.Context, u *config.User, period string, category string, start, end time.Time) (*Usage, error) {
+	if !u.CanViewUsage() {
+		return nil, config.PermissionDenied
+	}
+	path, err := usagePath(period)
+	if err != nil {
+		return nil, err
+	}
+	categories := UsageCategories
+	if category != "" {
+		if !ValidUsageCategory(category) {
+			return nil, errors.New("Unknown usage category: " + category)
+		}
+		categories = []string{category}
+	}
+	results := make([][]*UsageRecord, len(categories))
+	errs := make([]error, len(categories))
+	var wg sync.WaitGroup
+	for i, c := range categories {
+		wg.Add(1)
+		go func(i int, c string) {
+			defer wg.Done()
+			results[i], errs[i] = vc.getUsageRecords(ctx, u, path, c, start, end)
+		}(i, c)
+	}
+	wg.Wait()
+	usage := &Usage{
+		period:     period,
+		start:      start,
+		end:        end,
+		categories: categories,
+		records:    make(map[string][]*UsageRecord, len(categories)),
+	}
+	for i, c := range categories {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		usage.records[c] = results[i]
+	}
+	return usage, nil
+}
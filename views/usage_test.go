@@ -0,0 +1,78 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	twilio "github.com/saintpete/twilio-go"
+	"github.com/saintpete/logrole/config"
+	"github.com/saintpete/logrole/services"
+	"golang.org/x/net/context"
+)
+
+func TestGetUsage(t *testing.T) {
+	t.Parallel()
+	var query string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/Usage/Records/Daily.json") {
+			w.WriteHeader(404)
+			return
+		}
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		// Twilio lists the newest records first, and sometimes sends
+		// numbers as strings.
+		fmt.Fprintf(w, `{"usage_records": [
+			{"category": "sms", "description": "SMS", "start_date": "2016-11-09", "end_date": "2016-11-09", "count": "3", "count_unit": "messages", "price": "0.0225", "price_unit": "usd"},
+			{"category": "sms", "description": "SMS", "start_date": "2016-11-08", "end_date": "2016-11-08", "count": 1, "count_unit": "messages", "price": 0.0075, "price_unit": "usd"}
+		]}`)
+	}))
+	defer s.Close()
+	c := twilio.NewClient("AC123", "123", nil)
+	c.Base = s.URL
+	l := log.New()
+	l.SetHandler(log.DiscardHandler())
+	vc := NewClient(l, c, services.NewRandomKey(), config.NewPermission(config.DefaultMaxResourceAge))
+	u := config.NewUser(config.AllUserSettings())
+	start := time.Date(2016, 11, 8, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2016, 11, 9, 0, 0, 0, 0, time.UTC)
+	usage, err := vc.GetUsage(context.Background(), u, UsageDaily, "sms", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, "StartDate=2016-11-08") || !strings.Contains(query, "EndDate=2016-11-09") {
+		t.Errorf("expected date filters in query, got %s", query)
+	}
+	records := usage.Records("sms")
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if date, _ := records[0].StartDate(); !date.Equal(start) {
+		t.Errorf("expected oldest record first, got %v", date)
+	}
+	if count := usage.TotalCount("sms"); count != 4 {
+		t.Errorf("expected total count of 4, got %v", count)
+	}
+	if price := usage.FriendlyTotalPrice("sms"); price != "$0.03" {
+		t.Errorf("expected total price of $0.03, got %s", price)
+	}
+}
+
+func TestGetUsagePermission(t *testing.T) {
+	t.Parallel()
+	l := log.New()
+	l.SetHandler(log.DiscardHandler())
+	c := twilio.NewClient("AC123", "123", nil)
+	vc := NewClient(l, c, services.NewRandomKey(), config.NewPermission(config.DefaultMaxResourceAge))
+	us := config.AllUserSettings()
+	us.CanViewUsage = false
+	now := time.Now()
+	if _, err := vc.GetUsage(context.Background(), config.NewUser(us), UsageDaily, "", now, now); err != config.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+}